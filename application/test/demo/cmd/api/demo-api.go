@@ -4,6 +4,7 @@ import (
 	"github.com/vsaien/cuter/application/test/demo/model"
 	"github.com/vsaien/cuter/lib/cuter"
 	"github.com/vsaien/cuter/lib/rpcx"
+	"github.com/vsaien/cuter/lib/service"
 	"github.com/vsaien/cuter/lib/stores/redis"
 	"flag"
 	"fmt"
@@ -41,6 +42,8 @@ func main() {
 	mongoTimeout := time.Duration(c.Mongodb.Timeout) * time.Millisecond
 	// db := mgoSession.DB(c.Mongodb.Database)
 	mysql := sqlx.NewMysql(c.Mysql.DataSource)
+	service.RegisterHealthCheck("cache-redis", cr.HealthCheck)
+	service.RegisterHealthCheck("mysql", sqlx.NewHealthCheck(mysql))
 	demoModel := model.NewDemoModel(c.Mysql.Table.Demo, cr, mysql, nil, c.Mongodb.Collection.Demo, c.Mongodb.Concurrency, mongoTimeout)
 
 	demoRpcCli, err := rpcx.NewClient(c.DemoRpc)
@@ -44,6 +44,13 @@ func SetBreaker(st Settings) {
 	lock.Unlock()
 }
 
+// SetGoogleBreaker makes the requests of st.Name protected by a GoogleBreaker.
+func SetGoogleBreaker(st GoogleSettings) {
+	lock.Lock()
+	breakers[st.Name] = NewGoogleBreaker(st)
+	lock.Unlock()
+}
+
 func do(name string, execute func(b Breaker) error) error {
 	lock.RLock()
 	b, ok := breakers[name]
@@ -5,13 +5,23 @@ import (
 	"time"
 )
 
+const (
+	ClassicType = "classic"
+	GoogleType  = "google"
+)
+
 type (
 	BreakerConfig struct {
 		Name        string
 		Enable      bool   `json:",default=true"`
+		Type        string `json:",options=classic|google,default=classic"`
 		MaxRequests uint32 `json:",default=3"`
 		Interval    int    `json:",default=5"`
 		Timeout     int    `json:",default=10"`
+		// the options of google breaker, Window is in seconds
+		K          float64 `json:",optional"`
+		Window     int     `json:",optional"`
+		Protection int     `json:",optional"`
 	}
 
 	Breakers []BreakerConfig
@@ -28,6 +38,16 @@ func (b Breakers) Setup() error {
 			continue
 		}
 
+		if setting.Type == GoogleType {
+			SetGoogleBreaker(GoogleSettings{
+				Name:       setting.Name,
+				K:          setting.K,
+				Window:     time.Duration(setting.Window) * time.Second,
+				Protection: setting.Protection,
+			})
+			continue
+		}
+
 		SetBreaker(Settings{
 			Name:        setting.Name,
 			MaxRequests: setting.MaxRequests,
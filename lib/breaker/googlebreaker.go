@@ -0,0 +1,174 @@
+package breaker
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/vsaien/cuter/lib/collection"
+)
+
+const (
+	// 250ms for bucket duration
+	defaultGoogleWindow     = time.Second * 10
+	defaultGoogleBuckets    = 40
+	defaultGoogleK          = 1.5
+	defaultGoogleProtection = 5
+)
+
+type (
+	// GoogleSettings configures GoogleBreaker:
+	//
+	// Name is the name of the GoogleBreaker.
+	//
+	// K is the multiplier of the accepts, the larger K is, the less requests are rejected.
+	// If K is 0, it's set to 1.5, which means 1 failure is allowed in every 3 requests.
+	//
+	// Window is the period that the requests and accepts are counted in,
+	// and Buckets is the number of the buckets that Window is split into.
+	// If Window is 0, it's set to 10 seconds, if Buckets is 0, it's set to 40.
+	//
+	// Protection is the number of requests in Window that are never rejected,
+	// to avoid breaking on the starting or low traffic. If Protection is 0, it's set to 5.
+	GoogleSettings struct {
+		Name       string
+		K          float64
+		Window     time.Duration
+		Buckets    int
+		Protection int
+	}
+
+	// GoogleBreaker is the client-side adaptive throttling described in the Google SRE book,
+	// the requests are rejected with the probability of max(0, (requests - K*accepts) / (requests + 1)).
+	GoogleBreaker struct {
+		name       string
+		k          float64
+		protection int64
+		stat       *collection.RollingWindow
+		randLock   sync.Mutex
+		rand       *rand.Rand
+	}
+)
+
+// NewGoogleBreaker returns a new GoogleBreaker configured with the given GoogleSettings.
+func NewGoogleBreaker(st GoogleSettings) *GoogleBreaker {
+	if st.K <= 0 {
+		st.K = defaultGoogleK
+	}
+	if st.Window <= 0 {
+		st.Window = defaultGoogleWindow
+	}
+	if st.Buckets <= 0 {
+		st.Buckets = defaultGoogleBuckets
+	}
+	if st.Protection <= 0 {
+		st.Protection = defaultGoogleProtection
+	}
+
+	return &GoogleBreaker{
+		name:       st.Name,
+		k:          st.K,
+		protection: int64(st.Protection),
+		stat:       collection.NewRollingWindow(st.Buckets, st.Window/time.Duration(st.Buckets)),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Name returns the name of the GoogleBreaker.
+func (gb *GoogleBreaker) Name() string {
+	return gb.name
+}
+
+// Do runs the given request if the GoogleBreaker accepts it.
+// Do returns ErrOpenState instantly if the GoogleBreaker rejects the request.
+// If a panic occurs in the request, the GoogleBreaker handles it as an error
+// and causes the same panic again.
+func (gb *GoogleBreaker) Do(req func() error) error {
+	return gb.doReq(req, nil, defaultAcceptable)
+}
+
+// DoWithAcceptable runs the given request if the GoogleBreaker accepts it.
+// acceptable checks if it's a successful call, even if the err is not nil.
+func (gb *GoogleBreaker) DoWithAcceptable(req func() error, acceptable Acceptable) error {
+	return gb.doReq(req, nil, acceptable)
+}
+
+// DoWithFallback runs the given request if the GoogleBreaker accepts it.
+// DoWithFallback runs the fallback if the GoogleBreaker rejects the request.
+func (gb *GoogleBreaker) DoWithFallback(req func() error, fallback func(err error) error) error {
+	return gb.doReq(req, fallback, defaultAcceptable)
+}
+
+// DoWithFallbackAcceptable runs the given request if the GoogleBreaker accepts it.
+// DoWithFallbackAcceptable runs the fallback if the GoogleBreaker rejects the request.
+// acceptable checks if it's a successful call, even if the err is not nil.
+func (gb *GoogleBreaker) DoWithFallbackAcceptable(req func() error, fallback func(err error) error,
+	acceptable Acceptable) error {
+	return gb.doReq(req, fallback, acceptable)
+}
+
+func (gb *GoogleBreaker) accept() error {
+	accepts, total := gb.history()
+	weightedAccepts := gb.k * float64(accepts)
+	// https://landing.google.com/sre/sre-book/chapters/handling-overload/#eq2101
+	dropRatio := math.Max(0, (float64(total-gb.protection)-weightedAccepts)/float64(total+1))
+	if dropRatio <= 0 {
+		return nil
+	}
+
+	if gb.proba(dropRatio) {
+		return ErrOpenState
+	}
+
+	return nil
+}
+
+func (gb *GoogleBreaker) doReq(req func() error, fallback func(err error) error, acceptable Acceptable) error {
+	if err := gb.accept(); err != nil {
+		if fallback != nil {
+			return fallback(err)
+		} else {
+			return err
+		}
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			gb.markFailure()
+			panic(e)
+		}
+	}()
+
+	err := req()
+	if acceptable(err) {
+		gb.markSuccess()
+	} else {
+		gb.markFailure()
+	}
+	return err
+}
+
+func (gb *GoogleBreaker) history() (accepts, total int64) {
+	gb.stat.Reduce(func(b *collection.Bucket) {
+		accepts += int64(b.Sum)
+		total += b.Count
+	})
+
+	return
+}
+
+func (gb *GoogleBreaker) markFailure() {
+	gb.stat.Add(0)
+}
+
+func (gb *GoogleBreaker) markSuccess() {
+	gb.stat.Add(1)
+}
+
+func (gb *GoogleBreaker) proba(ratio float64) bool {
+	gb.randLock.Lock()
+	defer gb.randLock.Unlock()
+
+	return gb.rand.Float64() < ratio
+}
@@ -0,0 +1,135 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testBuckets = 10
+
+func getGoogleBreaker() *GoogleBreaker {
+	return NewGoogleBreaker(GoogleSettings{
+		Name:    "google",
+		Window:  time.Second,
+		Buckets: testBuckets,
+	})
+}
+
+func markSuccess(b *GoogleBreaker, count int) {
+	for i := 0; i < count; i++ {
+		b.markSuccess()
+	}
+}
+
+func markFailed(b *GoogleBreaker, count int) {
+	for i := 0; i < count; i++ {
+		b.markFailure()
+	}
+}
+
+func TestGoogleBreakerClose(t *testing.T) {
+	b := getGoogleBreaker()
+	markSuccess(b, 80)
+	assert.Nil(t, b.accept())
+	markSuccess(b, 120)
+	assert.Nil(t, b.accept())
+}
+
+func TestGoogleBreakerOpen(t *testing.T) {
+	b := getGoogleBreaker()
+	markSuccess(b, 10)
+	assert.Nil(t, b.accept())
+	markFailed(b, 100000)
+	time.Sleep(time.Millisecond * 200)
+	verify(t, func() bool {
+		return b.accept() != nil
+	})
+}
+
+func TestGoogleBreakerRecover(t *testing.T) {
+	b := getGoogleBreaker()
+	markFailed(b, 100000)
+	// the failures are out of the window
+	time.Sleep(time.Millisecond * 1100)
+	assert.Nil(t, b.accept())
+}
+
+func TestGoogleBreakerProtection(t *testing.T) {
+	b := getGoogleBreaker()
+	markFailed(b, defaultGoogleProtection)
+	assert.Nil(t, b.accept())
+}
+
+func TestGoogleBreakerFallback(t *testing.T) {
+	b := getGoogleBreaker()
+	markFailed(b, 100000)
+	fallbackErr := errors.New("fallback")
+	var called int
+	for i := 0; i < 100; i++ {
+		err := b.DoWithFallback(func() error {
+			return nil
+		}, func(err error) error {
+			called++
+			assert.Equal(t, ErrOpenState, err)
+			return fallbackErr
+		})
+		if err != nil {
+			assert.Equal(t, fallbackErr, err)
+		}
+	}
+	assert.True(t, called > 0)
+}
+
+func TestGoogleBreakerAcceptable(t *testing.T) {
+	b := getGoogleBreaker()
+	errAcceptable := errors.New("any")
+	assert.Equal(t, errAcceptable, b.DoWithAcceptable(func() error {
+		return errAcceptable
+	}, func(err error) bool {
+		return true
+	}))
+	accepts, total := b.history()
+	assert.Equal(t, int64(1), accepts)
+	assert.Equal(t, int64(1), total)
+}
+
+func TestGoogleBreakerPanic(t *testing.T) {
+	b := getGoogleBreaker()
+	assert.Panics(t, func() {
+		_ = b.Do(func() error {
+			panic("fail")
+		})
+	})
+	accepts, total := b.history()
+	assert.Equal(t, int64(0), accepts)
+	assert.Equal(t, int64(1), total)
+}
+
+func TestBreakersSetupGoogle(t *testing.T) {
+	assert.Nil(t, Breakers{
+		{
+			Name:   "google-setup",
+			Enable: true,
+			Type:   GoogleType,
+		},
+	}.Setup())
+
+	lock.RLock()
+	b := breakers["google-setup"]
+	lock.RUnlock()
+	_, ok := b.(*GoogleBreaker)
+	assert.True(t, ok)
+}
+
+func verify(t *testing.T, fn func() bool) {
+	var count int
+	for i := 0; i < 100; i++ {
+		if fn() {
+			count++
+		}
+	}
+	assert.True(t, count >= 80, "should be above 80, actual %d", count)
+}
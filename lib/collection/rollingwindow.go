@@ -0,0 +1,128 @@
+package collection
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	RollingWindowOption func(rollingWindow *RollingWindow)
+
+	// Bucket holds the sum and the count of the values added in an interval.
+	Bucket struct {
+		Sum   float64
+		Count int64
+	}
+
+	// RollingWindow keeps the values added in the last size intervals, each interval is a bucket.
+	RollingWindow struct {
+		lock          sync.RWMutex
+		size          int
+		buckets       []Bucket
+		interval      time.Duration
+		offset        int
+		ignoreCurrent bool
+		lastTime      time.Duration
+	}
+)
+
+// NewRollingWindow returns a RollingWindow with size buckets of interval,
+// it panics if size or interval is not positive.
+func NewRollingWindow(size int, interval time.Duration, opts ...RollingWindowOption) *RollingWindow {
+	if size <= 0 {
+		panic(fmt.Sprintf("size of rolling window must be positive, got %d", size))
+	}
+	if interval <= 0 {
+		panic(fmt.Sprintf("interval of rolling window must be positive, got %s", interval))
+	}
+
+	w := &RollingWindow{
+		size:     size,
+		buckets:  make([]Bucket, size),
+		interval: interval,
+		lastTime: sinceStart(),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Add adds v into the bucket of the current interval.
+func (rw *RollingWindow) Add(v float64) {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	rw.updateOffset()
+	rw.buckets[rw.offset].add(v)
+}
+
+// Reduce calls fn on the buckets in the window, from the oldest to the latest,
+// the expired buckets are skipped.
+func (rw *RollingWindow) Reduce(fn func(b *Bucket)) {
+	rw.lock.RLock()
+	defer rw.lock.RUnlock()
+
+	span := rw.span()
+	// the bucket at offset is the current one only if no interval passed since the last update
+	end := rw.size
+	if span == 0 && rw.ignoreCurrent {
+		end--
+	}
+	for i := span + 1; i <= end; i++ {
+		fn(&rw.buckets[(rw.offset+i)%rw.size])
+	}
+}
+
+func (rw *RollingWindow) span() int {
+	span := int((sinceStart() - rw.lastTime) / rw.interval)
+	if span < 0 {
+		return 0
+	}
+	if span > rw.size {
+		return rw.size
+	}
+
+	return span
+}
+
+func (rw *RollingWindow) updateOffset() {
+	span := rw.span()
+	if span <= 0 {
+		return
+	}
+
+	for i := 1; i <= span; i++ {
+		rw.buckets[(rw.offset+i)%rw.size].reset()
+	}
+	rw.offset = (rw.offset + span) % rw.size
+	now := sinceStart()
+	// align to the interval boundary
+	rw.lastTime = now - (now-rw.lastTime)%rw.interval
+}
+
+// IgnoreCurrentBucket lets Reduce skip the bucket of the current interval, because it's incomplete.
+func IgnoreCurrentBucket() RollingWindowOption {
+	return func(w *RollingWindow) {
+		w.ignoreCurrent = true
+	}
+}
+
+func (b *Bucket) add(v float64) {
+	b.Sum += v
+	b.Count++
+}
+
+func (b *Bucket) reset() {
+	b.Sum = 0
+	b.Count = 0
+}
+
+var startTime = time.Now()
+
+// the monotonic duration, which is not affected by the wall clock changes
+func sinceStart() time.Duration {
+	return time.Since(startTime)
+}
@@ -0,0 +1,139 @@
+package collection
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const duration = time.Millisecond * 50
+
+func TestNewRollingWindowBadArgs(t *testing.T) {
+	assert.Panics(t, func() {
+		NewRollingWindow(0, duration)
+	})
+	assert.Panics(t, func() {
+		NewRollingWindow(3, 0)
+	})
+}
+
+func TestRollingWindowAdd(t *testing.T) {
+	const size = 3
+	r := NewRollingWindow(size, duration)
+	listBuckets := func() []float64 {
+		var buckets []float64
+		r.Reduce(func(b *Bucket) {
+			buckets = append(buckets, b.Sum)
+		})
+		return buckets
+	}
+	assert.Equal(t, []float64{0, 0, 0}, listBuckets())
+	r.Add(1)
+	assert.Equal(t, []float64{0, 0, 1}, listBuckets())
+	elapse()
+	r.Add(2)
+	r.Add(3)
+	assert.Equal(t, []float64{0, 1, 5}, listBuckets())
+	elapse()
+	r.Add(4)
+	r.Add(5)
+	r.Add(6)
+	assert.Equal(t, []float64{1, 5, 15}, listBuckets())
+	elapse()
+	r.Add(7)
+	assert.Equal(t, []float64{5, 15, 7}, listBuckets())
+}
+
+func TestRollingWindowExpire(t *testing.T) {
+	const size = 3
+	r := NewRollingWindow(size, duration)
+	r.Add(1)
+	r.Add(2)
+	time.Sleep(duration * size)
+
+	var count int
+	r.Reduce(func(b *Bucket) {
+		count++
+	})
+	assert.Equal(t, 0, count)
+}
+
+func TestRollingWindowIgnoreCurrentBucket(t *testing.T) {
+	const size = 4
+	r := NewRollingWindow(size, time.Hour, IgnoreCurrentBucket())
+	r.Add(1)
+	var sum float64
+	var count int
+	r.Reduce(func(b *Bucket) {
+		sum += b.Sum
+		count++
+	})
+	assert.Equal(t, float64(0), sum)
+	assert.Equal(t, size-1, count)
+}
+
+func TestRollingWindowReduce(t *testing.T) {
+	const size = 4
+	tests := []struct {
+		win    *RollingWindow
+		expect float64
+	}{
+		{
+			win:    NewRollingWindow(size, duration),
+			expect: 10,
+		},
+		{
+			win:    NewRollingWindow(size, duration, IgnoreCurrentBucket()),
+			expect: 4,
+		},
+	}
+
+	for _, test := range tests {
+		r := test.win
+		for x := 0; x < size; x++ {
+			for i := 0; i <= x; i++ {
+				r.Add(float64(i))
+			}
+			if x < size-1 {
+				elapse()
+			}
+		}
+		var result float64
+		r.Reduce(func(b *Bucket) {
+			result += b.Sum
+		})
+		assert.Equal(t, test.expect, result)
+	}
+}
+
+func BenchmarkRollingWindowAdd(b *testing.B) {
+	r := NewRollingWindow(40, time.Millisecond*250)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.Add(rand.Float64())
+		}
+	})
+}
+
+func BenchmarkRollingWindowReduce(b *testing.B) {
+	r := NewRollingWindow(40, time.Millisecond*250)
+	for i := 0; i < 1000; i++ {
+		r.Add(float64(i))
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			var sum float64
+			r.Reduce(func(b *Bucket) {
+				sum += b.Sum
+			})
+		}
+	})
+}
+
+func elapse() {
+	time.Sleep(duration)
+}
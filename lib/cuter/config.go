@@ -29,6 +29,19 @@ type (
 		// milliseconds
 		Timeout   int64         `json:",optional"`
 		Signature SignatureConf `json:",optional"`
+		// serves https if both CertFile and KeyFile are set,
+		// the certificate pair is reloaded when changed on disk.
+		CertFile string `json:",optional"`
+		KeyFile  string `json:",optional"`
+		// if set, the client certificates are required and verified with the CAs in it.
+		ClientCAFile string `json:",optional"`
+		// if set, serves http on Port and https on HttpsPort side by side.
+		HttpsPort int `json:",optional"`
+		// milliseconds, the max time to wait for the in-flight requests on stopping
+		ShutdownTimeout int64 `json:",default=5000"`
+		// milliseconds, the time to keep serving after the readiness reports draining on stopping,
+		// for the load balancers to notice it and stop sending new requests.
+		DrainDelay int64 `json:",optional"`
 	}
 )
 
@@ -4,7 +4,10 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/vsaien/cuter/lib/httphandler"
 	"github.com/vsaien/cuter/lib/httprouter"
+	"github.com/vsaien/cuter/lib/limit"
+	"github.com/vsaien/cuter/lib/load"
 	"github.com/vsaien/cuter/lib/logx"
 )
 
@@ -16,8 +19,9 @@ type (
 	RunOption func(*Engine)
 
 	Engine struct {
-		srv  *server
-		opts runOptions
+		srv        *server
+		opts       runOptions
+		signatures []SignatureConf
 	}
 )
 
@@ -44,9 +48,21 @@ func NewEngine(c ServerConfig, opts ...RunOption) (*Engine, error) {
 
 	if err := c.SetUp(); err != nil {
 		return nil, err
-	} else {
-		return engine, nil
 	}
+
+	// the private keys are loaded once here, shared by the route groups of WithSignature
+	if len(c.Signature.PrivateKeys) > 0 {
+		if err := engine.srv.loadSignature(c.Signature); err != nil {
+			return nil, err
+		}
+	}
+	for _, signature := range engine.signatures {
+		if err := engine.srv.loadSignature(signature); err != nil {
+			return nil, err
+		}
+	}
+
+	return engine, nil
 }
 
 func (e *Engine) AddRoutes(rs []Route, opts ...RouteOption) {
@@ -63,11 +79,24 @@ func (e *Engine) AddRoute(r Route, opts ...RouteOption) {
 	e.AddRoutes([]Route{r}, opts...)
 }
 
+// Routes returns all the routes added to the engine, in the order they were added.
+func (e *Engine) Routes() []Route {
+	return e.srv.Routes()
+}
+
+// Start serves the added routes, along with the liveness on /healthz and the readiness on /readyz,
+// which are skipped if the GET routes on the same paths are added.
 func (e *Engine) Start() {
 	handleError(e.opts.start(e.srv))
 }
 
+// Stop drains the engine, the readiness endpoint reports draining, the new connections
+// are refused after DrainDelay, and the in-flight requests are waited up to ShutdownTimeout
+// before the traffic metrics and logs are flushed.
 func (e *Engine) Stop() {
+	if err := e.srv.shutdown(); err != nil {
+		logx.Error(err)
+	}
 	logx.Close()
 }
 
@@ -75,6 +104,83 @@ func (e *Engine) Use(middleware Middleware) {
 	e.srv.use(middleware)
 }
 
+// WithJwt returns a RouteOption to verify the jwt token of the requests with secret,
+// the claims are put into the request context, which can be read by contextx.For.
+func WithJwt(secret string) RouteOption {
+	return func(r *featuredRoutes) {
+		validateSecret(secret)
+		r.jwt.enabled = true
+		r.jwt.secret = secret
+	}
+}
+
+// WithJwtTransition returns a RouteOption to verify the jwt token with both secret and prevSecret,
+// it's used when rotating the secret, the tokens signed by either of them are accepted.
+func WithJwtTransition(secret, prevSecret string) RouteOption {
+	return func(r *featuredRoutes) {
+		// why not validate prevSecret, because prevSecret is an already used one,
+		// even it's not long enough, let it go.
+		validateSecret(secret)
+		r.jwt.enabled = true
+		r.jwt.secret = secret
+		r.jwt.prevSecret = prevSecret
+	}
+}
+
+// WithLimiter returns a RouteOption to reject the requests with code 429 when limiter reports
+// the quota is exceeded, the requests are keyed by keyFunc, like httphandler.LimitByIp,
+// httphandler.LimitByIpBehindProxies, httphandler.LimitByUserId or a custom one, and by the
+// remote addresses of the connections if keyFunc is nil.
+func WithLimiter(limiter limit.Limiter, keyFunc httphandler.LimitKeyFunc) RouteOption {
+	return func(r *featuredRoutes) {
+		r.limit.limiter = limiter
+		r.limit.keyFunc = keyFunc
+	}
+}
+
+// WithShedder returns a RouteOption to reject the requests with code 503 when shedder
+// reports the service is overloaded, the shedder can be shared by multiple route groups.
+func WithShedder(shedder load.Shedder) RouteOption {
+	return func(r *featuredRoutes) {
+		r.shedder = shedder
+	}
+}
+
+// WithSignature returns a RouteOption to verify the X-Content-Security signature of the requests,
+// with the private keys in signature, the encrypted bodies are decrypted as well.
+// The private keys must be loaded by NewEngine, either as ServerConfig.Signature or by WithSignatures,
+// otherwise Start fails with ErrSignatureConfig.
+func WithSignature(signature SignatureConf) RouteOption {
+	return func(r *featuredRoutes) {
+		r.signature.enabled = true
+		r.signature.Strict = signature.Strict
+		r.signature.PrivateKeys = signature.PrivateKeys
+	}
+}
+
+// WithSignatures returns a RunOption to load the private keys of the signatures used by WithSignature
+// other than ServerConfig.Signature, NewEngine returns ErrSignatureConfig if any of them are missing
+// or unreadable.
+func WithSignatures(signatures ...SignatureConf) RunOption {
+	return func(engine *Engine) {
+		engine.signatures = append(engine.signatures, signatures...)
+	}
+}
+
+// WithUnauthorizedBody returns a RunOption to set the body written as json on jwt verification failures.
+func WithUnauthorizedBody(body interface{}) RunOption {
+	return func(engine *Engine) {
+		engine.srv.unauthorizedBody = body
+	}
+}
+
+// WithUnauthorizedCallback returns a RunOption to set the callback called on jwt verification failures.
+func WithUnauthorizedCallback(callback httphandler.UnauthorizedCallback) RunOption {
+	return func(engine *Engine) {
+		engine.srv.unauthorizedCallback = callback
+	}
+}
+
 func handleError(err error) {
 	// ErrServerClosed means the server is closed manually
 	if err == nil || err == http.ErrServerClosed {
@@ -4,25 +4,50 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"sync"
 	"time"
 
+	"github.com/vsaien/cuter/lib/codec"
 	"github.com/vsaien/cuter/lib/httphandler"
 	"github.com/vsaien/cuter/lib/httprouter"
 	"github.com/vsaien/cuter/lib/httpserver"
+	"github.com/vsaien/cuter/lib/load"
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/system"
+	"github.com/vsaien/cuter/lib/threading"
 	"github.com/vsaien/cuter/lib/traffic"
 
 	"github.com/justinas/alice"
 )
 
-var ErrSignatureConfig = errors.New("bad config for Signature")
+var (
+	ErrSignatureConfig = errors.New("bad config for Signature")
+	ErrCertConfig      = errors.New("both CertFile and KeyFile are required for https")
+)
 
 type (
 	Middleware func(handle http.HandlerFunc) http.HandlerFunc
 
 	server struct {
-		conf        ServerConfig
-		routes      []featuredRoutes
-		middlewares []Middleware
+		conf                 ServerConfig
+		routes               []featuredRoutes
+		middlewares          []Middleware
+		unauthorizedBody     interface{}
+		unauthorizedCallback httphandler.UnauthorizedCallback
+		signatures           []loadedSignature
+		metrics              *traffic.Metrics
+		state                int32
+		httpServers          []*http.Server
+		shutdownOnce         sync.Once
+		shutdownErr          error
+		lock                 sync.Mutex
+	}
+
+	// loadedSignature is the decrypters loaded from the private keys of a SignatureConf.
+	loadedSignature struct {
+		privateKeys []PrivateKeyConf
+		decrypters  map[string]codec.RsaDecrypter
 	}
 )
 
@@ -41,15 +66,57 @@ func (s *server) Start() error {
 }
 
 func (s *server) StartWithRouter(router httprouter.Router) error {
-	return httpserver.StartHttp(s.conf.Host, s.conf.Port, router)
+	if err := s.bindRoutes(router); err != nil {
+		return err
+	}
+
+	system.AddWrapUpListener(func() {
+		if err := s.shutdown(); err != nil {
+			logx.Error(err)
+		}
+	})
+
+	return s.serve(router)
+}
+
+func (s *server) Routes() []Route {
+	var routes []Route
+
+	for _, fr := range s.routes {
+		routes = append(routes, fr.routes...)
+	}
+
+	return routes
 }
 
-func (s *server) bindRoute(router httprouter.Router, metrics *traffic.Metrics, route Route,
-	customize func(chain alice.Chain) alice.Chain) error {
+func (s *server) bindFeaturedRoutes(router httprouter.Router, fr featuredRoutes, metrics *traffic.Metrics) error {
+	if fr.signature.enabled {
+		decrypters, ok := s.findDecrypters(fr.signature.SignatureConf)
+		if !ok {
+			logx.Error("private keys of signature are not loaded by NewEngine, use WithSignatures")
+			return ErrSignatureConfig
+		}
+		fr.signature.decrypters = decrypters
+	}
+
+	customize := s.customizeChain(fr, metrics)
+	for _, route := range fr.routes {
+		if err := s.bindRoute(router, metrics, fr.shedder, route, customize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *server) bindRoute(router httprouter.Router, metrics *traffic.Metrics, shedder load.Shedder,
+	route Route, customize func(chain alice.Chain) alice.Chain) error {
 	chain := alice.New(s.getLogHandler())
+	// the dropped requests are kept out of the traffic metrics, which the shedder measures by
 	chain = chain.Append(httphandler.MaxConns(s.conf.MaxConns),
 		httphandler.TimeoutHandler(time.Duration(s.conf.Timeout)*time.Millisecond),
 		httphandler.RecoverHandler,
+		httphandler.SheddingHandler(shedder, metrics),
 		httphandler.TrafficHandler(metrics))
 	chain = customize(chain)
 
@@ -61,6 +128,43 @@ func (s *server) bindRoute(router httprouter.Router, metrics *traffic.Metrics, r
 	return router.Handle(route.Method, route.Path, handle)
 }
 
+// bindRoutes binds the added routes, and the liveness and readiness endpoints
+// if their paths are not taken by the added routes.
+func (s *server) bindRoutes(router httprouter.Router) error {
+	if err := s.bindHealthRoute(router, livenessPath, s.handleLiveness); err != nil {
+		return err
+	}
+	if err := s.bindHealthRoute(router, readinessPath, s.handleReadiness); err != nil {
+		return err
+	}
+
+	// guarded by the lock, because it's read by the shutdown, which might run on the signals
+	metrics := s.createMetrics()
+	s.lock.Lock()
+	s.metrics = metrics
+	s.lock.Unlock()
+	for _, fr := range s.routes {
+		if err := s.bindFeaturedRoutes(router, fr, metrics); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *server) bindHealthRoute(router httprouter.Router, path string, handle http.HandlerFunc) error {
+	for _, fr := range s.routes {
+		for _, route := range fr.routes {
+			if route.Method == http.MethodGet && route.Path == path {
+				logx.Infof("built-in health route %s is skipped, it's taken by the added routes", path)
+				return nil
+			}
+		}
+	}
+
+	return router.Handle(http.MethodGet, path, handle)
+}
+
 func (s *server) createMetrics() *traffic.Metrics {
 	var metrics *traffic.Metrics
 
@@ -73,6 +177,42 @@ func (s *server) createMetrics() *traffic.Metrics {
 	return metrics
 }
 
+// customizeChain returns the per group handlers that wrap the routes in fr,
+// they are appended after the common handlers and before the middlewares.
+func (s *server) customizeChain(fr featuredRoutes, metrics *traffic.Metrics) func(chain alice.Chain) alice.Chain {
+	return func(chain alice.Chain) alice.Chain {
+		if fr.signature.enabled {
+			chain = chain.Append(httphandler.ContentSecurityHandler(fr.signature.decrypters,
+				fr.signature.Strict))
+		}
+		if fr.jwt.enabled {
+			chain = chain.Append(httphandler.Authorize(fr.jwt.secret, s.authorizeOptions(fr)...))
+		}
+		// after the authorization, so that the requests can be limited by the jwt claims
+		if fr.limit.limiter != nil {
+			chain = chain.Append(httphandler.LimitHandler(fr.limit.limiter, fr.limit.keyFunc, metrics))
+		}
+
+		return chain
+	}
+}
+
+func (s *server) authorizeOptions(fr featuredRoutes) []httphandler.AuthorizeOption {
+	var opts []httphandler.AuthorizeOption
+
+	if len(fr.jwt.prevSecret) > 0 {
+		opts = append(opts, httphandler.WithPrevSecret(fr.jwt.prevSecret))
+	}
+	if s.unauthorizedBody != nil {
+		opts = append(opts, httphandler.WithUnauthorizedBody(s.unauthorizedBody))
+	}
+	if s.unauthorizedCallback != nil {
+		opts = append(opts, httphandler.WithUnauthorizedCallback(s.unauthorizedCallback))
+	}
+
+	return opts
+}
+
 func (s *server) getLogHandler() func(http.Handler) http.Handler {
 	if s.conf.Verbose {
 		return httphandler.DetailedLogHandler
@@ -81,10 +221,105 @@ func (s *server) getLogHandler() func(http.Handler) http.Handler {
 	}
 }
 
+func (s *server) serve(handler http.Handler) error {
+	if len(s.conf.CertFile) == 0 && len(s.conf.KeyFile) == 0 {
+		return s.startServer(httpserver.NewHttpServer(s.conf.Host, s.conf.Port, handler))
+	}
+
+	if len(s.conf.CertFile) == 0 || len(s.conf.KeyFile) == 0 {
+		return ErrCertConfig
+	}
+
+	if s.conf.HttpsPort <= 0 {
+		httpsServer, err := s.newHttpsServer(s.conf.Port, handler)
+		if err != nil {
+			return err
+		}
+
+		return s.startServer(httpsServer)
+	}
+
+	httpsServer, err := s.newHttpsServer(s.conf.HttpsPort, handler)
+	if err != nil {
+		return err
+	}
+
+	// serves http and https side by side, returns on the first listener stopped.
+	errs := make(chan error, 2)
+	threading.GoSafe(func() {
+		errs <- s.startServer(httpserver.NewHttpServer(s.conf.Host, s.conf.Port, handler))
+	})
+	threading.GoSafe(func() {
+		errs <- s.startServer(httpsServer)
+	})
+
+	return <-errs
+}
+
+func (s *server) newHttpsServer(port int, handler http.Handler) (*http.Server, error) {
+	return httpserver.NewHttpsServer(s.conf.Host, port, s.conf.CertFile, s.conf.KeyFile,
+		s.conf.ClientCAFile, handler)
+}
+
 func (s *server) use(middleware Middleware) {
 	s.middlewares = append(s.middlewares, middleware)
 }
 
+// findDecrypters returns the decrypters loaded from the private keys of c.
+func (s *server) findDecrypters(c SignatureConf) (map[string]codec.RsaDecrypter, bool) {
+	for _, signature := range s.signatures {
+		if reflect.DeepEqual(signature.privateKeys, c.PrivateKeys) {
+			return signature.decrypters, true
+		}
+	}
+
+	return nil, false
+}
+
+// loadSignature loads the decrypters of c if not loaded.
+func (s *server) loadSignature(c SignatureConf) error {
+	if _, ok := s.findDecrypters(c); ok {
+		return nil
+	}
+
+	decrypters, err := newDecrypters(c)
+	if err != nil {
+		return err
+	}
+
+	s.signatures = append(s.signatures, loadedSignature{
+		privateKeys: c.PrivateKeys,
+		decrypters:  decrypters,
+	})
+	return nil
+}
+
+func newDecrypters(c SignatureConf) (map[string]codec.RsaDecrypter, error) {
+	if len(c.PrivateKeys) == 0 {
+		logx.Error("no private keys configured for signature")
+		return nil, ErrSignatureConfig
+	}
+
+	decrypters := make(map[string]codec.RsaDecrypter)
+	for _, key := range c.PrivateKeys {
+		if len(key.Fingerprint) == 0 || len(key.KeyFile) == 0 {
+			logx.Errorf("fingerprint and key file are required for signature, fingerprint: %q, key file: %q",
+				key.Fingerprint, key.KeyFile)
+			return nil, ErrSignatureConfig
+		}
+
+		decrypter, err := codec.NewRsaDecrypter(key.KeyFile)
+		if err != nil {
+			logx.Errorf("failed to load private key %s, error: %s", key.KeyFile, err.Error())
+			return nil, ErrSignatureConfig
+		}
+
+		decrypters[key.Fingerprint] = decrypter
+	}
+
+	return decrypters, nil
+}
+
 func convertMiddleware(ware Middleware) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(ware(next.ServeHTTP))
@@ -0,0 +1,308 @@
+package cuter
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/vsaien/cuter/common/utils"
+	"github.com/vsaien/cuter/lib/httphandler"
+	"github.com/vsaien/cuter/lib/httprouter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerBindRoutes(t *testing.T) {
+	var paths []string
+	srv := newServer(ServerConfig{Host: "localhost", Port: 8888})
+	srv.use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "passed")
+			next(w, r)
+		}
+	})
+	for _, path := range []string{"/a", "/b/:name"} {
+		srv.AddRoutes(featuredRoutes{
+			routes: []Route{
+				{
+					Method: http.MethodGet,
+					Path:   path,
+					Handler: func(w http.ResponseWriter, r *http.Request) {
+						paths = append(paths, r.URL.Path)
+					},
+				},
+			},
+		})
+	}
+
+	router := httprouter.NewPatRouter()
+	assert.Nil(t, srv.bindRoutes(router))
+
+	for _, path := range []string{"/a", "/b/anything"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "passed", w.Header().Get("X-Middleware"))
+	}
+	assert.EqualValues(t, []string{"/a", "/b/anything"}, paths)
+}
+
+func TestServerBindRoutesErrors(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	tests := []struct {
+		routes []Route
+		err    error
+	}{
+		{
+			routes: []Route{
+				{Method: "FAKE", Path: "/a", Handler: handler},
+			},
+			err: httprouter.ErrInvalidMethod,
+		},
+		{
+			routes: []Route{
+				{Method: http.MethodGet, Path: "a", Handler: handler},
+			},
+			err: httprouter.ErrInvalidPath,
+		},
+		{
+			routes: []Route{
+				{Method: http.MethodGet, Path: "/a", Handler: handler},
+				{Method: http.MethodGet, Path: "/a/", Handler: handler},
+			},
+			err: httprouter.ErrDupItem,
+		},
+	}
+
+	for _, test := range tests {
+		srv := newServer(ServerConfig{})
+		srv.AddRoutes(featuredRoutes{
+			routes: test.routes,
+		})
+		assert.Equal(t, test.err, srv.bindRoutes(httprouter.NewPatRouter()))
+	}
+}
+
+func TestEngineRoutes(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	engine := &Engine{
+		srv: newServer(ServerConfig{}),
+	}
+	engine.AddRoutes([]Route{
+		{Method: http.MethodGet, Path: "/a", Handler: handler},
+		{Method: http.MethodPost, Path: "/b", Handler: handler},
+	})
+	engine.AddRoute(Route{Method: http.MethodPut, Path: "/c", Handler: handler})
+
+	routes := engine.Routes()
+	assert.Equal(t, 3, len(routes))
+	for i, expect := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/a"},
+		{http.MethodPost, "/b"},
+		{http.MethodPut, "/c"},
+	} {
+		assert.Equal(t, expect.method, routes[i].Method)
+		assert.Equal(t, expect.path, routes[i].Path)
+	}
+}
+
+func TestServerBindJwtRoutes(t *testing.T) {
+	srv := newServer(ServerConfig{})
+	srv.unauthorizedBody = map[string]string{"msg": "denied"}
+	srv.AddRoutes(featuredRoutes{
+		routes: []Route{
+			{
+				Method: http.MethodGet,
+				Path:   "/secured",
+				Handler: func(w http.ResponseWriter, r *http.Request) {
+					t.Fatal("should not be called")
+				},
+			},
+		},
+	})
+	WithJwt("abcdefghijklmn")(&srv.routes[0])
+
+	router := httprouter.NewPatRouter()
+	assert.Nil(t, srv.bindRoutes(router))
+
+	r := httptest.NewRequest(http.MethodGet, "/secured", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `{"msg":"denied"}`, w.Body.String())
+}
+
+func TestWithJwtShortSecret(t *testing.T) {
+	assert.Panics(t, func() {
+		WithJwt("short")(new(featuredRoutes))
+	})
+}
+
+func TestServerBindSignatureRoutes(t *testing.T) {
+	keyFile := createPrivateKeyFile(t)
+	defer os.Remove(keyFile)
+
+	signature := SignatureConf{
+		Strict: true,
+		PrivateKeys: []PrivateKeyConf{
+			{Fingerprint: "fingerprint", KeyFile: keyFile},
+		},
+	}
+	srv := newServer(ServerConfig{})
+	assert.Nil(t, srv.loadSignature(signature))
+	fr := featuredRoutes{
+		routes: []Route{
+			{
+				Method: http.MethodGet,
+				Path:   "/signed",
+				Handler: func(w http.ResponseWriter, r *http.Request) {
+					t.Fatal("should not be called")
+				},
+			},
+		},
+	}
+	WithSignature(signature)(&fr)
+	srv.AddRoutes(fr)
+
+	router := httprouter.NewPatRouter()
+	assert.Nil(t, srv.bindRoutes(router))
+
+	r := httptest.NewRequest(http.MethodGet, "/signed", nil)
+	r.Header.Set(httphandler.ContentSecurity, "key=fingerprint; secret=bad; signature=bad")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestNewDecrypters(t *testing.T) {
+	keyFile := createPrivateKeyFile(t)
+	defer os.Remove(keyFile)
+
+	tests := []struct {
+		name string
+		keys []PrivateKeyConf
+		err  error
+	}{
+		{"no keys", nil, ErrSignatureConfig},
+		{"no fingerprint", []PrivateKeyConf{{KeyFile: keyFile}}, ErrSignatureConfig},
+		{"no key file", []PrivateKeyConf{{Fingerprint: "fingerprint"}}, ErrSignatureConfig},
+		{"unreadable key file", []PrivateKeyConf{{Fingerprint: "fingerprint", KeyFile: keyFile + ".none"}},
+			ErrSignatureConfig},
+		{"valid", []PrivateKeyConf{{Fingerprint: "fingerprint", KeyFile: keyFile}}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decrypters, err := newDecrypters(SignatureConf{PrivateKeys: test.keys})
+			assert.Equal(t, test.err, err)
+			if err == nil {
+				assert.Equal(t, len(test.keys), len(decrypters))
+			}
+		})
+	}
+}
+
+func TestNewEngineWithBadSignature(t *testing.T) {
+	var c ServerConfig
+	c.Log.Mode = "console"
+	c.Signature.PrivateKeys = []PrivateKeyConf{
+		{Fingerprint: "fingerprint", KeyFile: "/not/exist.pem"},
+	}
+	_, err := NewEngine(c)
+	assert.Equal(t, ErrSignatureConfig, err)
+}
+
+func TestNewEngineWithBadSignatures(t *testing.T) {
+	keyFile := createPrivateKeyFile(t)
+	defer os.Remove(keyFile)
+
+	var c ServerConfig
+	c.Log.Mode = "console"
+	_, err := NewEngine(c, WithSignatures(SignatureConf{}))
+	assert.Equal(t, ErrSignatureConfig, err)
+	_, err = NewEngine(c, WithSignatures(SignatureConf{
+		PrivateKeys: []PrivateKeyConf{
+			{Fingerprint: "fingerprint", KeyFile: keyFile},
+		},
+	}, SignatureConf{
+		PrivateKeys: []PrivateKeyConf{
+			{Fingerprint: "fingerprint", KeyFile: keyFile + ".none"},
+		},
+	}))
+	assert.Equal(t, ErrSignatureConfig, err)
+}
+
+func TestEngineAddSignatureRoutes(t *testing.T) {
+	keyFile := createPrivateKeyFile(t)
+	defer os.Remove(keyFile)
+
+	var c ServerConfig
+	c.Log.Mode = "console"
+	c.Signature.PrivateKeys = []PrivateKeyConf{
+		{Fingerprint: "fingerprint", KeyFile: keyFile},
+	}
+	other := SignatureConf{
+		PrivateKeys: []PrivateKeyConf{
+			{Fingerprint: "other", KeyFile: keyFile},
+		},
+	}
+	// the same keys are loaded once
+	engine, err := NewEngine(c, WithSignatures(c.Signature, other, other))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(engine.srv.signatures))
+
+	route := Route{
+		Method:  http.MethodGet,
+		Path:    "/signed",
+		Handler: func(w http.ResponseWriter, r *http.Request) {},
+	}
+	engine.AddRoute(route, WithSignature(c.Signature))
+	engine.AddRoute(Route{
+		Method:  http.MethodGet,
+		Path:    "/other",
+		Handler: route.Handler,
+	}, WithSignature(other))
+	assert.Nil(t, engine.srv.bindRoutes(httprouter.NewPatRouter()))
+
+	// the keys not loaded by NewEngine fail the binding
+	engine.AddRoute(Route{
+		Method:  http.MethodGet,
+		Path:    "/unknown",
+		Handler: route.Handler,
+	}, WithSignature(SignatureConf{
+		PrivateKeys: []PrivateKeyConf{
+			{Fingerprint: "unknown", KeyFile: keyFile},
+		},
+	}))
+	assert.Equal(t, ErrSignatureConfig, engine.srv.bindRoutes(httprouter.NewPatRouter()))
+}
+
+func createPrivateKeyFile(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(t, err)
+
+	content := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	filename, err := utils.TempFilenameWithText(string(content))
+	assert.Nil(t, err)
+
+	return filename
+}
+
+func TestServerServeCertConfig(t *testing.T) {
+	srv := newServer(ServerConfig{
+		CertFile: "server.crt",
+	})
+	assert.Equal(t, ErrCertConfig, srv.serve(http.NotFoundHandler()))
+}
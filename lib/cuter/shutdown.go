@@ -0,0 +1,127 @@
+package cuter
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/vsaien/cuter/lib/errorx"
+	"github.com/vsaien/cuter/lib/httpserver"
+	"github.com/vsaien/cuter/lib/httpx"
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/service"
+)
+
+const (
+	livenessPath           = "/healthz"
+	readinessPath          = "/readyz"
+	statusAlive            = "alive"
+	statusDraining         = "draining"
+	defaultShutdownTimeout = time.Second * 5
+)
+
+const (
+	stateServing int32 = iota
+	stateDraining
+)
+
+type liveness struct {
+	Status string            `json:"status"`
+	Build  service.BuildInfo `json:"build"`
+}
+
+func (s *server) draining() bool {
+	return atomic.LoadInt32(&s.state) == stateDraining
+}
+
+func (s *server) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	httpx.OkJson(w, liveness{
+		Status: statusAlive,
+		Build:  service.GetBuildInfo(),
+	})
+}
+
+// handleReadiness reports draining on stopping, otherwise runs the health checks
+// registered in service, and reports the details.
+func (s *server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if s.draining() {
+		httpx.WriteJson(w, http.StatusServiceUnavailable, service.HealthReport{
+			Status: statusDraining,
+		})
+		return
+	}
+
+	report := service.CheckHealth(r.Context())
+	if report.Status == service.StatusServing {
+		httpx.OkJson(w, report)
+	} else {
+		httpx.WriteJson(w, http.StatusServiceUnavailable, report)
+	}
+}
+
+// shutdown drains the server, it's safe to be called multiple times,
+// the later calls wait for the first one to finish, and return the same result.
+func (s *server) shutdown() error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.drain()
+	})
+
+	return s.shutdownErr
+}
+
+// drain flips the readiness to draining, keeps serving for the drain delay, then stops accepting
+// new connections, waits for the in-flight requests up to the shutdown timeout, and flushes the metrics.
+func (s *server) drain() error {
+	s.lock.Lock()
+	atomic.StoreInt32(&s.state, stateDraining)
+	servers := s.httpServers
+	metrics := s.metrics
+	s.lock.Unlock()
+
+	if s.conf.DrainDelay > 0 {
+		delay := time.Duration(s.conf.DrainDelay) * time.Millisecond
+		logx.Infof("Draining, waiting %s for the load balancers to stop sending requests...", delay)
+		time.Sleep(delay)
+	}
+
+	timeout := s.shutdownTimeout()
+	logx.Infof("Draining, waiting for in-flight requests up to %s...", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var be errorx.BatchError
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			logx.Errorf("Failed to drain %s gracefully, force closing, error: %s", srv.Addr, err.Error())
+			srv.Close()
+			be = append(be, err)
+		}
+	}
+
+	if metrics != nil {
+		metrics.Flush()
+	}
+
+	return be.Err()
+}
+
+func (s *server) shutdownTimeout() time.Duration {
+	if s.conf.ShutdownTimeout > 0 {
+		return time.Duration(s.conf.ShutdownTimeout) * time.Millisecond
+	}
+
+	return defaultShutdownTimeout
+}
+
+func (s *server) startServer(srv *http.Server) error {
+	s.lock.Lock()
+	if s.draining() {
+		s.lock.Unlock()
+		return http.ErrServerClosed
+	}
+	s.httpServers = append(s.httpServers, srv)
+	s.lock.Unlock()
+
+	return httpserver.Serve(srv)
+}
@@ -0,0 +1,198 @@
+package cuter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vsaien/cuter/lib/errorx"
+	"github.com/vsaien/cuter/lib/httprouter"
+	"github.com/vsaien/cuter/lib/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv, url := startTestServer(t, ServerConfig{ShutdownTimeout: 1000}, started, release)
+
+	code, body := get(t, url+readinessPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"status":"serving"}`, body)
+
+	done := make(chan string)
+	go func() {
+		_, body := get(t, url+"/slow")
+		done <- body
+	}()
+	<-started
+
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- srv.shutdown()
+	}()
+	for !srv.draining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleReadiness(w, httptest.NewRequest(http.MethodGet, readinessPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"status":"draining"}`, w.Body.String())
+
+	select {
+	case <-shutdownDone:
+		t.Fatal("should wait for the in-flight requests")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(release)
+	assert.Equal(t, "done", <-done)
+	assert.Nil(t, <-shutdownDone)
+
+	_, err := http.Get(url + "/slow")
+	assert.NotNil(t, err)
+	assert.Nil(t, srv.shutdown())
+	assert.Equal(t, http.ErrServerClosed, srv.startServer(&http.Server{}))
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv, url := startTestServer(t, ServerConfig{ShutdownTimeout: 50}, started, release)
+
+	go http.Get(url + "/slow")
+	<-started
+
+	start := time.Now()
+	be, ok := srv.shutdown().(errorx.BatchError)
+	assert.True(t, ok)
+	assert.Equal(t, context.DeadlineExceeded, be[0])
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestServerDrainDelay(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	close(release)
+	srv, url := startTestServer(t, ServerConfig{ShutdownTimeout: 1000, DrainDelay: 100}, started, release)
+
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- srv.shutdown()
+	}()
+	for !srv.draining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// still serving in the drain delay, but reports draining
+	code, _ := get(t, url+readinessPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	code, body := get(t, url+"/slow")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "done", body)
+
+	assert.Nil(t, <-shutdownDone)
+	_, err := http.Get(url + "/slow")
+	assert.NotNil(t, err)
+}
+
+func TestServerShutdownTimeoutDefault(t *testing.T) {
+	assert.Equal(t, defaultShutdownTimeout, newServer(ServerConfig{}).shutdownTimeout())
+	assert.Equal(t, time.Second, newServer(ServerConfig{ShutdownTimeout: 1000}).shutdownTimeout())
+}
+
+func startTestServer(t *testing.T, c ServerConfig, started, release chan struct{}) (*server, string) {
+	srv := newServer(c)
+	srv.AddRoutes(featuredRoutes{
+		routes: []Route{
+			{
+				Method: http.MethodGet,
+				Path:   "/slow",
+				Handler: func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					<-release
+					w.Write([]byte("done"))
+				},
+			},
+		},
+	})
+
+	router := httprouter.NewPatRouter()
+	assert.Nil(t, srv.bindRoutes(router))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	httpServer := &http.Server{Handler: router}
+	srv.httpServers = append(srv.httpServers, httpServer)
+	go httpServer.Serve(listener)
+
+	return srv, "http://" + listener.Addr().String()
+}
+
+func get(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+
+	return resp.StatusCode, string(body)
+}
+
+func TestServerHealthEndpoints(t *testing.T) {
+	srv := newServer(ServerConfig{})
+	router := httprouter.NewPatRouter()
+	assert.Nil(t, srv.bindRoutes(router))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, livenessPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"alive"`)
+
+	service.RegisterHealthCheck("broken", func(ctx context.Context) error {
+		return errors.New("broken")
+	})
+	defer service.UnregisterHealthCheck("broken")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, readinessPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	var report service.HealthReport
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, service.StatusNotServing, report.Status)
+	assert.Equal(t, 1, len(report.Checks))
+	assert.Equal(t, "broken", report.Checks[0].Error)
+}
+
+func TestServerHealthEndpointsTaken(t *testing.T) {
+	srv := newServer(ServerConfig{})
+	srv.AddRoutes(featuredRoutes{
+		routes: []Route{
+			{
+				Method: http.MethodGet,
+				Path:   livenessPath,
+				Handler: func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("custom"))
+				},
+			},
+		},
+	})
+	router := httprouter.NewPatRouter()
+	assert.Nil(t, srv.bindRoutes(router))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, livenessPath, nil))
+	assert.Equal(t, "custom", w.Body.String())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, readinessPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -1,6 +1,13 @@
 package cuter
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/vsaien/cuter/lib/codec"
+	"github.com/vsaien/cuter/lib/httphandler"
+	"github.com/vsaien/cuter/lib/limit"
+	"github.com/vsaien/cuter/lib/load"
+)
 
 type (
 	Route struct {
@@ -8,8 +15,26 @@ type (
 		Path    string
 		Handler http.HandlerFunc
 	}
+	jwtSetting struct {
+		enabled    bool
+		secret     string
+		prevSecret string
+	}
+	signatureSetting struct {
+		SignatureConf
+		enabled    bool
+		decrypters map[string]codec.RsaDecrypter
+	}
+	limitSetting struct {
+		limiter limit.Limiter
+		keyFunc httphandler.LimitKeyFunc
+	}
 	featuredRoutes struct {
-		routes []Route
+		jwt       jwtSetting
+		signature signatureSetting
+		shedder   load.Shedder
+		limit     limitSetting
+		routes    []Route
 	}
 	RouteOption func(r *featuredRoutes)
 )
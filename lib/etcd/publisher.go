@@ -1,6 +1,13 @@
 package etcd
 
 import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
 	"github.com/vsaien/cuter/lib/lang"
 	"github.com/vsaien/cuter/lib/logx"
 	"github.com/vsaien/cuter/lib/syncx"
@@ -8,11 +15,10 @@ import (
 	"github.com/vsaien/cuter/lib/threading"
 
 	"go.etcd.io/etcd/clientv3"
-	"os"
-	"os/signal"
-	"syscall"
 )
 
+var ErrNotPublished = errors.New("etcd key is not published")
+
 type (
 	PublisherOption func(client *Publisher)
 
@@ -26,6 +32,7 @@ type (
 		quit       *syncx.DoneChan
 		pauseChan  chan lang.PlaceholderType
 		resumeChan chan lang.PlaceholderType
+		alive      int32
 		UserName   string
 		Password   string
 	}
@@ -72,7 +79,22 @@ func (c *Publisher) KeepAlive() error {
 		c.Stop()
 	})
 	c.DeadNotify(cli)
-	return c.keepAliveAsync(cli)
+	if err = c.keepAliveAsync(cli); err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&c.alive, 1)
+	return nil
+}
+
+// HealthCheck returns nil if the key is published and kept alive,
+// it can be registered by service.RegisterHealthCheck.
+func (c *Publisher) HealthCheck(ctx context.Context) error {
+	if atomic.LoadInt32(&c.alive) == 0 {
+		return ErrNotPublished
+	}
+
+	return nil
 }
 
 func (c *Publisher) Pause() {
@@ -167,6 +189,7 @@ func (c *Publisher) register(client *clientv3.Client) (clientv3.LeaseID, error)
 }
 
 func (c *Publisher) revoke(cli *clientv3.Client) {
+	atomic.StoreInt32(&c.alive, 0)
 	if _, err := cli.Revoke(cli.Ctx(), c.lease); err != nil {
 		logx.Error(err)
 	}
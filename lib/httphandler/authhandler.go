@@ -0,0 +1,151 @@
+package httphandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/vsaien/cuter/lib/httplog"
+	"github.com/vsaien/cuter/lib/httpsecurity"
+	"github.com/vsaien/cuter/lib/httpx"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	jwtAudience  = "aud"
+	jwtExpire    = "exp"
+	jwtId        = "jti"
+	jwtIssueAt   = "iat"
+	jwtIssuer    = "iss"
+	jwtNotBefore = "nbf"
+	jwtSubject   = "sub"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid auth token")
+	ErrNoClaims     = errors.New("no auth params")
+)
+
+type (
+	UnauthorizedCallback func(w http.ResponseWriter, r *http.Request, err error)
+
+	AuthorizeOptions struct {
+		PrevSecret string
+		Body       interface{}
+		Callback   UnauthorizedCallback
+	}
+
+	AuthorizeOption func(opts *AuthorizeOptions)
+)
+
+// Authorize verifies the jwt token in the Authorization header with secret, and the previous
+// secret if given, then puts the claims into the request context with the claim names as keys.
+func Authorize(secret string, opts ...AuthorizeOption) func(http.Handler) http.Handler {
+	var authOpts AuthorizeOptions
+	for _, opt := range opts {
+		opt(&authOpts)
+	}
+
+	parser := httpsecurity.NewTokenParser()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := parser.ParseToken(r, secret, authOpts.PrevSecret)
+			if err != nil {
+				unauthorized(w, r, err, authOpts)
+				return
+			}
+
+			if !token.Valid {
+				unauthorized(w, r, ErrInvalidToken, authOpts)
+				return
+			}
+
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+				unauthorized(w, r, ErrNoClaims, authOpts)
+				return
+			}
+
+			ctx := r.Context()
+			for k, v := range claims {
+				switch k {
+				case jwtAudience, jwtExpire, jwtId, jwtIssueAt, jwtIssuer, jwtNotBefore, jwtSubject:
+					// ignore the standard claims
+				default:
+					ctx = context.WithValue(ctx, k, v)
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func WithPrevSecret(secret string) AuthorizeOption {
+	return func(opts *AuthorizeOptions) {
+		opts.PrevSecret = secret
+	}
+}
+
+// WithUnauthorizedBody sets the body that written as json with code 401 on rejection.
+func WithUnauthorizedBody(body interface{}) AuthorizeOption {
+	return func(opts *AuthorizeOptions) {
+		opts.Body = body
+	}
+}
+
+// WithUnauthorizedCallback sets the callback to be called on rejection,
+// if the callback writes the status code, the default response is skipped.
+func WithUnauthorizedCallback(callback UnauthorizedCallback) AuthorizeOption {
+	return func(opts *AuthorizeOptions) {
+		opts.Callback = callback
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, err error, opts AuthorizeOptions) {
+	httplog.Infof(r, "authorize failed: %s", err.Error())
+
+	writer := newGuardedResponseWriter(w)
+	if opts.Callback != nil {
+		opts.Callback(writer, r, err)
+		if writer.wroteHeader {
+			return
+		}
+	}
+
+	if opts.Body != nil {
+		httpx.WriteJson(writer, http.StatusUnauthorized, opts.Body)
+	} else {
+		writer.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+type guardedResponseWriter struct {
+	w           http.ResponseWriter
+	wroteHeader bool
+}
+
+func newGuardedResponseWriter(w http.ResponseWriter) *guardedResponseWriter {
+	return &guardedResponseWriter{
+		w: w,
+	}
+}
+
+func (grw *guardedResponseWriter) Header() http.Header {
+	return grw.w.Header()
+}
+
+func (grw *guardedResponseWriter) Write(bytes []byte) (int, error) {
+	grw.wroteHeader = true
+	return grw.w.Write(bytes)
+}
+
+func (grw *guardedResponseWriter) WriteHeader(code int) {
+	if grw.wroteHeader {
+		return
+	}
+
+	grw.wroteHeader = true
+	grw.w.WriteHeader(code)
+}
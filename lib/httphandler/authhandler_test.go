@@ -0,0 +1,98 @@
+package httphandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vsaien/cuter/lib/contextx"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSecret     = "abcdefghijklmn"
+	testPrevSecret = "nmlkjihgfedcba"
+)
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		opts   []AuthorizeOption
+		code   int
+	}{
+		{"current secret", testSecret, nil, http.StatusOK},
+		{"previous secret", testPrevSecret, []AuthorizeOption{WithPrevSecret(testPrevSecret)}, http.StatusOK},
+		{"unknown secret", testPrevSecret, nil, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := Authorize(testSecret, test.opts...)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var user struct {
+						Name string `ctx:"name"`
+					}
+					assert.Nil(t, contextx.For(r.Context(), &user))
+					assert.Equal(t, "kevin", user.Name)
+				}))
+			r := buildTokenRequest(t, test.secret, jwt.MapClaims{"name": "kevin"})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, test.code, w.Code)
+		})
+	}
+}
+
+func TestAuthorizeNoToken(t *testing.T) {
+	handler := Authorize(testSecret, WithUnauthorizedBody(map[string]string{"msg": "unauthorized"}))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("should not be called")
+		}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `{"msg":"unauthorized"}`, w.Body.String())
+}
+
+func TestAuthorizeCallback(t *testing.T) {
+	var called bool
+	handler := Authorize(testSecret, WithUnauthorizedCallback(
+		func(w http.ResponseWriter, r *http.Request, err error) {
+			called = true
+			assert.NotNil(t, err)
+			w.WriteHeader(http.StatusForbidden)
+		}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("should not be called")
+	}))
+	r := buildTokenRequest(t, testSecret, jwt.MapClaims{
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.True(t, called)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestGuardedResponseWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	writer := newGuardedResponseWriter(w)
+	writer.WriteHeader(http.StatusForbidden)
+	writer.WriteHeader(http.StatusUnauthorized)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.True(t, writer.wroteHeader)
+}
+
+func buildTokenRequest(t *testing.T, secret string, claims jwt.MapClaims) *http.Request {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(secret))
+	assert.Nil(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+tokenString)
+	return r
+}
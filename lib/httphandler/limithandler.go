@@ -0,0 +1,146 @@
+package httphandler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/vsaien/cuter/lib/httplog"
+	"github.com/vsaien/cuter/lib/limit"
+	"github.com/vsaien/cuter/lib/traffic"
+)
+
+// the headers of the forwarded client addresses, X-Forward-For is the one used by httpx
+var forwardedHeaders = []string{"X-Forwarded-For", "X-Forward-For"}
+
+// LimitKeyFunc returns the key that the requests are limited by.
+type LimitKeyFunc func(r *http.Request) string
+
+// LimitHandler rejects the requests with code 429 when limiter reports the quota of
+// the key returned by keyFunc is exceeded.
+func LimitHandler(limiter limit.Limiter, keyFunc LimitKeyFunc,
+	metrics *traffic.Metrics) func(http.Handler) http.Handler {
+	if limiter == nil {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	if keyFunc == nil {
+		keyFunc = LimitByIp
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.Allow(keyFunc(r)) {
+				metrics.AddDrop()
+				httplog.Errorf(r, "Request limited, rejected with code %d", http.StatusTooManyRequests)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LimitByIp limits the requests by the remote addresses of the connections, the forwarded headers
+// are ignored because they can be forged by the clients, use LimitByIpBehindProxies behind proxies.
+func LimitByIp(r *http.Request) string {
+	return hostOf(r.RemoteAddr)
+}
+
+// LimitByIpBehindProxies returns a LimitKeyFunc that limits the requests by the client ips,
+// the forwarded headers are only honored if the requests are from the trusted proxies,
+// which are ips or cidrs, like 10.0.0.1 or 10.0.0.0/8. The client is the last address
+// of the forwarded headers that is not a trusted proxy.
+func LimitByIpBehindProxies(proxies ...string) (LimitKeyFunc, error) {
+	var nets []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+
+	trusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+
+		for _, ipNet := range nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return func(r *http.Request) string {
+		client := hostOf(r.RemoteAddr)
+		if !trusted(client) {
+			return client
+		}
+
+		forwarded := forwardedAddrs(r)
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			client = forwarded[i]
+			if !trusted(client) {
+				break
+			}
+		}
+
+		return client
+	}, nil
+}
+
+// LimitByUserId returns a LimitKeyFunc that limits the requests by the jwt claim of claimName,
+// the requests without the claim are limited by the remote addresses of the connections.
+func LimitByUserId(claimName string) LimitKeyFunc {
+	return func(r *http.Request) string {
+		if val := r.Context().Value(claimName); val != nil {
+			return fmt.Sprint(val)
+		}
+
+		return LimitByIp(r)
+	}
+}
+
+// forwardedAddrs returns the addresses of the forwarded headers, from the client to the last proxy.
+func forwardedAddrs(r *http.Request) []string {
+	var addrs []string
+	for _, header := range forwardedHeaders {
+		for _, value := range r.Header[header] {
+			for _, addr := range strings.Split(value, ",") {
+				if addr = strings.TrimSpace(addr); len(addr) > 0 {
+					addrs = append(addrs, hostOf(addr))
+				}
+			}
+		}
+		if len(addrs) > 0 {
+			break
+		}
+	}
+
+	return addrs
+}
+
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
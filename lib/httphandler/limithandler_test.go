@@ -0,0 +1,87 @@
+package httphandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vsaien/cuter/lib/traffic"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLimiter struct {
+	quota int
+	keys  map[string]int
+}
+
+func (l *mockLimiter) Allow(key string) bool {
+	l.keys[key]++
+	return l.keys[key] <= l.quota
+}
+
+func TestLimitHandler(t *testing.T) {
+	limiter := &mockLimiter{
+		quota: 1,
+		keys:  make(map[string]int),
+	}
+	handler := LimitHandler(limiter, nil, traffic.NewMetrics("limit"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	for _, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, code, resp.Code)
+	}
+	assert.Equal(t, 2, limiter.keys["10.0.0.1"])
+}
+
+func TestLimitByIp(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "10.0.0.1", LimitByIp(req))
+
+	// the forwarded headers can be forged
+	req.Header.Set("X-Forward-For", "10.0.0.2, 10.0.0.3")
+	assert.Equal(t, "10.0.0.1", LimitByIp(req))
+}
+
+func TestLimitByIpBehindProxies(t *testing.T) {
+	_, err := LimitByIpBehindProxies("bad")
+	assert.NotNil(t, err)
+
+	keyFunc, err := LimitByIpBehindProxies("10.0.0.1", "192.168.0.0/16")
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	req.RemoteAddr = "1.1.1.1:1234"
+	req.Header.Set("X-Forwarded-For", "2.2.2.2")
+	// not from the trusted proxies
+	assert.Equal(t, "1.1.1.1", keyFunc(req))
+
+	req.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "2.2.2.2", keyFunc(req))
+	// the forged addresses before the real client are ignored
+	req.Header.Set("X-Forwarded-For", "3.3.3.3, 2.2.2.2, 192.168.1.1")
+	assert.Equal(t, "2.2.2.2", keyFunc(req))
+	req.Header.Del("X-Forwarded-For")
+	req.Header.Set("X-Forward-For", "4.4.4.4")
+	assert.Equal(t, "4.4.4.4", keyFunc(req))
+	req.Header.Del("X-Forward-For")
+	assert.Equal(t, "10.0.0.1", keyFunc(req))
+}
+
+func TestLimitByUserId(t *testing.T) {
+	keyFunc := LimitByUserId("uid")
+	req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "10.0.0.1", keyFunc(req))
+
+	req = req.WithContext(context.WithValue(req.Context(), "uid", 123))
+	assert.Equal(t, "123", keyFunc(req))
+}
@@ -0,0 +1,73 @@
+package httphandler
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/vsaien/cuter/lib/httplog"
+	"github.com/vsaien/cuter/lib/load"
+	"github.com/vsaien/cuter/lib/traffic"
+)
+
+const serviceType = "api"
+
+var (
+	sheddingStat     *load.SheddingStat
+	sheddingStatOnce sync.Once
+)
+
+// SheddingHandler rejects the requests with code 503 when shedder reports the service is overloaded,
+// the adaptive shedders take the in-flight counts and the response times from metrics, so it should be
+// placed before TrafficHandler, to keep the dropped requests out of them. metrics can be nil.
+func SheddingHandler(shedder load.Shedder, metrics *traffic.Metrics) func(http.Handler) http.Handler {
+	if shedder == nil {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	sheddingStatOnce.Do(func() {
+		sheddingStat = load.NewSheddingStat(serviceType)
+	})
+	load.BindMetrics(shedder, metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sheddingStat.IncrementTotal()
+			promise, err := shedder.Allow()
+			if err != nil {
+				if metrics != nil {
+					metrics.AddDrop()
+				}
+				sheddingStat.IncrementDrop()
+				httplog.Errorf(r, "Service overloaded, rejected with code %d", http.StatusServiceUnavailable)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			cw := &codeResponseWriter{
+				ResponseWriter: w,
+				code:           http.StatusOK,
+			}
+			defer func() {
+				if cw.code == http.StatusServiceUnavailable {
+					promise.Fail()
+				} else {
+					sheddingStat.IncrementPass()
+					promise.Pass()
+				}
+			}()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+type codeResponseWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *codeResponseWriter) WriteHeader(code int) {
+	w.ResponseWriter.WriteHeader(code)
+	w.code = code
+}
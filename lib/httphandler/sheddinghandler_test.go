@@ -0,0 +1,75 @@
+package httphandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vsaien/cuter/lib/load"
+	"github.com/vsaien/cuter/lib/traffic"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockShedder struct {
+	allow  bool
+	passed int
+	failed int
+}
+
+func (s *mockShedder) Allow() (load.Promise, error) {
+	if s.allow {
+		return s, nil
+	}
+
+	return nil, load.ErrServiceOverloaded
+}
+
+func (s *mockShedder) Pass() {
+	s.passed++
+}
+
+func (s *mockShedder) Fail() {
+	s.failed++
+}
+
+func TestSheddingHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		allow  bool
+		code   int
+		expect int
+		passed int
+		failed int
+	}{
+		{"accepted", true, http.StatusOK, http.StatusOK, 1, 0},
+		{"accepted but unavailable", true, http.StatusServiceUnavailable, http.StatusServiceUnavailable, 0, 1},
+		{"dropped", false, http.StatusOK, http.StatusServiceUnavailable, 0, 0},
+	}
+
+	metrics := traffic.NewMetrics("shedding")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shedder := &mockShedder{allow: test.allow}
+			handler := SheddingHandler(shedder, metrics)(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(test.code)
+				}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, test.expect, w.Code)
+			assert.Equal(t, test.passed, shedder.passed)
+			assert.Equal(t, test.failed, shedder.failed)
+		})
+	}
+}
+
+func TestSheddingHandlerWithoutMetrics(t *testing.T) {
+	handler := SheddingHandler(&mockShedder{}, nil)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("should not be called")
+		}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
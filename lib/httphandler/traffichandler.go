@@ -10,9 +10,10 @@ import (
 func TrafficHandler(metrics *traffic.Metrics) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			metrics.Start()
 			startTime := time.Now()
 			defer func() {
-				metrics.Add(traffic.Task{
+				metrics.Done(traffic.Task{
 					Duration: time.Since(startTime),
 				})
 			}()
@@ -0,0 +1,104 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vsaien/cuter/lib/logx"
+)
+
+const certCheckInterval = time.Second * 10
+
+// certLoader serves the certificate pair from certFile and keyFile,
+// and reloads it when the files are changed on disk.
+type certLoader struct {
+	certFile      string
+	keyFile       string
+	checkInterval time.Duration
+	lastCheck     time.Time
+	certModTime   time.Time
+	keyModTime    time.Time
+	cert          *tls.Certificate
+	lock          sync.Mutex
+}
+
+func newCertLoader(certFile, keyFile string) (*certLoader, error) {
+	loader := &certLoader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		checkInterval: certCheckInterval,
+	}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+
+	return loader, nil
+}
+
+func (cl *certLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	if time.Since(cl.lastCheck) >= cl.checkInterval {
+		cl.reloadIfChanged()
+	}
+
+	return cl.cert, nil
+}
+
+func (cl *certLoader) load() error {
+	certModTime, keyModTime, err := cl.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cl.certFile, cl.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cl.cert = &cert
+	cl.certModTime = certModTime
+	cl.keyModTime = keyModTime
+	cl.lastCheck = time.Now()
+
+	return nil
+}
+
+func (cl *certLoader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(cl.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	keyInfo, err := os.Stat(cl.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+func (cl *certLoader) reloadIfChanged() {
+	cl.lastCheck = time.Now()
+
+	certModTime, keyModTime, err := cl.modTimes()
+	if err != nil {
+		logx.Errorf("failed to stat certificate files, error: %s", err.Error())
+		return
+	}
+
+	if certModTime.Equal(cl.certModTime) && keyModTime.Equal(cl.keyModTime) {
+		return
+	}
+
+	// keep serving the old certificate if failed, the cert file and key file might be
+	// written separately, so it will be retried on next check.
+	if err := cl.load(); err != nil {
+		logx.Errorf("failed to reload certificate %s, error: %s", cl.certFile, err.Error())
+	} else {
+		logx.Infof("certificate %s reloaded", cl.certFile)
+	}
+}
@@ -2,39 +2,84 @@ package httpserver
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 )
 
+var ErrInvalidClientCA = errors.New("no valid certificates in client CA file")
+
 func StartHttp(host string, port int, handler http.Handler) error {
-	addr := fmt.Sprintf("%s:%d", host, port)
-	server := buildHttpServer(addr, handler)
-	return StartServer(server)
+	return StartServer(NewHttpServer(host, port, handler))
 }
 
+// StartHttps starts the https server, the certificate pair is reloaded when changed on disk.
 func StartHttps(host string, port int, certFile, keyFile string, handler http.Handler) error {
-	addr := fmt.Sprintf("%s:%d", host, port)
-	if server, err := buildHttpsServer(addr, handler, certFile, keyFile); err != nil {
+	return StartMutualHttps(host, port, certFile, keyFile, "", handler)
+}
+
+// StartMutualHttps starts the https server like StartHttps, and if caFile is not empty,
+// the client certificates are required and verified with the CAs in caFile.
+func StartMutualHttps(host string, port int, certFile, keyFile, caFile string, handler http.Handler) error {
+	if server, err := NewHttpsServer(host, port, certFile, keyFile, caFile, handler); err != nil {
 		return err
 	} else {
 		return StartServer(server)
 	}
 }
 
+// NewHttpServer returns the http server, which can be started by Serve or StartServer.
+func NewHttpServer(host string, port int, handler http.Handler) *http.Server {
+	return buildHttpServer(fmt.Sprintf("%s:%d", host, port), handler)
+}
+
+// NewHttpsServer returns the https server, which can be started by Serve or StartServer.
+// If caFile is not empty, the client certificates are required and verified with the CAs in caFile.
+func NewHttpsServer(host string, port int, certFile, keyFile, caFile string,
+	handler http.Handler) (*http.Server, error) {
+	return buildHttpsServer(fmt.Sprintf("%s:%d", host, port), handler, certFile, keyFile, caFile)
+}
+
 func buildHttpServer(addr string, handler http.Handler) *http.Server {
 	return &http.Server{Addr: addr, Handler: handler}
 }
 
-func buildHttpsServer(addr string, handler http.Handler, certFile, keyFile string) (*http.Server, error) {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+func buildHttpsServer(addr string, handler http.Handler, certFile, keyFile, caFile string) (*http.Server, error) {
+	loader, err := newCertLoader(certFile, keyFile)
 	if err != nil {
 		return nil, err
 	}
 
-	config := tls.Config{Certificates: []tls.Certificate{cert}}
+	config := tls.Config{GetCertificate: loader.GetCertificate}
+	if len(caFile) > 0 {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
 	return &http.Server{
 		Addr:      addr,
 		Handler:   handler,
 		TLSConfig: &config,
 	}, nil
 }
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, ErrInvalidClientCA
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,179 @@
+package httpserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *rsa.PrivateKey
+	certPem []byte
+	keyPem  []byte
+}
+
+func TestCertLoaderReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certloader")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	first := createCert(t, "first", nil)
+	writeCert(t, first, certFile, keyFile)
+
+	loader, err := newCertLoader(certFile, keyFile)
+	assert.Nil(t, err)
+	cert, err := loader.GetCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, first.cert.Raw, cert.Certificate[0])
+
+	second := createCert(t, "second", nil)
+	writeCert(t, second, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(certFile, future, future))
+	assert.Nil(t, os.Chtimes(keyFile, future, future))
+
+	// not reloaded before next check
+	cert, err = loader.GetCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, first.cert.Raw, cert.Certificate[0])
+
+	loader.checkInterval = 0
+	cert, err = loader.GetCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, second.cert.Raw, cert.Certificate[0])
+
+	// keep the old certificate on bad files
+	assert.Nil(t, ioutil.WriteFile(keyFile, []byte("bad key"), 0600))
+	assert.Nil(t, os.Chtimes(keyFile, future.Add(time.Minute), future.Add(time.Minute)))
+	cert, err = loader.GetCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, second.cert.Raw, cert.Certificate[0])
+}
+
+func TestNewCertLoaderError(t *testing.T) {
+	_, err := newCertLoader("/not/exist.crt", "/not/exist.key")
+	assert.NotNil(t, err)
+}
+
+func TestMutualHttps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mutualhttps")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := createCert(t, "ca", nil)
+	caFile := filepath.Join(dir, "ca.crt")
+	assert.Nil(t, ioutil.WriteFile(caFile, ca.certPem, 0600))
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	writeCert(t, createCert(t, "server", ca), certFile, keyFile)
+	client := createCert(t, "client", ca)
+
+	srv, err := buildHttpsServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}), certFile, keyFile, caFile)
+	assert.Nil(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go srv.ServeTLS(listener, "", "")
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	url := "https://" + listener.Addr().String()
+
+	// without client certificate
+	_, err = newHttpsClient(roots, nil).Get(url)
+	assert.NotNil(t, err)
+
+	clientCert, err := tls.X509KeyPair(client.certPem, client.keyPem)
+	assert.Nil(t, err)
+	resp, err := newHttpsClient(roots, []tls.Certificate{clientCert}).Get(url)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "client", string(body))
+}
+
+func TestLoadCertPoolError(t *testing.T) {
+	file, err := ioutil.TempFile("", "ca")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	file.Close()
+
+	_, err = loadCertPool(file.Name())
+	assert.Equal(t, ErrInvalidClientCA, err)
+}
+
+func createCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signerCert, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPem: pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		}),
+	}
+}
+
+func newHttpsClient(roots *x509.CertPool, certs []tls.Certificate) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:      roots,
+				Certificates: certs,
+			},
+		},
+	}
+}
+
+func writeCert(t *testing.T, cert *testCert, certFile, keyFile string) {
+	assert.Nil(t, ioutil.WriteFile(certFile, cert.certPem, 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, cert.keyPem, 0600))
+}
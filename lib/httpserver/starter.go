@@ -7,10 +7,22 @@ import (
 	"github.com/vsaien/cuter/lib/system"
 )
 
+// StartServer starts srv, and shuts it down on wrapping up.
 func StartServer(srv *http.Server) error {
 	system.AddWrapUpListener(func() {
 		srv.Shutdown(context.Background())
 	})
 
-	return srv.ListenAndServe()
+	return Serve(srv)
+}
+
+// Serve starts srv without shutting it down on wrapping up,
+// the caller is responsible for shutting it down.
+func Serve(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		// the certificates are provided by TLSConfig
+		return srv.ListenAndServeTLS("", "")
+	} else {
+		return srv.ListenAndServe()
+	}
 }
@@ -0,0 +1,11 @@
+package limit
+
+import "errors"
+
+var ErrUnknownCode = errors.New("unknown status code")
+
+// Limiter is implemented by PeriodLimit and TokenLimiter, used by the http and rpc limiting middlewares.
+type Limiter interface {
+	// Allow reports whether the request identified by key is allowed.
+	Allow(key string) bool
+}
@@ -0,0 +1,60 @@
+package limit
+
+import (
+	"sync"
+	"time"
+)
+
+// localStore keeps the in-process limiting states by key, the states that are not
+// touched in their periods are swept on the later calls.
+type localStore struct {
+	lock      sync.Mutex
+	items     map[string]*localItem
+	lastSweep time.Time
+}
+
+type localItem struct {
+	val     interface{}
+	touched time.Time
+	period  time.Duration
+}
+
+func newLocalStore() *localStore {
+	return &localStore{
+		items:     make(map[string]*localItem),
+		lastSweep: time.Now(),
+	}
+}
+
+// take calls fn with the state of key under lock, the state is created by create if absent.
+func (s *localStore) take(key string, period time.Duration, create func() interface{},
+	fn func(val interface{})) {
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if now.Sub(s.lastSweep) >= period {
+		s.sweep(now)
+	}
+
+	item, ok := s.items[key]
+	if !ok {
+		item = &localItem{
+			val:    create(),
+			period: period,
+		}
+		s.items[key] = item
+	}
+	item.touched = now
+	fn(item.val)
+}
+
+func (s *localStore) sweep(now time.Time) {
+	for key, item := range s.items {
+		if now.Sub(item.touched) >= item.period {
+			delete(s.items, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,224 @@
+package limit
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/stores/redis"
+)
+
+const (
+	// to be compatible with aliyun redis, we cannot use `local key = KEYS[1]` to reuse the key
+	periodScript = `local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local current = redis.call("INCRBY", KEYS[1], 1)
+if current == 1 then
+    redis.call("expire", KEYS[1], window)
+end
+if current < limit then
+    return 1
+elseif current == limit then
+    return 2
+else
+    return 0
+end`
+	// the rejected requests are not recorded, so that the clients retrying aggressively
+	// won't be blocked forever.
+	slidingScript = `local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], 0, now - window)
+local current = redis.call("ZCARD", KEYS[1])
+if current >= limit then
+    return 0
+end
+redis.call("ZADD", KEYS[1], now, ARGV[4])
+redis.call("PEXPIRE", KEYS[1], window)
+if current + 1 == limit then
+    return 2
+else
+    return 1
+end`
+)
+
+const (
+	Unknown = iota
+	Allowed
+	HitQuota
+	OverQuota
+
+	internalOverQuota = 0
+	internalAllowed   = 1
+	internalHitQuota  = 2
+)
+
+type (
+	PeriodOption func(l *PeriodLimit)
+
+	// PeriodLimit limits the requests of each key to quota in every period,
+	// in fixed windows by default, or in sliding windows with WithSlidingWindow.
+	PeriodLimit struct {
+		period     int
+		quota      int
+		limitStore *redis.Redis
+		keyPrefix  string
+		align      bool
+		location   *time.Location
+		sliding    bool
+		monitor    *redisMonitor
+		local      *localStore
+	}
+
+	localPeriod struct {
+		start time.Time
+		count int
+	}
+)
+
+// NewPeriodLimit returns a PeriodLimit, period is in seconds. If redis is unreachable,
+// the requests are limited in process until redis recovers.
+func NewPeriodLimit(period, quota int, limitStore *redis.Redis, keyPrefix string,
+	opts ...PeriodOption) *PeriodLimit {
+	limiter := &PeriodLimit{
+		period:     period,
+		quota:      quota,
+		limitStore: limitStore,
+		keyPrefix:  keyPrefix,
+		monitor:    newRedisMonitor(limitStore),
+		local:      newLocalStore(),
+	}
+
+	for _, opt := range opts {
+		opt(limiter)
+	}
+
+	return limiter
+}
+
+func (h *PeriodLimit) Allow(key string) bool {
+	code, err := h.Take(key)
+	if err != nil {
+		logx.Error(err)
+		return true
+	}
+
+	return code == Allowed || code == HitQuota
+}
+
+// Take takes a request of key, returns Allowed, HitQuota or OverQuota.
+func (h *PeriodLimit) Take(key string) (int, error) {
+	if !h.monitor.healthy() {
+		return h.takeLocal(key), nil
+	}
+
+	resp, err := h.takeRedis(h.keyPrefix + key)
+	if err != nil {
+		logx.Errorf("fail to use rate limiter: %s, use in-process limiter for rescue", err)
+		h.monitor.markDown()
+		return h.takeLocal(key), nil
+	}
+
+	code, ok := resp.(int64)
+	if !ok {
+		return Unknown, ErrUnknownCode
+	}
+
+	switch code {
+	case internalOverQuota:
+		return OverQuota, nil
+	case internalAllowed:
+		return Allowed, nil
+	case internalHitQuota:
+		return HitQuota, nil
+	default:
+		return Unknown, ErrUnknownCode
+	}
+}
+
+func (h *PeriodLimit) takeRedis(key string) (interface{}, error) {
+	if h.sliding {
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		// the member needs to be unique, even the requests are in the same millisecond
+		member := strconv.FormatInt(now, 10) + "-" + strconv.FormatInt(rand.Int63(), 36)
+		return h.limitStore.EvalCached(slidingScript, []string{key}, []string{
+			strconv.Itoa(h.quota),
+			strconv.Itoa(h.period * 1000),
+			strconv.FormatInt(now, 10),
+			member,
+		})
+	}
+
+	return h.limitStore.EvalCached(periodScript, []string{key}, []string{
+		strconv.Itoa(h.quota),
+		strconv.Itoa(h.calcExpireSeconds()),
+	})
+}
+
+// takeLocal limits the requests in fixed windows in process, which is only for rescue,
+// the quota applies to each process instead of the whole cluster.
+func (h *PeriodLimit) takeLocal(key string) int {
+	period := time.Duration(h.period) * time.Second
+	var code int
+	h.local.take(key, period, func() interface{} {
+		return new(localPeriod)
+	}, func(val interface{}) {
+		lp := val.(*localPeriod)
+		now := time.Now()
+		if now.Sub(lp.start) >= period {
+			lp.start = now
+			lp.count = 0
+		}
+		lp.count++
+
+		switch {
+		case lp.count < h.quota:
+			code = Allowed
+		case lp.count == h.quota:
+			code = HitQuota
+		default:
+			code = OverQuota
+		}
+	})
+
+	return code
+}
+
+func (h *PeriodLimit) calcExpireSeconds() int {
+	if h.align {
+		now := time.Now()
+		unix := now.Unix()
+		if h.location != nil {
+			// the offset of the location at now, which changes with the daylight saving time
+			_, offset := now.In(h.location).Zone()
+			unix += int64(offset)
+		}
+		return h.period - int(unix%int64(h.period))
+	}
+
+	return h.period
+}
+
+// Align aligns the fixed windows to the period in UTC, like a whole day for the period of 86400.
+func Align() PeriodOption {
+	return func(l *PeriodLimit) {
+		l.align = true
+	}
+}
+
+// AlignIn aligns the fixed windows to the period in loc, like a whole local day for the period of 86400.
+func AlignIn(loc *time.Location) PeriodOption {
+	return func(l *PeriodLimit) {
+		l.align = true
+		l.location = loc
+	}
+}
+
+// WithSlidingWindow counts the requests in the sliding window of the last period,
+// which is smoother than the fixed windows, but costs more memory on redis.
+func WithSlidingWindow() PeriodOption {
+	return func(l *PeriodLimit) {
+		l.sliding = true
+	}
+}
@@ -0,0 +1,130 @@
+package limit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/stores/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const unreachableRedis = "localhost:1"
+
+func TestPeriodLimit_TakeLocal(t *testing.T) {
+	const quota = 5
+	l := NewPeriodLimit(10, quota, redis.NewRedis(unreachableRedis, redis.NodeType), "periodlimit:")
+
+	var allowed, hitQuota, overQuota int
+	for i := 0; i < quota*2; i++ {
+		code, err := l.Take("first")
+		assert.Nil(t, err)
+		switch code {
+		case Allowed:
+			allowed++
+		case HitQuota:
+			hitQuota++
+		case OverQuota:
+			overQuota++
+		default:
+			t.Error("unknown status")
+		}
+	}
+
+	assert.Equal(t, quota-1, allowed)
+	assert.Equal(t, 1, hitQuota)
+	assert.Equal(t, quota, overQuota)
+	assert.False(t, l.monitor.healthy())
+	assert.True(t, l.Allow("second"))
+}
+
+func TestPeriodLimit_TakeRedis(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	const quota = 3
+	l := NewPeriodLimit(10, quota, redis.NewRedis(s.Addr(), redis.NodeType), "periodlimit:")
+	var codes []int
+	for i := 0; i < quota+1; i++ {
+		code, err := l.Take("first")
+		assert.Nil(t, err)
+		codes = append(codes, code)
+	}
+	assert.Equal(t, []int{Allowed, Allowed, HitQuota, OverQuota}, codes)
+	assert.True(t, s.TTL("periodlimit:first") > 9*time.Second)
+
+	// the script is loaded again after redis restarted
+	s.FlushScripts()
+	code, err := l.Take("second")
+	assert.Nil(t, err)
+	assert.Equal(t, Allowed, code)
+	assert.True(t, l.monitor.healthy())
+}
+
+func TestPeriodLimit_QuotaOne(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	for _, addr := range []string{s.Addr(), unreachableRedis} {
+		l := NewPeriodLimit(10, 1, redis.NewRedis(addr, redis.NodeType), "periodlimit:")
+		var codes []int
+		for i := 0; i < 2; i++ {
+			code, err := l.Take("first")
+			assert.Nil(t, err)
+			codes = append(codes, code)
+		}
+		assert.Equal(t, []int{HitQuota, OverQuota}, codes, addr)
+	}
+}
+
+func TestPeriodLimit_Sliding(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	l := NewPeriodLimit(1, 2, redis.NewRedis(s.Addr(), redis.NodeType), "periodlimit:",
+		WithSlidingWindow())
+	take := func() int {
+		code, err := l.Take("first")
+		assert.Nil(t, err)
+		return code
+	}
+	assert.Equal(t, Allowed, take())
+	time.Sleep(time.Millisecond * 600)
+	assert.Equal(t, HitQuota, take())
+	// the rejected requests are not recorded
+	assert.Equal(t, OverQuota, take())
+	assert.Equal(t, OverQuota, take())
+
+	// the first request slides out of the window, but the second one is still in it,
+	// which would be allowed twice in fixed windows
+	time.Sleep(time.Millisecond * 600)
+	assert.Equal(t, HitQuota, take())
+	assert.Equal(t, OverQuota, take())
+	assert.True(t, l.monitor.healthy())
+}
+
+func TestPeriodLimit_CalcExpireSeconds(t *testing.T) {
+	l := NewPeriodLimit(10, 1, redis.NewRedis(unreachableRedis, redis.NodeType), "periodlimit:")
+	assert.Equal(t, 10, l.calcExpireSeconds())
+
+	l = NewPeriodLimit(10, 1, redis.NewRedis(unreachableRedis, redis.NodeType), "periodlimit:", Align())
+	seconds := l.calcExpireSeconds()
+	assert.True(t, seconds > 0 && seconds <= 10)
+
+	const day = 86400
+	l = NewPeriodLimit(day, 1, redis.NewRedis(unreachableRedis, redis.NodeType), "periodlimit:", Align())
+	expect := day - int(time.Now().Unix()%day)
+	seconds = l.calcExpireSeconds()
+	assert.True(t, seconds <= expect && seconds >= expect-1)
+
+	// aligned to the midnight of GMT+8
+	l = NewPeriodLimit(day, 1, redis.NewRedis(unreachableRedis, redis.NodeType), "periodlimit:",
+		AlignIn(time.FixedZone("GMT+8", 8*3600)))
+	expect = day - int((time.Now().Unix()+8*3600)%day)
+	seconds = l.calcExpireSeconds()
+	assert.True(t, seconds <= expect && seconds >= expect-1)
+}
@@ -0,0 +1,67 @@
+package limit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/threading"
+)
+
+const pingInterval = time.Millisecond * 100
+
+// redisMonitor tracks whether the redis is reachable, once marked down,
+// it pings the redis in background until the redis recovers.
+type redisMonitor struct {
+	store   *redis.Redis
+	lock    sync.Mutex
+	down    bool
+	started bool
+}
+
+func newRedisMonitor(store *redis.Redis) *redisMonitor {
+	return &redisMonitor{
+		store: store,
+	}
+}
+
+func (m *redisMonitor) healthy() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return !m.down
+}
+
+func (m *redisMonitor) markDown() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.down = true
+	if m.started {
+		return
+	}
+
+	m.started = true
+	threading.GoSafe(m.waitForRedis)
+}
+
+func (m *redisMonitor) waitForRedis() {
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		m.lock.Lock()
+		m.started = false
+		m.lock.Unlock()
+	}()
+
+	for range ticker.C {
+		if m.store.Ping() {
+			m.lock.Lock()
+			m.down = false
+			m.lock.Unlock()
+			logx.Info("redis recovered, rate limiter switches back to redis")
+			return
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package limit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/stores/redis"
+)
+
+const (
+	// KEYS[1] as the tokens key, KEYS[2] as the timestamp key
+	tokenScript = `local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local requested = tonumber(ARGV[4])
+local fill_time = capacity/rate
+-- setex rejects the ttl of 0 if the bucket fills in less than half a second
+local ttl = math.max(1, math.floor(fill_time*2))
+local last_tokens = tonumber(redis.call("get", KEYS[1]))
+if last_tokens == nil then
+    last_tokens = capacity
+end
+local last_refreshed = tonumber(redis.call("get", KEYS[2]))
+if last_refreshed == nil then
+    last_refreshed = 0
+end
+local delta = math.max(0, now-last_refreshed)
+local filled_tokens = math.min(capacity, last_tokens+(delta*rate))
+local allowed = filled_tokens >= requested
+local new_tokens = filled_tokens
+if allowed then
+    new_tokens = filled_tokens - requested
+end
+redis.call("setex", KEYS[1], ttl, new_tokens)
+redis.call("setex", KEYS[2], ttl, now)
+return allowed`
+	tokenFormat     = "{%s}.tokens"
+	timestampFormat = "{%s}.ts"
+)
+
+type (
+	// TokenLimiter limits the requests of each key with a token bucket, the bucket is refilled
+	// with rate tokens per second, and holds at most burst tokens.
+	TokenLimiter struct {
+		rate       int
+		burst      int
+		limitStore *redis.Redis
+		keyPrefix  string
+		monitor    *redisMonitor
+		local      *localStore
+	}
+
+	localBucket struct {
+		tokens    float64
+		refreshed time.Time
+	}
+)
+
+// NewTokenLimiter returns a TokenLimiter. If redis is unreachable,
+// the requests are limited in process until redis recovers.
+func NewTokenLimiter(rate, burst int, limitStore *redis.Redis, keyPrefix string) *TokenLimiter {
+	return &TokenLimiter{
+		rate:       rate,
+		burst:      burst,
+		limitStore: limitStore,
+		keyPrefix:  keyPrefix,
+		monitor:    newRedisMonitor(limitStore),
+		local:      newLocalStore(),
+	}
+}
+
+func (lim *TokenLimiter) Allow(key string) bool {
+	return lim.AllowN(key, time.Now(), 1)
+}
+
+// AllowN reports whether n tokens of key can be taken at now.
+func (lim *TokenLimiter) AllowN(key string, now time.Time, n int) bool {
+	if !lim.monitor.healthy() {
+		return lim.allowLocal(key, now, n)
+	}
+
+	// the keys are in the same hash slot, so that the script works on redis cluster
+	hashKey := lim.keyPrefix + key
+	resp, err := lim.limitStore.EvalCached(tokenScript, []string{
+		fmt.Sprintf(tokenFormat, hashKey),
+		fmt.Sprintf(timestampFormat, hashKey),
+	}, []string{
+		strconv.Itoa(lim.rate),
+		strconv.Itoa(lim.burst),
+		strconv.FormatInt(now.Unix(), 10),
+		strconv.Itoa(n),
+	})
+	// lua boolean false -> redis nil reply
+	if err == redis.Nil {
+		return false
+	} else if err != nil {
+		logx.Errorf("fail to use rate limiter: %s, use in-process limiter for rescue", err)
+		lim.monitor.markDown()
+		return lim.allowLocal(key, now, n)
+	}
+
+	code, ok := resp.(int64)
+	if !ok {
+		logx.Errorf("fail to eval redis script: %v, use in-process limiter for rescue", resp)
+		return lim.allowLocal(key, now, n)
+	}
+
+	// lua boolean true -> redis integer reply with value of 1
+	return code == 1
+}
+
+// allowLocal limits the requests in process, which is only for rescue,
+// the rate and burst apply to each process instead of the whole cluster.
+func (lim *TokenLimiter) allowLocal(key string, now time.Time, n int) bool {
+	fillTime := time.Duration(math.Ceil(float64(lim.burst)/float64(lim.rate))) * time.Second
+	var allowed bool
+	lim.local.take(key, fillTime, func() interface{} {
+		return &localBucket{
+			tokens:    float64(lim.burst),
+			refreshed: now,
+		}
+	}, func(val interface{}) {
+		bucket := val.(*localBucket)
+		if elapsed := now.Sub(bucket.refreshed); elapsed > 0 {
+			bucket.tokens = math.Min(float64(lim.burst), bucket.tokens+elapsed.Seconds()*float64(lim.rate))
+			bucket.refreshed = now
+		}
+
+		if bucket.tokens >= float64(n) {
+			bucket.tokens -= float64(n)
+			allowed = true
+		}
+	})
+
+	return allowed
+}
@@ -0,0 +1,88 @@
+package limit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/stores/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenLimiter_AllowLocal(t *testing.T) {
+	const (
+		rate  = 5
+		burst = 10
+	)
+	l := NewTokenLimiter(rate, burst, redis.NewRedis(unreachableRedis, redis.NodeType), "tokenlimit:")
+
+	now := time.Now()
+	var allowed int
+	for i := 0; i < burst*2; i++ {
+		if l.AllowN("first", now, 1) {
+			allowed++
+		}
+	}
+	assert.Equal(t, burst, allowed)
+	assert.False(t, l.monitor.healthy())
+
+	// refilled with rate tokens per second
+	now = now.Add(time.Second)
+	allowed = 0
+	for i := 0; i < burst; i++ {
+		if l.AllowN("first", now, 1) {
+			allowed++
+		}
+	}
+	assert.Equal(t, rate, allowed)
+
+	assert.True(t, l.Allow("second"))
+	assert.False(t, l.AllowN("third", now, burst+1))
+}
+
+func TestTokenLimiter_AllowRedis(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	const (
+		rate  = 5
+		burst = 10
+	)
+	l := NewTokenLimiter(rate, burst, redis.NewRedis(s.Addr(), redis.NodeType), "tokenlimit:")
+
+	now := time.Now()
+	var allowed int
+	for i := 0; i < burst*2; i++ {
+		if l.AllowN("first", now, 1) {
+			allowed++
+		}
+	}
+	assert.Equal(t, burst, allowed)
+
+	// the script is loaded again after redis restarted
+	s.FlushScripts()
+	now = now.Add(time.Second)
+	allowed = 0
+	for i := 0; i < burst; i++ {
+		if l.AllowN("first", now, 1) {
+			allowed++
+		}
+	}
+	assert.Equal(t, rate, allowed)
+	assert.False(t, l.AllowN("second", now, burst+1))
+	assert.True(t, l.monitor.healthy())
+}
+
+func TestTokenLimiter_FastFill(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	// filled in less than half a second, the keys still expire in 1 second
+	l := NewTokenLimiter(10, 1, redis.NewRedis(s.Addr(), redis.NodeType), "tokenlimit:")
+	assert.True(t, l.Allow("first"))
+	assert.True(t, l.monitor.healthy())
+	assert.True(t, s.TTL("{tokenlimit:first}.tokens") > 0)
+}
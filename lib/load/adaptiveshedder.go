@@ -0,0 +1,311 @@
+package load
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vsaien/cuter/lib/collection"
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/syncx"
+	"github.com/vsaien/cuter/lib/traffic"
+)
+
+const (
+	defaultBuckets = 50
+	defaultWindow  = time.Second * 5
+	// using 900m cpu as the default threshold, 1000m means 100%
+	defaultCpuThreshold = 900
+	defaultMinRt        = float64(time.Second / time.Millisecond)
+	// the buckets shorter than it can't be measured by the millisecond response times
+	minBucketDuration = time.Millisecond
+	// moving average hyperparameter beta for calculating requests on the fly
+	flyingBeta      = 0.9
+	coolOffDuration = time.Second
+)
+
+var (
+	ErrServiceOverloaded = errors.New("service overloaded")
+
+	// replaced in tests
+	systemOverloadChecker = func(cpuThreshold int64) bool {
+		return CpuUsage() >= cpuThreshold
+	}
+)
+
+type (
+	// Promise is returned by Shedder.Allow, either Pass or Fail should be called
+	// when the request is done.
+	Promise interface {
+		// Pass lets the shedder know the request is handled successfully.
+		Pass()
+		// Fail lets the shedder know the request is failed.
+		Fail()
+	}
+
+	Shedder interface {
+		// Allow returns ErrServiceOverloaded if the request should be dropped.
+		Allow() (Promise, error)
+	}
+
+	ShedderOption func(opts *shedderOptions)
+
+	shedderOptions struct {
+		window       time.Duration
+		buckets      int
+		cpuThreshold int64
+	}
+
+	adaptiveShedder struct {
+		cpuThreshold int64
+		// buckets per second, less than 1 if the buckets are longer than a second
+		windows         float64
+		flying          int64
+		metrics         atomic.Value
+		bindOnce        sync.Once
+		avgFlying       float64
+		avgFlyingLock   syncx.SpinLock
+		dropTime        int64
+		droppedRecently int32
+		passCounter     *collection.RollingWindow
+		rtCounter       *collection.RollingWindow
+	}
+
+	promise struct {
+		start   time.Time
+		shedder *adaptiveShedder
+	}
+)
+
+// NewAdaptiveShedder returns a Shedder that drops the requests when the cpu usage is over
+// the threshold, and the requests on the fly are more than the max throughput measured
+// by the passed requests and the response times in the window.
+func NewAdaptiveShedder(opts ...ShedderOption) Shedder {
+	options := shedderOptions{
+		window:       defaultWindow,
+		buckets:      defaultBuckets,
+		cpuThreshold: defaultCpuThreshold,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.buckets <= 0 || options.window/time.Duration(options.buckets) < minBucketDuration {
+		logx.Errorf("invalid shedder options, buckets: %d, window: %s, using the defaults",
+			options.buckets, options.window)
+		options.buckets = defaultBuckets
+		options.window = defaultWindow
+	}
+
+	bucketDuration := options.window / time.Duration(options.buckets)
+	return &adaptiveShedder{
+		cpuThreshold: options.cpuThreshold,
+		windows:      float64(time.Second) / float64(bucketDuration),
+		passCounter:  newRollingWindow(options.buckets, bucketDuration),
+		rtCounter:    newRollingWindow(options.buckets, bucketDuration),
+	}
+}
+
+func (as *adaptiveShedder) Allow() (Promise, error) {
+	if as.shouldDrop() {
+		atomic.StoreInt64(&as.dropTime, int64(sinceStart()))
+		atomic.StoreInt32(&as.droppedRecently, 1)
+
+		return nil, ErrServiceOverloaded
+	}
+
+	if as.boundMetrics() == nil {
+		as.addFlying(1)
+	}
+
+	return &promise{
+		start:   time.Now(),
+		shedder: as,
+	}, nil
+}
+
+func (as *adaptiveShedder) addFlying(delta int64) {
+	flying := atomic.AddInt64(&as.flying, delta)
+	// update avgFlying when the request is finished.
+	// this strategy makes avgFlying have a little bit lag against flying, and smoother.
+	// when the flying requests increase rapidly, avgFlying increase slower, accept more requests.
+	// when the flying requests drop rapidly, avgFlying drop slower, accept less requests.
+	// it makes the service to serve as more requests as possible.
+	if delta < 0 {
+		as.updateAvgFlying(flying)
+	}
+}
+
+func (as *adaptiveShedder) updateAvgFlying(flying int64) {
+	as.avgFlyingLock.Lock()
+	as.avgFlying = as.avgFlying*flyingBeta + float64(flying)*(1-flyingBeta)
+	as.avgFlyingLock.Unlock()
+}
+
+// bindMetrics makes the shedder take the in-flight counts and the response times from metrics.
+func (as *adaptiveShedder) bindMetrics(metrics *traffic.Metrics) {
+	as.bindOnce.Do(func() {
+		as.metrics.Store(metrics)
+		metrics.AddListener(func(task traffic.Task) {
+			as.rtCounter.Add(math.Ceil(float64(task.Duration) / float64(time.Millisecond)))
+			as.updateAvgFlying(metrics.Flying())
+		})
+	})
+}
+
+func (as *adaptiveShedder) boundMetrics() *traffic.Metrics {
+	metrics, _ := as.metrics.Load().(*traffic.Metrics)
+	return metrics
+}
+
+func (as *adaptiveShedder) currentFlying() int64 {
+	if metrics := as.boundMetrics(); metrics != nil {
+		return metrics.Flying()
+	}
+
+	return atomic.LoadInt64(&as.flying)
+}
+
+func (as *adaptiveShedder) highThru() bool {
+	as.avgFlyingLock.Lock()
+	avgFlying := as.avgFlying
+	as.avgFlyingLock.Unlock()
+	maxFlight := as.maxFlight()
+
+	return int64(avgFlying) > maxFlight && as.currentFlying() > maxFlight
+}
+
+func (as *adaptiveShedder) maxFlight() int64 {
+	// windows = buckets per second
+	// maxQPS = maxPASS * windows
+	// minRT = min average response time in milliseconds
+	// maxQPS * minRT / milliseconds_per_second
+	return int64(math.Max(1, float64(as.maxPass())*as.windows*(as.minRt()/1e3)))
+}
+
+func (as *adaptiveShedder) maxPass() int64 {
+	var result float64 = 1
+
+	as.passCounter.Reduce(func(b *collection.Bucket) {
+		if b.Sum > result {
+			result = b.Sum
+		}
+	})
+
+	return int64(result)
+}
+
+func (as *adaptiveShedder) minRt() float64 {
+	result := defaultMinRt
+
+	as.rtCounter.Reduce(func(b *collection.Bucket) {
+		if b.Count <= 0 {
+			return
+		}
+
+		avg := math.Round(b.Sum / float64(b.Count))
+		if avg < result {
+			result = avg
+		}
+	})
+
+	return result
+}
+
+func (as *adaptiveShedder) shouldDrop() bool {
+	if as.systemOverloaded() || as.stillHot() {
+		if as.highThru() {
+			flying := as.currentFlying()
+			as.avgFlyingLock.Lock()
+			avgFlying := as.avgFlying
+			as.avgFlyingLock.Unlock()
+			logx.Errorf("dropreq, cpu: %d, maxPass: %d, minRt: %.2f, hot: %t, flying: %d, avgFlying: %.2f",
+				CpuUsage(), as.maxPass(), as.minRt(), as.stillHot(), flying, avgFlying)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (as *adaptiveShedder) stillHot() bool {
+	if atomic.LoadInt32(&as.droppedRecently) == 0 {
+		return false
+	}
+
+	dropTime := atomic.LoadInt64(&as.dropTime)
+	if dropTime == 0 {
+		return false
+	}
+
+	hot := sinceStart()-time.Duration(dropTime) < coolOffDuration
+	if !hot {
+		atomic.StoreInt32(&as.droppedRecently, 0)
+	}
+
+	return hot
+}
+
+func (as *adaptiveShedder) systemOverloaded() bool {
+	return systemOverloadChecker(as.cpuThreshold)
+}
+
+// WithBuckets customizes the number of buckets in the window, defaults to 50.
+func WithBuckets(buckets int) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.buckets = buckets
+	}
+}
+
+// WithCpuThreshold customizes the cpu threshold in millicpu, defaults to 900.
+func WithCpuThreshold(threshold int64) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.cpuThreshold = threshold
+	}
+}
+
+// WithWindow customizes the window to measure the throughput, defaults to 5 seconds.
+func WithWindow(window time.Duration) ShedderOption {
+	return func(opts *shedderOptions) {
+		opts.window = window
+	}
+}
+
+// BindMetrics makes shedder take the in-flight counts and the response times of the requests
+// from metrics, instead of measuring them by the promises, the requests should be started and
+// done on metrics after shedder allows them. Only the shedders of NewAdaptiveShedder are bound,
+// and they are bound to the first metrics, the later ones are ignored.
+func BindMetrics(shedder Shedder, metrics *traffic.Metrics) {
+	if as, ok := shedder.(*adaptiveShedder); ok && metrics != nil {
+		as.bindMetrics(metrics)
+	}
+}
+
+func (p *promise) Fail() {
+	if p.shedder.boundMetrics() == nil {
+		p.shedder.addFlying(-1)
+	}
+}
+
+// Pass counts the passed requests, the response times are measured here only if
+// the shedder is not bound to the metrics.
+func (p *promise) Pass() {
+	if p.shedder.boundMetrics() == nil {
+		rt := float64(time.Since(p.start)) / float64(time.Millisecond)
+		p.shedder.addFlying(-1)
+		p.shedder.rtCounter.Add(math.Ceil(rt))
+	}
+	p.shedder.passCounter.Add(1)
+}
+
+// the bucket of the current interval is not reduced, because it's incomplete.
+func newRollingWindow(size int, interval time.Duration) *collection.RollingWindow {
+	return collection.NewRollingWindow(size, interval, collection.IgnoreCurrentBucket())
+}
+
+var startTime = time.Now()
+
+func sinceStart() time.Duration {
+	return time.Since(startTime)
+}
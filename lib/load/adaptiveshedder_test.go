@@ -0,0 +1,220 @@
+package load
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vsaien/cuter/lib/traffic"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	buckets        = 10
+	bucketDuration = time.Millisecond * 50
+)
+
+func TestAdaptiveShedder(t *testing.T) {
+	shedder := NewAdaptiveShedder(WithWindow(bucketDuration), WithBuckets(buckets), WithCpuThreshold(100))
+	var wg sync.WaitGroup
+	var drop int64
+	proba := 5
+	var lock sync.Mutex
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 30; i++ {
+				promise, err := shedder.Allow()
+				if err != nil {
+					lock.Lock()
+					drop++
+					lock.Unlock()
+				} else {
+					time.Sleep(time.Millisecond * 5)
+					if rand.Intn(100) < proba {
+						promise.Fail()
+					} else {
+						promise.Pass()
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAdaptiveShedderMaxPass(t *testing.T) {
+	passCounter := newRollingWindow(buckets, bucketDuration)
+	for i := 1; i <= 10; i++ {
+		passCounter.Add(float64(i * 100))
+		time.Sleep(bucketDuration)
+	}
+	shedder := &adaptiveShedder{
+		passCounter: passCounter,
+	}
+	assert.Equal(t, int64(1000), shedder.maxPass())
+
+	// default max pass is equal to 1.
+	passCounter = newRollingWindow(buckets, bucketDuration)
+	shedder = &adaptiveShedder{
+		passCounter: passCounter,
+	}
+	assert.Equal(t, int64(1), shedder.maxPass())
+}
+
+func TestAdaptiveShedderMinRt(t *testing.T) {
+	rtCounter := newRollingWindow(buckets, bucketDuration)
+	for i := 0; i < 10; i++ {
+		if i > 0 {
+			time.Sleep(bucketDuration)
+		}
+		for j := i*10 + 1; j <= i*10+10; j++ {
+			rtCounter.Add(float64(j))
+		}
+	}
+	shedder := &adaptiveShedder{
+		rtCounter: rtCounter,
+	}
+	assert.Equal(t, float64(6), shedder.minRt())
+
+	// default min rt is 1 second.
+	rtCounter = newRollingWindow(buckets, bucketDuration)
+	shedder = &adaptiveShedder{
+		rtCounter: rtCounter,
+	}
+	assert.Equal(t, defaultMinRt, shedder.minRt())
+}
+
+func TestAdaptiveShedderMaxFlight(t *testing.T) {
+	passCounter := newRollingWindow(buckets, bucketDuration)
+	rtCounter := newRollingWindow(buckets, bucketDuration)
+	for i := 0; i < 10; i++ {
+		if i > 0 {
+			time.Sleep(bucketDuration)
+		}
+		passCounter.Add(float64((i + 1) * 100))
+		for j := i*10 + 1; j <= i*10+10; j++ {
+			rtCounter.Add(float64(j))
+		}
+	}
+	shedder := &adaptiveShedder{
+		passCounter: passCounter,
+		rtCounter:   rtCounter,
+		windows:     buckets,
+	}
+	assert.Equal(t, int64(54), shedder.maxFlight())
+}
+
+func TestAdaptiveShedderShouldDrop(t *testing.T) {
+	passCounter := newRollingWindow(buckets, bucketDuration)
+	rtCounter := newRollingWindow(buckets, bucketDuration)
+	for i := 0; i < 10; i++ {
+		if i > 0 {
+			time.Sleep(bucketDuration)
+		}
+		passCounter.Add(float64((i + 1) * 100))
+		for j := i*10 + 1; j <= i*10+10; j++ {
+			rtCounter.Add(float64(j))
+		}
+	}
+	shedder := &adaptiveShedder{
+		passCounter: passCounter,
+		rtCounter:   rtCounter,
+		windows:     buckets,
+	}
+
+	// cpu >=  800, inflight < maxPass
+	systemOverloadChecker = func(int64) bool {
+		return true
+	}
+	defer func() {
+		systemOverloadChecker = func(cpuThreshold int64) bool {
+			return CpuUsage() >= cpuThreshold
+		}
+	}()
+	shedder.avgFlying = 50
+	assert.False(t, shedder.shouldDrop())
+
+	// cpu >=  800, inflight > maxPass
+	shedder.avgFlying = 80
+	shedder.flying = 50
+	assert.False(t, shedder.shouldDrop())
+
+	// cpu >=  800, inflight > maxPass
+	shedder.avgFlying = 80
+	shedder.flying = 80
+	assert.True(t, shedder.shouldDrop())
+
+	// cpu < 800, inflight > maxPass
+	systemOverloadChecker = func(int64) bool {
+		return false
+	}
+	shedder.avgFlying = 80
+	assert.False(t, shedder.shouldDrop())
+
+	// still hot after dropped recently
+	shedder.dropTime = int64(sinceStart())
+	shedder.droppedRecently = 1
+	assert.True(t, shedder.shouldDrop())
+}
+
+func BenchmarkAdaptiveShedderAllow(b *testing.B) {
+	shedder := NewAdaptiveShedder()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		promise, err := shedder.Allow()
+		if err == nil {
+			promise.Pass()
+		}
+	}
+}
+
+func TestNewAdaptiveShedderOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ShedderOption
+		windows float64
+	}{
+		{"defaults", nil, 10},
+		{"zero buckets", []ShedderOption{WithBuckets(0)}, 10},
+		{"buckets more than window", []ShedderOption{WithWindow(time.Millisecond), WithBuckets(10)}, 10},
+		{"buckets longer than a second", []ShedderOption{WithWindow(time.Second * 10), WithBuckets(5)}, 0.5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shedder := NewAdaptiveShedder(test.opts...).(*adaptiveShedder)
+			assert.Equal(t, test.windows, shedder.windows)
+			assert.True(t, shedder.maxFlight() >= 1)
+		})
+	}
+}
+
+func TestAdaptiveShedderBindMetrics(t *testing.T) {
+	metrics := traffic.NewMetrics("shedding")
+	shedder := NewAdaptiveShedder(WithWindow(time.Second), WithBuckets(buckets)).(*adaptiveShedder)
+	BindMetrics(shedder, metrics)
+	// bound to the first metrics only
+	BindMetrics(shedder, traffic.NewMetrics("other"))
+	assert.Equal(t, metrics, shedder.boundMetrics())
+
+	promise, err := shedder.Allow()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), shedder.currentFlying())
+	metrics.Start()
+	metrics.Start()
+	assert.Equal(t, int64(2), shedder.currentFlying())
+	metrics.Done(traffic.Task{Duration: time.Millisecond * 20})
+	promise.Pass()
+	assert.Equal(t, int64(1), shedder.currentFlying())
+	assert.Equal(t, int64(0), atomic.LoadInt64(&shedder.flying))
+
+	// the current bucket is ignored
+	time.Sleep(time.Second / buckets)
+	assert.Equal(t, float64(20), shedder.minRt())
+	assert.Equal(t, int64(1), shedder.maxPass())
+}
@@ -0,0 +1,166 @@
+// +build linux
+
+package load
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultCgroupFiles = cgroupFiles{
+		cpuStat:      "/sys/fs/cgroup/cpu.stat",
+		cpuMax:       "/sys/fs/cgroup/cpu.max",
+		cpuacctUsage: "/sys/fs/cgroup/cpuacct/cpuacct.usage",
+		cfsQuota:     "/sys/fs/cgroup/cpu/cpu.cfs_quota_us",
+		cfsPeriod:    "/sys/fs/cgroup/cpu/cpu.cfs_period_us",
+	}
+
+	errNoCpuUsage = errors.New("no usage_usec in cpu.stat")
+)
+
+// cgroupFiles are the files to read the cpu usage and the cpu quota of the cgroup.
+type cgroupFiles struct {
+	// cgroup v2, the unified hierarchy
+	cpuStat string
+	cpuMax  string
+	// cgroup v1
+	cpuacctUsage string
+	cfsQuota     string
+	cfsPeriod    string
+}
+
+// newCgroupCpuReader returns the cpuReader of the cgroup that the process runs in,
+// the busy time is the cpu time used by the cgroup, and the total time is the elapsed time
+// multiplied by the cpus of the cgroup, which are limited by the cpu quota if set.
+func newCgroupCpuReader(files cgroupFiles) (cpuReader, error) {
+	readUsage := files.readV2Usage
+	readCpus := files.readV2Cpus
+	if _, err := readUsage(); err != nil {
+		readUsage = files.readV1Usage
+		readCpus = files.readV1Cpus
+		if _, err := readUsage(); err != nil {
+			return nil, err
+		}
+	}
+
+	cpus, err := readCpus()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	return func() (busy, total uint64, err error) {
+		usage, err := readUsage()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return usage, uint64(float64(time.Since(start)) * cpus), nil
+	}, nil
+}
+
+// readV2Usage reads the cpu time used by the cgroup in nanoseconds.
+func (f cgroupFiles) readV2Usage() (uint64, error) {
+	content, err := ioutil.ReadFile(f.cpuStat)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			usec, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+
+			return usec * uint64(time.Microsecond), nil
+		}
+	}
+
+	return 0, errNoCpuUsage
+}
+
+// readV2Cpus reads the cpus of the cgroup from cpu.max, like "max 100000" or "50000 100000".
+func (f cgroupFiles) readV2Cpus() (float64, error) {
+	content, err := readFirstLine(f.cpuMax)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(content)
+	if len(fields) != 2 || fields[0] == "max" {
+		return limitCpus(-1, 0), nil
+	}
+
+	quota, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	period, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return limitCpus(quota, period), nil
+}
+
+// readV1Usage reads the cpu time used by the cgroup in nanoseconds.
+func (f cgroupFiles) readV1Usage() (uint64, error) {
+	content, err := readFirstLine(f.cpuacctUsage)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(content, 10, 64)
+}
+
+// readV1Cpus reads the cpus of the cgroup from the cfs quota and period, -1 quota means no limit.
+func (f cgroupFiles) readV1Cpus() (float64, error) {
+	content, err := readFirstLine(f.cfsQuota)
+	if err != nil {
+		// the cpu controller might not be mounted, no limit then
+		return limitCpus(-1, 0), nil
+	}
+	quota, err := strconv.ParseInt(content, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	content, err = readFirstLine(f.cfsPeriod)
+	if err != nil {
+		return 0, err
+	}
+	period, err := strconv.ParseInt(content, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return limitCpus(quota, period), nil
+}
+
+// limitCpus returns the cpus limited by quota in period, the cpus that the process can run on
+// if not limited or the limit is more than them.
+func limitCpus(quota, period int64) float64 {
+	cpus := float64(runtime.NumCPU())
+	if quota <= 0 || period <= 0 {
+		return cpus
+	}
+
+	return math.Min(cpus, float64(quota)/float64(period))
+}
+
+func readFirstLine(file string) (string, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(strings.SplitN(string(content), "\n", 2)[0]), nil
+}
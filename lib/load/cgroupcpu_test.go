@@ -0,0 +1,88 @@
+// +build linux
+
+package load
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgroupCpuReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(file, []byte(content), 0644))
+		return file
+	}
+
+	var files cgroupFiles
+	t.Run("v2", func(t *testing.T) {
+		files.cpuStat = write("cpu.stat", "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n")
+		files.cpuMax = write("cpu.max", "50000 100000\n")
+		usage, err := files.readV2Usage()
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1500*time.Microsecond), usage)
+		cpus, err := files.readV2Cpus()
+		assert.Nil(t, err)
+		assert.Equal(t, 0.5, cpus)
+
+		files.cpuMax = write("cpu.max", "max 100000\n")
+		cpus, err = files.readV2Cpus()
+		assert.Nil(t, err)
+		assert.Equal(t, float64(runtime.NumCPU()), cpus)
+
+		reader, err := newCgroupCpuReader(files)
+		assert.Nil(t, err)
+		busy, _, err := reader()
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1500*time.Microsecond), busy)
+	})
+
+	t.Run("v1", func(t *testing.T) {
+		files.cpuStat = filepath.Join(dir, "nonexistent")
+		files.cpuacctUsage = write("cpuacct.usage", "123456789\n")
+		files.cfsQuota = write("cpu.cfs_quota_us", "25000\n")
+		files.cfsPeriod = write("cpu.cfs_period_us", "100000\n")
+		usage, err := files.readV1Usage()
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(123456789), usage)
+		cpus, err := files.readV1Cpus()
+		assert.Nil(t, err)
+		assert.Equal(t, 0.25, cpus)
+
+		files.cfsQuota = write("cpu.cfs_quota_us", "-1\n")
+		cpus, err = files.readV1Cpus()
+		assert.Nil(t, err)
+		assert.Equal(t, float64(runtime.NumCPU()), cpus)
+
+		reader, err := newCgroupCpuReader(files)
+		assert.Nil(t, err)
+		busy, _, err := reader()
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(123456789), busy)
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		files.cpuStat = filepath.Join(dir, "nonexistent")
+		files.cpuacctUsage = filepath.Join(dir, "nonexistent")
+		_, err := newCgroupCpuReader(files)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestMovingUsage(t *testing.T) {
+	assert.Equal(t, int64(25), movingUsage(0, 150, 100, 100))
+	// the busy time decreased
+	assert.Equal(t, int64(95), movingUsage(100, 90, 100, 100))
+	// capped by 1000 millicpu
+	assert.Equal(t, int64(50), movingUsage(0, 300, 100, 100))
+}
@@ -0,0 +1,68 @@
+// +build linux
+
+package load
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const procStat = "/proc/stat"
+
+var errInvalidProcStat = errors.New("invalid content of /proc/stat")
+
+// cpuReader reads the cumulative busy and total cpu times, the usage is the ratio of their deltas.
+type cpuReader func() (busy, total uint64, err error)
+
+// newCpuReader returns the cpuReader of the cgroup that the process runs in, so that the usage
+// is measured against the cpu quota of the containers, falls back to the cpus of the host.
+func newCpuReader() (cpuReader, error) {
+	if reader, err := newCgroupCpuReader(defaultCgroupFiles); err == nil {
+		return reader, nil
+	}
+
+	if _, _, err := readProcStat(); err != nil {
+		return nil, err
+	}
+
+	return readProcStat, nil
+}
+
+// readProcStat reads the busy and total cpu times of all the cpus from /proc/stat.
+func readProcStat() (busy, total uint64, err error) {
+	file, err := os.Open(procStat)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return 0, 0, errInvalidProcStat
+	}
+
+	// cpu  user nice system idle iowait irq softirq steal guest guest_nice
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, errInvalidProcStat
+	}
+
+	var idle uint64
+	for i, field := range fields[1:] {
+		val, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		total += val
+		// idle and iowait
+		if i == 3 || i == 4 {
+			idle += val
+		}
+	}
+
+	return total - idle, total, nil
+}
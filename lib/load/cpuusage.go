@@ -0,0 +1,67 @@
+package load
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/threading"
+)
+
+const (
+	cpuRefreshInterval = time.Millisecond * 250
+	// moving average, about 5 seconds with cpuRefreshInterval
+	cpuBeta = 0.95
+)
+
+// in millicpu, 1000 means all the cpus are fully used.
+var cpuUsage int64
+
+func init() {
+	threading.GoSafe(func() {
+		readCpu, err := newCpuReader()
+		if err != nil {
+			logx.Errorf("cpu usage is not available, error: %s", err.Error())
+			return
+		}
+		prevBusy, prevTotal, err := readCpu()
+		if err != nil {
+			logx.Errorf("cpu usage is not available, error: %s", err.Error())
+			return
+		}
+
+		ticker := time.NewTicker(cpuRefreshInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			busy, total, err := readCpu()
+			if err != nil {
+				continue
+			}
+
+			if total > prevTotal {
+				atomic.StoreInt64(&cpuUsage, movingUsage(atomic.LoadInt64(&cpuUsage),
+					busy, prevBusy, total-prevTotal))
+			}
+			prevBusy, prevTotal = busy, total
+		}
+	})
+}
+
+// movingUsage returns the moving average of the usage in millicpu, with the busy time
+// in totalDelta, the busy time of /proc/stat might decrease, because iowait is not reliable.
+func movingUsage(prev int64, busy, prevBusy, totalDelta uint64) int64 {
+	var busyDelta uint64
+	if busy > prevBusy {
+		busyDelta = busy - prevBusy
+	}
+	cur := math.Min(1000, float64(busyDelta)*1000/float64(totalDelta))
+
+	return int64(float64(prev)*cpuBeta + cur*(1-cpuBeta))
+}
+
+// CpuUsage returns the moving average of the cpu usage in millicpu, ranged in [0, 1000].
+func CpuUsage() int64 {
+	return atomic.LoadInt64(&cpuUsage)
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package load
+
+import "errors"
+
+type cpuReader func() (busy, total uint64, err error)
+
+func newCpuReader() (cpuReader, error) {
+	return nil, errors.New("cpu usage is only supported on linux")
+}
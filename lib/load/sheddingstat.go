@@ -0,0 +1,72 @@
+package load
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/threading"
+)
+
+const sheddingStatInterval = time.Minute
+
+type (
+	// SheddingStat counts the requests and logs the statistics every minute.
+	SheddingStat struct {
+		name  string
+		total int64
+		pass  int64
+		drop  int64
+	}
+
+	snapshot struct {
+		total int64
+		pass  int64
+		drop  int64
+	}
+)
+
+func NewSheddingStat(name string) *SheddingStat {
+	st := &SheddingStat{
+		name: name,
+	}
+	threading.GoSafe(st.run)
+	return st
+}
+
+func (s *SheddingStat) IncrementTotal() {
+	atomic.AddInt64(&s.total, 1)
+}
+
+func (s *SheddingStat) IncrementPass() {
+	atomic.AddInt64(&s.pass, 1)
+}
+
+func (s *SheddingStat) IncrementDrop() {
+	atomic.AddInt64(&s.drop, 1)
+}
+
+func (s *SheddingStat) reset() snapshot {
+	return snapshot{
+		total: atomic.SwapInt64(&s.total, 0),
+		pass:  atomic.SwapInt64(&s.pass, 0),
+		drop:  atomic.SwapInt64(&s.drop, 0),
+	}
+}
+
+func (s *SheddingStat) run() {
+	ticker := time.NewTicker(sheddingStatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c := CpuUsage()
+		st := s.reset()
+		if st.drop == 0 {
+			logx.Statf("(%s) shedding_stat [1m], cpu: %d, total: %d, pass: %d, drop: %d",
+				s.name, c, st.total, st.pass, st.drop)
+		} else {
+			logx.Statf("(%s) shedding_stat_drop [1m], cpu: %d, total: %d, pass: %d, drop: %d",
+				s.name, c, st.total, st.pass, st.drop)
+		}
+	}
+}
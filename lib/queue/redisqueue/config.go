@@ -0,0 +1,52 @@
+package redisqueue
+
+import (
+	"errors"
+
+	"github.com/vsaien/cuter/lib/stores/redis"
+)
+
+var (
+	ErrEmptyStream = errors.New("empty stream")
+	ErrEmptyGroup  = errors.New("empty group")
+)
+
+type StreamConf struct {
+	redis.RedisConf
+	Stream string
+	// the consumer group, the messages are delivered to one of the consumers of the group
+	Group string
+	// the stream of the messages delivered more than MaxDeliveries times, Stream:dead if empty
+	DeadLetter    string `json:",optional"`
+	MaxDeliveries int64  `json:",default=5"`
+	// in milliseconds, the messages unacknowledged longer than it are reclaimed from the crashed consumers
+	ClaimIdle int64 `json:",default=60000"`
+	// the number of the messages read each time
+	BatchSize int64 `json:",default=10"`
+	// the stream is trimmed to about MaxLen messages on pushing, not trimmed if 0
+	MaxLen int64 `json:",optional"`
+}
+
+func (sc StreamConf) Validate() error {
+	if err := sc.RedisConf.Validate(); err != nil {
+		return err
+	}
+
+	if len(sc.Stream) == 0 {
+		return ErrEmptyStream
+	}
+
+	if len(sc.Group) == 0 {
+		return ErrEmptyGroup
+	}
+
+	return nil
+}
+
+func (sc StreamConf) deadLetter() string {
+	if len(sc.DeadLetter) > 0 {
+		return sc.DeadLetter
+	}
+
+	return sc.Stream + ":dead"
+}
@@ -0,0 +1,65 @@
+package redisqueue
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/vsaien/cuter/lib/queue"
+	"github.com/vsaien/cuter/lib/stores/redis"
+)
+
+var ErrBadMessage = errors.New("bad stream message")
+
+// ackConsumer acknowledges the messages consumed successfully, the failed ones are left pending,
+// which are reclaimed and delivered again after StreamConf.ClaimIdle.
+type ackConsumer struct {
+	queue.Consumer
+	rds    *redis.Redis
+	stream string
+	group  string
+}
+
+func newAckConsumerFactory(c StreamConf, rds *redis.Redis, factory queue.ConsumerFactory) queue.ConsumerFactory {
+	return func() (queue.Consumer, error) {
+		consumer, err := factory()
+		if err != nil {
+			return nil, err
+		}
+
+		return ackConsumer{
+			Consumer: consumer,
+			rds:      rds,
+			stream:   c.Stream,
+			group:    c.Group,
+		}, nil
+	}
+}
+
+func (c ackConsumer) Consume(message string) error {
+	id, payload, ok := unwrap(message)
+	if !ok {
+		return ErrBadMessage
+	}
+
+	if err := c.Consumer.Consume(payload); err != nil {
+		return err
+	}
+
+	_, err := c.rds.Xack(c.stream, c.group, id)
+	return err
+}
+
+// wrap puts the id before the message to be passed through the queue, because the ids are needed
+// on acknowledging.
+func wrap(id, message string) string {
+	return id + " " + message
+}
+
+func unwrap(message string) (id, payload string, ok bool) {
+	index := strings.IndexByte(message, ' ')
+	if index < 0 {
+		return "", "", false
+	}
+
+	return message[:index], message[index+1:], true
+}
@@ -0,0 +1,204 @@
+package redisqueue
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/queue"
+	"github.com/vsaien/cuter/lib/stores/redis"
+)
+
+const (
+	// the interval to reclaim the pending messages of the crashed consumers
+	claimInterval = time.Second
+	// the time to block on reading, less than the read timeout of the blocking nodes
+	readBlockTime = 3 * time.Second
+	// the time to wait before retrying on the errors
+	retryInterval = time.Second
+	// the start of XAUTOCLAIM, which also means all the pending messages are scanned
+	claimStart = "0-0"
+)
+
+var consumerIndex uint64
+
+// streamProducer reads the messages of the stream as a consumer of the group, the messages are
+// passed to the consumers with the ids wrapped.
+type streamProducer struct {
+	c         StreamConf
+	rds       *redis.Redis
+	node      redis.RedisClosableNode
+	consumer  string
+	listeners []queue.ProduceListener
+	paused    bool
+	buffer    []redis.StreamMessage
+	lastClaim time.Time
+	claimFrom string
+}
+
+func newStreamProducerFactory(c StreamConf, rds *redis.Redis) queue.ProducerFactory {
+	return func() (queue.Producer, error) {
+		if err := rds.XgroupCreate(c.Stream, c.Group, "0"); err != nil {
+			return nil, err
+		}
+
+		node, err := redis.CreateRedisBlockingNode(rds)
+		if err != nil {
+			return nil, err
+		}
+
+		return &streamProducer{
+			c:         c,
+			rds:       rds,
+			node:      node,
+			consumer:  consumerName(),
+			claimFrom: claimStart,
+		}, nil
+	}
+}
+
+func (p *streamProducer) AddListener(listener queue.ProduceListener) {
+	p.listeners = append(p.listeners, listener)
+}
+
+func (p *streamProducer) Produce() (string, bool) {
+	if len(p.buffer) == 0 {
+		if err := p.fill(); err != nil {
+			logx.Errorf("read stream %s failed: %s", p.c.Stream, err)
+			p.pause()
+			time.Sleep(retryInterval)
+			return "", false
+		}
+
+		p.resume()
+		if len(p.buffer) == 0 {
+			return "", false
+		}
+	}
+
+	msg := p.buffer[0]
+	p.buffer = p.buffer[1:]
+	return wrap(msg.Id, msg.Values[messageField]), true
+}
+
+// claim reclaims the messages idle longer than ClaimIdle, which might be failed or delivered to
+// the crashed consumers, the ones delivered more than MaxDeliveries times are dead lettered.
+func (p *streamProducer) claim() ([]redis.StreamMessage, error) {
+	msgs, next, err := p.rds.Xautoclaim(p.c.Stream, p.c.Group, p.consumer,
+		time.Duration(p.c.ClaimIdle)*time.Millisecond, p.claimFrom, p.c.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	p.claimFrom = next
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	// exactly the claimed ones, the range of them might have the in-flight ones of this consumer
+	ids := make([]string, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.Id
+	}
+	pendings, err := p.rds.XpendingOf(p.c.Stream, p.c.Group, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make(map[string]int64, len(pendings))
+	for _, pending := range pendings {
+		deliveries[pending.Id] = pending.Deliveries
+	}
+
+	var claimed []redis.StreamMessage
+	for _, msg := range msgs {
+		if msg.Values == nil {
+			// deleted from the stream, nothing to deliver
+			if _, err := p.rds.Xack(p.c.Stream, p.c.Group, msg.Id); err != nil {
+				return nil, err
+			}
+		} else if deliveries[msg.Id] > p.c.MaxDeliveries {
+			if err := p.deadLetter(msg, deliveries[msg.Id]); err != nil {
+				return nil, err
+			}
+		} else {
+			claimed = append(claimed, msg)
+		}
+	}
+
+	return claimed, nil
+}
+
+// deadLetter moves msg to the dead letter stream, the original id and the deliveries are kept.
+func (p *streamProducer) deadLetter(msg redis.StreamMessage, deliveries int64) error {
+	deadLetter := p.c.deadLetter()
+	if _, err := p.rds.Xadd(deadLetter, 0, map[string]interface{}{
+		messageField: msg.Values[messageField],
+		"id":         msg.Id,
+		"group":      p.c.Group,
+		"deliveries": deliveries,
+	}); err != nil {
+		return err
+	}
+
+	logx.Errorf("message %s of stream %s delivered %d times, moved to %s", msg.Id, p.c.Stream,
+		deliveries, deadLetter)
+	_, err := p.rds.Xack(p.c.Stream, p.c.Group, msg.Id)
+	return err
+}
+
+func (p *streamProducer) fill() error {
+	if time.Since(p.lastClaim) >= claimInterval {
+		p.lastClaim = time.Now()
+		msgs, err := p.claim()
+		if err != nil {
+			return err
+		}
+		if len(msgs) > 0 {
+			p.buffer = msgs
+			return nil
+		}
+	}
+
+	msgs, err := p.rds.XreadGroup(p.node, p.c.Group, p.consumer, p.c.Stream, p.c.BatchSize, readBlockTime)
+	if err != nil {
+		return err
+	}
+
+	p.buffer = msgs
+	return nil
+}
+
+func (p *streamProducer) pause() {
+	if p.paused {
+		return
+	}
+
+	p.paused = true
+	for _, listener := range p.listeners {
+		listener.OnProducerPause()
+	}
+}
+
+func (p *streamProducer) resume() {
+	if !p.paused {
+		return
+	}
+
+	p.paused = false
+	for _, listener := range p.listeners {
+		listener.OnProducerResume()
+	}
+}
+
+// consumerName returns the unique name in the group, like host-pid-index.
+func consumerName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), atomic.AddUint64(&consumerIndex, 1))
+}
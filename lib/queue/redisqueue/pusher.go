@@ -0,0 +1,35 @@
+package redisqueue
+
+import (
+	"github.com/vsaien/cuter/lib/queue"
+	"github.com/vsaien/cuter/lib/stores/redis"
+)
+
+// the field of the messages in the streams
+const messageField = "message"
+
+type StreamPusher struct {
+	rds    *redis.Redis
+	stream string
+	maxLen int64
+}
+
+// NewStreamPusher returns a QueuePusher appending the messages to the stream of c by XADD.
+func NewStreamPusher(c StreamConf) queue.QueuePusher {
+	return &StreamPusher{
+		rds:    c.NewRedis(),
+		stream: c.Stream,
+		maxLen: c.MaxLen,
+	}
+}
+
+func (pusher *StreamPusher) Name() string {
+	return pusher.stream
+}
+
+func (pusher *StreamPusher) Push(message string) error {
+	_, err := pusher.rds.Xadd(pusher.stream, pusher.maxLen, map[string]interface{}{
+		messageField: message,
+	})
+	return err
+}
@@ -0,0 +1,14 @@
+package redisqueue
+
+import "github.com/vsaien/cuter/lib/queue"
+
+// NewQueue returns a Queue consuming the stream of c as the group of c by the consumers of factory.
+// The messages are acknowledged after consumed successfully, the failed ones and the ones of
+// the crashed consumers are delivered again after c.ClaimIdle, and moved to the dead letter stream
+// after delivered c.MaxDeliveries times.
+func NewQueue(c StreamConf, factory queue.ConsumerFactory) *queue.Queue {
+	rds := c.NewRedis()
+	q := queue.NewQueue(newStreamProducerFactory(c, rds), newAckConsumerFactory(c, rds, factory))
+	q.SetName(c.Stream)
+	return q
+}
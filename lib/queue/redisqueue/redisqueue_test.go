@@ -0,0 +1,233 @@
+package redisqueue
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vsaien/cuter/lib/queue"
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/stores/redis/redistest"
+)
+
+type mockedConsumer struct {
+	lock     sync.Mutex
+	messages []string
+	err      error
+}
+
+func (c *mockedConsumer) Consume(message string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.messages = append(c.messages, message)
+	return c.err
+}
+
+func (c *mockedConsumer) OnEvent(event interface{}) {
+}
+
+func newTestConf(t *testing.T) (StreamConf, func()) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+
+	return StreamConf{
+		RedisConf: redis.RedisConf{
+			Host: s.Addr(),
+			Type: redis.NodeType,
+		},
+		Stream:        "s",
+		Group:         "g",
+		MaxDeliveries: 2,
+		ClaimIdle:     1,
+		BatchSize:     10,
+	}, s.Close
+}
+
+func TestStreamConfValidate(t *testing.T) {
+	c := StreamConf{
+		RedisConf: redis.RedisConf{
+			Host: "localhost:6379",
+			Type: redis.NodeType,
+		},
+	}
+	assert.Equal(t, ErrEmptyStream, c.Validate())
+	c.Stream = "s"
+	assert.Equal(t, ErrEmptyGroup, c.Validate())
+	c.Group = "g"
+	assert.Nil(t, c.Validate())
+	assert.Equal(t, "s:dead", c.deadLetter())
+	c.DeadLetter = "dead"
+	assert.Equal(t, "dead", c.deadLetter())
+}
+
+func TestWrap(t *testing.T) {
+	id, payload, ok := unwrap(wrap("1-0", "hello world"))
+	assert.True(t, ok)
+	assert.Equal(t, "1-0", id)
+	assert.Equal(t, "hello world", payload)
+	_, _, ok = unwrap("bad")
+	assert.False(t, ok)
+}
+
+func TestQueue(t *testing.T) {
+	c, clean := newTestConf(t)
+	defer clean()
+
+	pusher := NewStreamPusher(c)
+	assert.Equal(t, "s", pusher.Name())
+	for _, message := range []string{"a", "b", "c"} {
+		assert.Nil(t, pusher.Push(message))
+	}
+
+	consumer := new(mockedConsumer)
+	q := NewQueue(c, func() (queue.Consumer, error) {
+		return consumer, nil
+	})
+	q.SetNumProducer(1)
+	q.SetNumConsumer(1)
+	done := make(chan struct{})
+	go func() {
+		q.Start()
+		close(done)
+	}()
+
+	assert.True(t, waitFor(func() bool {
+		consumer.lock.Lock()
+		defer consumer.lock.Unlock()
+		return len(consumer.messages) == 3
+	}))
+	q.Stop()
+	<-done
+	assert.Equal(t, []string{"a", "b", "c"}, consumer.messages)
+
+	rds := c.NewRedis()
+	assert.True(t, waitFor(func() bool {
+		pendings, err := rds.Xpending("s", "g", "-", "+", 10, "")
+		return err == nil && len(pendings) == 0
+	}))
+}
+
+func TestAckConsumerFailed(t *testing.T) {
+	c, clean := newTestConf(t)
+	defer clean()
+
+	rds := c.NewRedis()
+	assert.Nil(t, rds.XgroupCreate("s", "g", "0"))
+	id, err := rds.Xadd("s", 0, map[string]interface{}{messageField: "a"})
+	assert.Nil(t, err)
+	node, err := redis.CreateRedisBlockingNode(rds)
+	assert.Nil(t, err)
+	defer node.Close()
+	_, err = rds.XreadGroup(node, "g", "c", "s", 10, time.Millisecond)
+	assert.Nil(t, err)
+
+	errConsume := errors.New("any")
+	factory := newAckConsumerFactory(c, rds, func() (queue.Consumer, error) {
+		return &mockedConsumer{err: errConsume}, nil
+	})
+	consumer, err := factory()
+	assert.Nil(t, err)
+	assert.Equal(t, ErrBadMessage, consumer.Consume("bad"))
+	assert.Equal(t, errConsume, consumer.Consume(wrap(id, "a")))
+	pendings, err := rds.Xpending("s", "g", "-", "+", 10, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pendings))
+}
+
+func TestProducerReclaimAndDeadLetter(t *testing.T) {
+	c, clean := newTestConf(t)
+	defer clean()
+
+	rds := c.NewRedis()
+	pusher := NewStreamPusher(c)
+	assert.Nil(t, pusher.Push("a"))
+	producer, err := newStreamProducerFactory(c, rds)()
+	assert.Nil(t, err)
+	p := producer.(*streamProducer)
+
+	produce := func() (string, bool) {
+		time.Sleep(5 * time.Millisecond)
+		p.lastClaim = time.Time{}
+		return p.Produce()
+	}
+
+	// the first delivery, left unacknowledged
+	message, ok := produce()
+	assert.True(t, ok)
+	id, payload, _ := unwrap(message)
+	assert.Equal(t, "a", payload)
+	// reclaimed and delivered the second time
+	message, ok = produce()
+	assert.True(t, ok)
+	assert.Equal(t, wrap(id, "a"), message)
+	// delivered more than MaxDeliveries times, moved to the dead letter stream
+	assert.Nil(t, pusher.Push("b"))
+	message, ok = produce()
+	assert.True(t, ok)
+	_, payload, _ = unwrap(message)
+	assert.Equal(t, "b", payload)
+
+	n, err := rds.Xlen("s:dead")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	pendings, err := rds.Xpending("s", "g", "-", "+", 10, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pendings))
+	assert.NotEqual(t, id, pendings[0].Id)
+}
+
+func TestProducerClaimSkipsInFlight(t *testing.T) {
+	c, clean := newTestConf(t)
+	defer clean()
+	c.ClaimIdle = 50
+	c.MaxDeliveries = 1
+
+	rds := c.NewRedis()
+	producer, err := newStreamProducerFactory(c, rds)()
+	assert.Nil(t, err)
+	p := producer.(*streamProducer)
+
+	var ids []string
+	for _, payload := range []string{"a", "b", "c"} {
+		id, err := rds.Xadd("s", 0, map[string]interface{}{messageField: payload})
+		assert.Nil(t, err)
+		ids = append(ids, id)
+	}
+	node, err := redis.CreateRedisBlockingNode(rds)
+	assert.Nil(t, err)
+	defer node.Close()
+	for _, consumer := range []string{"other", p.consumer, "other"} {
+		_, err := rds.XreadGroup(node, "g", consumer, "s", 1, time.Millisecond)
+		assert.Nil(t, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	// b is in flight on p, not idle
+	msgs, _, err := rds.Xautoclaim("s", "g", p.consumer, 0, ids[1], 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(msgs))
+
+	// a and c are claimed, both delivered twice, b in between is not taken as claimed
+	claimed, err := p.claim()
+	assert.Nil(t, err)
+	assert.Empty(t, claimed)
+	n, err := rds.Xlen("s:dead")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	pendings, err := rds.Xpending("s", "g", "-", "+", 10, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pendings))
+	assert.Equal(t, ids[1], pendings[0].Id)
+}
+
+func waitFor(fn func() bool) bool {
+	for i := 0; i < 500; i++ {
+		if fn() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
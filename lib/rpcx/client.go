@@ -92,6 +92,10 @@ func MustNewClient(c RpcClientConf) *RpcClient {
 }
 
 func NewClient(c RpcClientConf) (*RpcClient, error) {
+	if err := c.Breakers.Setup(); err != nil {
+		return nil, err
+	}
+
 	opts := []ClientOption{}
 	if c.BlockDial {
 		opts = append(opts, WithDialOption(grpc.WithBlock()))
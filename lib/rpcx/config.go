@@ -1,6 +1,7 @@
 package rpcx
 
 import (
+	"github.com/vsaien/cuter/lib/breaker"
 	"github.com/vsaien/cuter/lib/etcd"
 	"github.com/vsaien/cuter/lib/service"
 )
@@ -12,6 +13,8 @@ type (
 		Etcd          etcd.EtcdConf `json:",optional"`
 		StrictControl bool          `json:",optional"`
 		Timeout       int64         `json:",optional"`
+		// in millicpu, 1000 means 100%, the load shedding is enabled if set
+		CpuThreshold int64 `json:",optional"`
 	}
 
 	RpcClientConf struct {
@@ -19,6 +22,8 @@ type (
 		Server        string `json:",optional"`
 		BlockDial     bool   `json:",default=false"`
 		Timeout       int64  `json:",optional"`
+		// the breakers are named by the server address and the method, like localhost:8080/pkg.Service/Method
+		Breakers breaker.Breakers `json:",optional"`
 	}
 )
 
@@ -0,0 +1,73 @@
+package rpcx
+
+import (
+	"context"
+	"time"
+
+	"github.com/vsaien/cuter/lib/service"
+	"github.com/vsaien/cuter/lib/syncx"
+	"github.com/vsaien/cuter/lib/threading"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const healthRefreshInterval = time.Second * 5
+
+// healthServer serves the standard grpc health service, the overall serving status
+// is decided by the health checks registered in service.
+type healthServer struct {
+	*health.Server
+	done *syncx.DoneChan
+}
+
+func newHealthServer() *healthServer {
+	return &healthServer{
+		Server: health.NewServer(),
+		done:   syncx.NewDoneChan(),
+	}
+}
+
+// Check runs the health checks on the overall service, so that the probes get the live status.
+func (hs *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (
+	*healthpb.HealthCheckResponse, error) {
+	if len(req.Service) == 0 {
+		hs.refresh(ctx)
+	}
+
+	return hs.Server.Check(ctx, req)
+}
+
+// Shutdown reports NOT_SERVING to all the watchers, and stops refreshing.
+func (hs *healthServer) Shutdown() {
+	hs.done.Close()
+	hs.Server.Shutdown()
+}
+
+func (hs *healthServer) refresh(ctx context.Context) {
+	report := service.CheckHealth(ctx)
+	if report.Status == service.StatusServing {
+		hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	} else {
+		hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// start refreshes the serving status periodically, to notify the watchers.
+func (hs *healthServer) start() {
+	hs.refresh(context.Background())
+
+	threading.GoSafe(func() {
+		ticker := time.NewTicker(healthRefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				hs.refresh(context.Background())
+			case <-hs.done.Done():
+				return
+			}
+		}
+	})
+}
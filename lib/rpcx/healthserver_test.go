@@ -0,0 +1,37 @@
+package rpcx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vsaien/cuter/lib/service"
+
+	"github.com/stretchr/testify/assert"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthServerCheck(t *testing.T) {
+	hs := newHealthServer()
+	req := &healthpb.HealthCheckRequest{}
+	resp, err := hs.Check(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	service.RegisterHealthCheck("broken", func(ctx context.Context) error {
+		return errors.New("broken")
+	})
+	resp, err = hs.Check(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+
+	service.UnregisterHealthCheck("broken")
+	resp, err = hs.Check(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	hs.Shutdown()
+	resp, err = hs.Check(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+}
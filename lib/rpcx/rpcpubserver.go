@@ -2,14 +2,18 @@ package rpcx
 
 import (
 	"github.com/vsaien/cuter/lib/etcd"
+	"github.com/vsaien/cuter/lib/service"
 
 	"google.golang.org/grpc"
 )
 
+const etcdPublisherCheck = "etcd-publisher"
+
 // etcdEndpoints []string, etcdKey, listenOn, userName, password string
 func NewRpcPubServer(c RpcServerConf, opts ...grpc.ServerOption) (Server, error) {
+	pubClient := etcd.NewPublisher(c.Etcd.Hosts, c.Etcd.Key, c.ListenOn, c.Etcd.UserName, c.Etcd.Password)
+	service.RegisterHealthCheck(etcdPublisherCheck, pubClient.HealthCheck)
 	registerEtcd := func() error {
-		pubClient := etcd.NewPublisher(c.Etcd.Hosts, c.Etcd.Key, c.ListenOn, c.Etcd.UserName, c.Etcd.Password)
 		return pubClient.KeepAlive()
 	}
 	server := keepAliveServer{
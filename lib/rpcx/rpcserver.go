@@ -6,6 +6,7 @@ import (
 	"github.com/vsaien/cuter/lib/system"
 
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type rpcServer struct {
@@ -32,17 +33,20 @@ func (s *rpcServer) Start(register RegisterFn) error {
 		return err
 	}
 
-	unaryInterceptors := []grpc.UnaryServerInterceptor{UnaryStatInterceptor(s.metrics)}
-	unaryInterceptors = append(unaryInterceptors, s.unaryInterceptors...)
+	unaryInterceptors := s.buildUnaryInterceptors()
 	streamInterceptors := []grpc.StreamServerInterceptor{StreamStatInterceptor(s.metrics)}
 	streamInterceptors = append(streamInterceptors, s.streamInterceptors...)
 	options := append(s.options, WithUnaryServerInterceptors(unaryInterceptors...),
 		WithStreamServerInterceptors(streamInterceptors...))
 	server := grpc.NewServer(options...)
 	register(server)
+	healthServer := newHealthServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	healthServer.start()
 	// we need to make sure all others are wrapped up
 	// so we do graceful stop at shutdown phase instead of wrap up phase
 	shutdownCalled := system.AddShutdownListener(func() {
+		healthServer.Shutdown()
 		server.GracefulStop()
 	})
 	err = server.Serve(lis)
@@ -4,6 +4,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/vsaien/cuter/lib/load"
 	"github.com/vsaien/cuter/lib/logx"
 	"github.com/vsaien/cuter/lib/traffic"
 	"google.golang.org/grpc"
@@ -17,12 +18,15 @@ type (
 		AddStreamInterceptors(interceptors ...grpc.StreamServerInterceptor)
 		AddUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor)
 		SetName(string)
+		// SetShedder sets the shedder to reject the requests before they are counted by the metrics.
+		SetShedder(shedder load.Shedder)
 		Start(register RegisterFn) error
 	}
 
 	baseRpcServer struct {
 		address            string
 		metrics            *traffic.Metrics
+		shedder            load.Shedder
 		options            []grpc.ServerOption
 		streamInterceptors []grpc.StreamServerInterceptor
 		unaryInterceptors  []grpc.UnaryServerInterceptor
@@ -58,6 +62,22 @@ func (s *baseRpcServer) SetName(name string) {
 	s.metrics.SetName(name)
 }
 
+func (s *baseRpcServer) SetShedder(shedder load.Shedder) {
+	s.shedder = shedder
+}
+
+// buildUnaryInterceptors returns the unary interceptors, the shedding interceptor goes first,
+// so that the dropped requests are not counted by the stat interceptor.
+func (s *baseRpcServer) buildUnaryInterceptors() []grpc.UnaryServerInterceptor {
+	var interceptors []grpc.UnaryServerInterceptor
+	if s.shedder != nil {
+		interceptors = append(interceptors, UnarySheddingInterceptor(s.shedder, s.metrics))
+	}
+	interceptors = append(interceptors, UnaryStatInterceptor(s.metrics))
+
+	return append(interceptors, s.unaryInterceptors...)
+}
+
 func MustNewServer(c RpcServerConf, register RegisterFn) *RpcServer {
 	server, err := NewServer(c, register)
 	if err != nil {
@@ -95,6 +115,11 @@ func NewServer(c RpcServerConf, register RegisterFn) (*RpcServer, error) {
 	return rpcServer, nil
 }
 
+// AddUnaryInterceptors adds the interceptors, like UnaryLimitInterceptor, it must be called before Start.
+func (rs *RpcServer) AddUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) {
+	rs.server.AddUnaryInterceptors(interceptors...)
+}
+
 func (rs *RpcServer) Start() {
 	if err := rs.server.Start(rs.register); err != nil {
 		logx.Error(err)
@@ -107,6 +132,9 @@ func (rs *RpcServer) Stop() {
 }
 
 func setupInterceptors(server Server, c RpcServerConf) error {
+	if c.CpuThreshold > 0 {
+		server.SetShedder(load.NewAdaptiveShedder(load.WithCpuThreshold(c.CpuThreshold)))
+	}
 	if c.Timeout > 0 {
 		server.AddUnaryInterceptors(UnaryTimeoutInterceptor(time.Duration(c.Timeout) * time.Millisecond))
 	}
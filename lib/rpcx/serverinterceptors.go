@@ -3,18 +3,35 @@ package rpcx
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net"
+	"runtime/debug"
+	"sync"
 	"time"
 
+	"github.com/vsaien/cuter/lib/limit"
+	"github.com/vsaien/cuter/lib/load"
 	"github.com/vsaien/cuter/lib/logx"
 	"github.com/vsaien/cuter/lib/traffic"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
-	"runtime/debug"
 )
 
-const serverSlowThreshold = time.Millisecond * 500
+const (
+	serverSlowThreshold = time.Millisecond * 500
+	serviceType         = "rpc"
+)
+
+var (
+	errRequestLimited = errors.New("request limited")
+
+	sheddingStat     *load.SheddingStat
+	sheddingStatOnce sync.Once
+)
 
 func StreamStatInterceptor(metrics *traffic.Metrics) grpc.StreamServerInterceptor {
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
@@ -34,10 +51,11 @@ func UnaryStatInterceptor(metrics *traffic.Metrics) grpc.UnaryServerInterceptor
 			err = toPanicError(r)
 		})
 
+		metrics.Start()
 		startTime := time.Now()
 		defer func() {
 			duration := time.Since(startTime)
-			metrics.Add(traffic.Task{
+			metrics.Done(traffic.Task{
 				Duration: duration,
 			})
 			logDuration(info.FullMethod, req, duration)
@@ -47,6 +65,94 @@ func UnaryStatInterceptor(metrics *traffic.Metrics) grpc.UnaryServerInterceptor
 	}
 }
 
+// UnarySheddingInterceptor rejects the requests with codes.Unavailable when shedder
+// reports the service is overloaded, the adaptive shedders take the in-flight counts and
+// the response times from metrics, so it should be placed before UnaryStatInterceptor,
+// to keep the dropped requests out of them, like the servers set by Server.SetShedder.
+// metrics can be nil.
+func UnarySheddingInterceptor(shedder load.Shedder, metrics *traffic.Metrics) grpc.UnaryServerInterceptor {
+	sheddingStatOnce.Do(func() {
+		sheddingStat = load.NewSheddingStat(serviceType)
+	})
+	load.BindMetrics(shedder, metrics)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		sheddingStat.IncrementTotal()
+		promise, err := shedder.Allow()
+		if err != nil {
+			if metrics != nil {
+				metrics.AddDrop()
+			}
+			sheddingStat.IncrementDrop()
+			logx.Errorf("[RPC] service overloaded, dropped - %s", info.FullMethod)
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		defer func() {
+			if status.Code(err) == codes.Unavailable {
+				promise.Fail()
+			} else {
+				sheddingStat.IncrementPass()
+				promise.Pass()
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// LimitKeyFunc returns the key that the requests are limited by.
+type LimitKeyFunc func(ctx context.Context, info *grpc.UnaryServerInfo) string
+
+// UnaryLimitInterceptor rejects the requests with codes.ResourceExhausted when limiter reports
+// the quota of the key returned by keyFunc is exceeded, the requests are limited by the peer ips
+// if keyFunc is nil.
+func UnaryLimitInterceptor(limiter limit.Limiter, keyFunc LimitKeyFunc) grpc.UnaryServerInterceptor {
+	if keyFunc == nil {
+		keyFunc = LimitByPeerIp
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if !limiter.Allow(keyFunc(ctx, info)) {
+			logx.Errorf("[RPC] request limited, dropped - %s", info.FullMethod)
+			return nil, status.Error(codes.ResourceExhausted, errRequestLimited.Error())
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// LimitByPeerIp limits the requests by the ips of the peers.
+func LimitByPeerIp(ctx context.Context, _ *grpc.UnaryServerInfo) string {
+	pr, ok := peer.FromContext(ctx)
+	if !ok || pr.Addr == nil {
+		return ""
+	}
+
+	addr := pr.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// LimitByMetadata returns a LimitKeyFunc that limits the requests by the incoming metadata of key,
+// like the user id, the requests without the metadata are limited by the peer ips.
+func LimitByMetadata(key string) LimitKeyFunc {
+	return func(ctx context.Context, info *grpc.UnaryServerInfo) string {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if vals := md.Get(key); len(vals) > 0 {
+				return vals[0]
+			}
+		}
+
+		return LimitByPeerIp(ctx, info)
+	}
+}
+
 func UnaryTimeoutInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler) (resp interface{}, err error) {
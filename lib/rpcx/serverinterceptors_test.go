@@ -0,0 +1,166 @@
+package rpcx
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vsaien/cuter/lib/limit"
+	"github.com/vsaien/cuter/lib/load"
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/stores/redis/redistest"
+	"github.com/vsaien/cuter/lib/traffic"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type mockShedder struct {
+	allow  bool
+	passed int
+	failed int
+}
+
+func (s *mockShedder) Allow() (load.Promise, error) {
+	if s.allow {
+		return s, nil
+	}
+
+	return nil, load.ErrServiceOverloaded
+}
+
+func (s *mockShedder) Pass() {
+	s.passed++
+}
+
+func (s *mockShedder) Fail() {
+	s.failed++
+}
+
+func TestUnarySheddingInterceptor(t *testing.T) {
+	tests := []struct {
+		name   string
+		allow  bool
+		err    error
+		code   codes.Code
+		passed int
+		failed int
+	}{
+		{"accepted", true, nil, codes.OK, 1, 0},
+		{"accepted but failed", true, status.Error(codes.Internal, "internal"), codes.Internal, 1, 0},
+		{"accepted but unavailable", true, status.Error(codes.Unavailable, "unavailable"),
+			codes.Unavailable, 0, 1},
+		{"dropped", false, nil, codes.Unavailable, 0, 0},
+	}
+
+	metrics := traffic.NewMetrics("shedding")
+	info := &grpc.UnaryServerInfo{FullMethod: "/foo/bar"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shedder := &mockShedder{allow: test.allow}
+			interceptor := UnarySheddingInterceptor(shedder, metrics)
+			called := false
+			_, err := interceptor(context.Background(), "req", info,
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					called = true
+					return req, test.err
+				})
+			assert.Equal(t, test.code, status.Code(err))
+			assert.Equal(t, test.allow, called)
+			assert.Equal(t, test.passed, shedder.passed)
+			assert.Equal(t, test.failed, shedder.failed)
+		})
+	}
+}
+
+func TestUnarySheddingInterceptorWithoutMetrics(t *testing.T) {
+	interceptor := UnarySheddingInterceptor(&mockShedder{}, nil)
+	_, err := interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/foo/bar"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			t.Fatal("should not be called")
+			return nil, nil
+		})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestBuildUnaryInterceptors(t *testing.T) {
+	server := newBaseRpcServer("localhost:0")
+	server.AddUnaryInterceptors(UnaryTimeoutInterceptor(time.Second))
+	assert.Equal(t, 2, len(server.buildUnaryInterceptors()))
+
+	// the dropped requests are not counted by the stat interceptor
+	var tasks int
+	server.metrics.AddListener(func(task traffic.Task) {
+		tasks++
+	})
+	shedder := &mockShedder{}
+	server.SetShedder(shedder)
+	interceptors := server.buildUnaryInterceptors()
+	assert.Equal(t, 3, len(interceptors))
+	info := &grpc.UnaryServerInfo{FullMethod: "/foo/bar"}
+	call := func() error {
+		_, err := interceptors[0](context.Background(), "req", info,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptors[1](ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return req, nil
+				})
+			})
+		return err
+	}
+	assert.Equal(t, codes.Unavailable, status.Code(call()))
+	assert.Equal(t, 0, tasks)
+
+	shedder.allow = true
+	assert.Nil(t, call())
+	assert.Equal(t, 1, tasks)
+	assert.Equal(t, int64(0), server.metrics.Flying())
+}
+
+func TestUnaryLimitInterceptor(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	limiter := limit.NewPeriodLimit(10, 2, redis.NewRedis(s.Addr(), redis.NodeType), "rpclimit:")
+	interceptor := UnaryLimitInterceptor(limiter, nil)
+	info := &grpc.UnaryServerInfo{FullMethod: "/foo/bar"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+	call := func(ip string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234},
+		})
+		resp, err := interceptor(ctx, "req", info, handler)
+		if err == nil {
+			assert.Equal(t, "req", resp)
+		}
+		return err
+	}
+
+	assert.Nil(t, call("10.0.0.1"))
+	assert.Nil(t, call("10.0.0.1"))
+	err = call("10.0.0.1")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	// limited by the peer ips
+	assert.Nil(t, call("10.0.0.2"))
+}
+
+func TestLimitByMetadata(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/foo/bar"}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234},
+	})
+	keyFunc := LimitByMetadata("uid")
+	assert.Equal(t, "10.0.0.1", keyFunc(ctx, info))
+	assert.Equal(t, "10.0.0.1", LimitByPeerIp(ctx, info))
+	assert.Equal(t, "", LimitByPeerIp(context.Background(), info))
+
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("uid", "123"))
+	assert.Equal(t, "123", keyFunc(ctx, info))
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vsaien/cuter/lib/threading"
+)
+
+const (
+	StatusServing    = "serving"
+	StatusNotServing = "not_serving"
+
+	defaultCheckTimeout = time.Second
+)
+
+var (
+	// set by -ldflags "-X github.com/vsaien/cuter/lib/service.Version=..." on building
+	Version   string
+	GitCommit string
+	BuildTime string
+
+	ErrCheckTimeout = errors.New("health check timeout")
+
+	defaultHealthRegistry = NewHealthRegistry()
+)
+
+type (
+	// HealthCheck returns nil if the checked component is healthy.
+	HealthCheck func(ctx context.Context) error
+
+	HealthCheckOption func(check *healthCheck)
+
+	CheckResult struct {
+		Name     string `json:"name"`
+		Healthy  bool   `json:"healthy"`
+		Error    string `json:"error,omitempty"`
+		Duration string `json:"duration"`
+	}
+
+	HealthReport struct {
+		Status string        `json:"status"`
+		Checks []CheckResult `json:"checks,omitempty"`
+	}
+
+	BuildInfo struct {
+		Version   string `json:"version,omitempty"`
+		GitCommit string `json:"gitCommit,omitempty"`
+		BuildTime string `json:"buildTime,omitempty"`
+		GoVersion string `json:"goVersion"`
+	}
+
+	// HealthRegistry holds the health checks of the components, the checks are run concurrently
+	// on checking, each one with its own timeout.
+	HealthRegistry struct {
+		checks map[string]*healthCheck
+		lock   sync.RWMutex
+	}
+
+	healthCheck struct {
+		name    string
+		check   HealthCheck
+		timeout time.Duration
+	}
+)
+
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{
+		checks: make(map[string]*healthCheck),
+	}
+}
+
+// Register registers the check with name, the check with the same name is replaced.
+func (hr *HealthRegistry) Register(name string, check HealthCheck, opts ...HealthCheckOption) {
+	hc := &healthCheck{
+		name:    name,
+		check:   check,
+		timeout: defaultCheckTimeout,
+	}
+	for _, opt := range opts {
+		opt(hc)
+	}
+
+	hr.lock.Lock()
+	hr.checks[name] = hc
+	hr.lock.Unlock()
+}
+
+func (hr *HealthRegistry) Unregister(name string) {
+	hr.lock.Lock()
+	delete(hr.checks, name)
+	hr.lock.Unlock()
+}
+
+// Check runs all the checks, the status is StatusServing only if all the checks passed.
+func (hr *HealthRegistry) Check(ctx context.Context) HealthReport {
+	hr.lock.RLock()
+	checks := make([]*healthCheck, 0, len(hr.checks))
+	for _, hc := range hr.checks {
+		checks = append(checks, hc)
+	}
+	hr.lock.RUnlock()
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].name < checks[j].name
+	})
+
+	results := make([]CheckResult, len(checks))
+	group := threading.NewRoutineGroup()
+	for i := range checks {
+		index := i
+		group.Run(func() {
+			results[index] = checks[index].run(ctx)
+		})
+	}
+	group.WaitForDone()
+
+	report := HealthReport{
+		Status: StatusServing,
+		Checks: results,
+	}
+	for _, result := range results {
+		if !result.Healthy {
+			report.Status = StatusNotServing
+			break
+		}
+	}
+
+	return report
+}
+
+func (hc *healthCheck) run(ctx context.Context) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, hc.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	threading.GoSafe(func() {
+		var err error
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("%v", p)
+			}
+			done <- err
+		}()
+
+		err = hc.check(ctx)
+	})
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrCheckTimeout
+	}
+
+	result := CheckResult{
+		Name:     hc.name,
+		Healthy:  err == nil,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// WithCheckTimeout customizes the timeout of the check, defaults to 1 second.
+func WithCheckTimeout(timeout time.Duration) HealthCheckOption {
+	return func(check *healthCheck) {
+		check.timeout = timeout
+	}
+}
+
+// RegisterHealthCheck registers the check into the default registry,
+// which is served by cuter.Engine and rpcx.RpcServer.
+func RegisterHealthCheck(name string, check HealthCheck, opts ...HealthCheckOption) {
+	defaultHealthRegistry.Register(name, check, opts...)
+}
+
+func UnregisterHealthCheck(name string) {
+	defaultHealthRegistry.Unregister(name)
+}
+
+// CheckHealth runs the checks in the default registry.
+func CheckHealth(ctx context.Context) HealthReport {
+	return defaultHealthRegistry.Check(ctx)
+}
+
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
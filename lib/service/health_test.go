@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthRegistry(t *testing.T) {
+	registry := NewHealthRegistry()
+	report := registry.Check(context.Background())
+	assert.Equal(t, StatusServing, report.Status)
+	assert.Equal(t, 0, len(report.Checks))
+
+	registry.Register("b", func(ctx context.Context) error {
+		return nil
+	})
+	registry.Register("a", func(ctx context.Context) error {
+		return errors.New("down")
+	})
+	report = registry.Check(context.Background())
+	assert.Equal(t, StatusNotServing, report.Status)
+	assert.Equal(t, 2, len(report.Checks))
+	assert.Equal(t, "a", report.Checks[0].Name)
+	assert.False(t, report.Checks[0].Healthy)
+	assert.Equal(t, "down", report.Checks[0].Error)
+	assert.Equal(t, "b", report.Checks[1].Name)
+	assert.True(t, report.Checks[1].Healthy)
+
+	registry.Unregister("a")
+	report = registry.Check(context.Background())
+	assert.Equal(t, StatusServing, report.Status)
+	assert.Equal(t, 1, len(report.Checks))
+}
+
+func TestHealthRegistryTimeout(t *testing.T) {
+	registry := NewHealthRegistry()
+	registry.Register("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}, WithCheckTimeout(time.Millisecond*10))
+	registry.Register("panic", func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	start := time.Now()
+	report := registry.Check(context.Background())
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, StatusNotServing, report.Status)
+	assert.Equal(t, "boom", report.Checks[0].Error)
+	assert.Equal(t, ErrCheckTimeout.Error(), report.Checks[1].Error)
+}
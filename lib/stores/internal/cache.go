@@ -1,17 +1,29 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/vsaien/cuter/lib/logx"
 	"github.com/vsaien/cuter/lib/stores/redis"
 	"github.com/vsaien/cuter/lib/syncx"
+	"github.com/vsaien/cuter/lib/threading"
 )
 
 const (
 	notFoundExpiry      = 60 // seconds
 	notFoundPlaceholder = "*"
+	// the expiries are randomized in [(1-deviation)*seconds, (1+deviation)*seconds]
+	defaultExpiryDeviation = 0.05
+	defaultRefreshTimeout  = 5 * time.Second
 )
 
 var (
@@ -20,46 +32,115 @@ var (
 	ErrPlaceholder = errors.New("placeholder")
 )
 
-type Cache struct {
-	rds     *redis.Redis
-	barrier syncx.ExclusiveCalls
-	stat    *CacheStat
-}
+type (
+	CacheOption func(cache *Cache)
+
+	Cache struct {
+		rds             *redis.Redis
+		barrier         syncx.ExclusiveCalls
+		stat            *CacheStat
+		local           *LocalCache
+		expiryDeviation float64
+		// the values are served in the last stale of their lives while refreshing
+		stale time.Duration
+		// the keys being refreshed in background
+		refreshing     *sync.Map
+		refreshTimeout time.Duration
+	}
+
+	// detachedContext keeps the values of the parent context, but not its deadline and cancellation.
+	detachedContext struct {
+		context.Context
+	}
+
+	// batchLoad holds the barriers of the keys claimed by TakeMany until they are loaded.
+	batchLoad struct {
+		loaded reflect.Value
+		err    error
+		done   chan struct{}
+		once   sync.Once
+	}
 
-func NewCache(rds *redis.Redis, barrier syncx.ExclusiveCalls, stat *CacheStat) Cache {
-	return Cache{
-		rds:     rds,
-		barrier: barrier,
-		stat:    stat,
+	flightResult struct {
+		val interface{}
+		err error
 	}
+)
+
+func NewCache(rds *redis.Redis, barrier syncx.ExclusiveCalls, stat *CacheStat, opts ...CacheOption) Cache {
+	cache := Cache{
+		rds:             rds,
+		barrier:         barrier,
+		stat:            stat,
+		expiryDeviation: defaultExpiryDeviation,
+		refreshing:      new(sync.Map),
+		refreshTimeout:  defaultRefreshTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cache)
+	}
+
+	return cache
 }
 
 func (c Cache) DelCache(key string) error {
-	_, err := c.rds.Del(key)
-	return err
+	if _, err := c.rds.Del(key); err != nil {
+		return err
+	}
+
+	if c.local != nil {
+		c.local.Del(key)
+	}
+
+	return nil
 }
 
+// SetCache sets the cache of key, the local caches of key are dropped on all the instances.
 func (c Cache) SetCache(key string, v interface{}, seconds int) error {
 	data, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
 
-	if seconds > 0 {
-		return c.rds.Setex(key, string(data), seconds)
-	} else {
-		return c.rds.Set(key, string(data))
+	if err := c.setRedis(key, string(data), seconds); err != nil {
+		return err
+	}
+
+	if c.local != nil {
+		c.local.Del(key)
 	}
+
+	return nil
 }
 
+// SetCacheWithNotFound sets the not found placeholder of key, the local caches of key are dropped
+// on all the instances.
 func (c Cache) SetCacheWithNotFound(key string) error {
-	return c.rds.Setex(key, notFoundPlaceholder, notFoundExpiry)
+	if err := c.rds.Setex(key, notFoundPlaceholder, c.randomize(notFoundExpiry)); err != nil {
+		return err
+	}
+
+	if c.local != nil {
+		c.local.Del(key)
+	}
+
+	return nil
 }
 
 func (c Cache) Take(v interface{}, key string, seconds int, query func(v interface{}) error) error {
+	return c.TakeCtx(context.Background(), v, key, seconds, func(_ context.Context, v interface{}) error {
+		return query(v)
+	})
+}
+
+// TakeCtx is the same as Take, but queries with ctx on cache misses. The stale values are refreshed
+// in background with a context carrying the values of ctx, but not its deadline and cancellation,
+// because the refreshes outlive the taking calls, the refreshes time out on their own.
+func (c Cache) TakeCtx(ctx context.Context, v interface{}, key string, seconds int,
+	query func(ctx context.Context, v interface{}) error) error {
 	c.stat.IncrementTotal()
 	val, fresh, err := c.barrier.DoEx(key, func() (interface{}, error) {
-		if err := c.queryCache(key, v); err != nil {
+		if stale, err := c.queryCache(key, v); err != nil {
 			if err == ErrPlaceholder {
 				c.stat.IncrementCache()
 				return nil, ErrNotFound
@@ -71,8 +152,8 @@ func (c Cache) Take(v interface{}, key string, seconds int, query func(v interfa
 				return nil, err
 			}
 
-			if err = query(v); err == ErrNotFound {
-				if err = c.SetCacheWithNotFound(key); err != nil {
+			if err = query(ctx, v); err == ErrNotFound {
+				if err = c.setCacheWithNotFound(key); err != nil {
 					logx.Error(err)
 				}
 
@@ -82,12 +163,16 @@ func (c Cache) Take(v interface{}, key string, seconds int, query func(v interfa
 				return nil, err
 			}
 
-			if err = c.SetCache(key, v, seconds); err != nil {
+			if err = c.setCache(key, v, seconds); err != nil {
 				logx.Error(err)
 			}
 		} else {
 			// successfully queried from cache
 			c.stat.IncrementCache()
+			if stale {
+				c.stat.IncrementStale()
+				c.refresh(ctx, key, v, seconds, query)
+			}
 		}
 
 		return json.Marshal(v)
@@ -105,19 +190,434 @@ func (c Cache) Take(v interface{}, key string, seconds int, query func(v interfa
 	return json.Unmarshal(val.([]byte), v)
 }
 
-func (c Cache) queryCache(key string, v interface{}) error {
-	data, err := c.rds.Get(key)
+// TakeMany takes the values of keys into v, which must be a pointer to a map of string to the value type,
+// like *map[string]User, the keys not found are absent in the map.
+// The keys missing in cache are loaded by query in one call, query fills the rows into a pointer to
+// a slice of the value type, keyOf returns the cache key of each row. The loaded rows are cached with
+// seconds, and the keys not loaded are cached with the not found placeholders. Each missed key is
+// guarded by its own barrier, shared with Take, so that a key is loaded once by the concurrent calls.
+func (c Cache) TakeMany(v interface{}, keys []string, seconds int, query func(v interface{}, keys []string) error,
+	keyOf func(row interface{}) string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Map || rv.Elem().Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("expect a pointer to map[string]T, got %T", v)
+	}
+
+	result := rv.Elem()
+	if result.IsNil() {
+		result.Set(reflect.MakeMap(result.Type()))
+	}
+
+	keys = unique(keys)
+	for range keys {
+		c.stat.IncrementTotal()
+	}
+
+	missed, err := c.takeCaches(result, keys)
 	if err != nil {
 		return err
 	}
 
-	if len(data) == 0 {
-		return ErrNotFound
+	return c.loadMissed(result, missed, seconds, query, keyOf)
+}
+
+// loadMissed loads the missed keys into result under the barrier of each key, so that the ongoing
+// Take and TakeMany calls of the same keys are waited instead of querying again, and the later ones
+// wait for this loading. The barriers are taken in the order of the sorted keys to avoid deadlocks
+// between the overlapped TakeMany calls, the keys being loaded by the others are taken from their
+// results, and the keys claimed are loaded by query in one call.
+func (c Cache) loadMissed(result reflect.Value, missed []string, seconds int,
+	query func(v interface{}, keys []string) error, keyOf func(row interface{}) string) (err error) {
+	if len(missed) == 0 {
+		return nil
+	}
+
+	batch := &batchLoad{
+		loaded: reflect.MakeMap(result.Type()),
+		done:   make(chan struct{}),
+	}
+	// the claimed barriers must be released even if query panics, otherwise the later calls of the keys hang
+	defer func() {
+		if p := recover(); p != nil {
+			batch.finish(fmt.Errorf("loading keys %v panicked: %v", missed, p))
+			panic(p)
+		}
+
+		batch.finish(err)
+	}()
+
+	var claimed []string
+	pending := missed
+	for len(pending) > 0 {
+		key := pending[0]
+		pending = pending[1:]
+		joined, ok := batch.claim(c.barrier, key)
+		if ok {
+			claimed = append(claimed, key)
+			continue
+		}
+
+		// got the result from previous ongoing query
+		c.stat.IncrementCache()
+		if joined.err != nil && joined.err != ErrNotFound {
+			return joined.err
+		} else if joined.err == nil {
+			elem := reflect.New(result.Type().Elem())
+			if err := json.Unmarshal(joined.val.([]byte), elem.Interface()); err != nil {
+				return err
+			}
+			result.SetMapIndex(reflect.ValueOf(key), elem.Elem())
+		}
+
+		// the remaining keys might be loaded by the ongoing TakeMany calls at the same time
+		if pending, err = c.takeCaches(result, pending); err != nil {
+			return err
+		}
+	}
+
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	if err = c.loadMany(batch.loaded, claimed, seconds, query, keyOf); err != nil {
+		return err
+	}
+
+	for _, key := range batch.loaded.MapKeys() {
+		result.SetMapIndex(key, batch.loaded.MapIndex(key))
+	}
+
+	return nil
+}
+
+// loadMany loads the rows of keys by query into loaded.
+func (c Cache) loadMany(loaded reflect.Value, keys []string, seconds int, query func(v interface{}, keys []string) error,
+	keyOf func(row interface{}) string) error {
+	rows := reflect.New(reflect.SliceOf(loaded.Type().Elem()))
+	if err := query(rows.Interface(), keys); err != nil {
+		c.stat.IncrementDbFails()
+		return err
+	}
+
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	for i := 0; i < rows.Elem().Len(); i++ {
+		row := rows.Elem().Index(i)
+		key := keyOf(row.Interface())
+		if !wanted[key] {
+			continue
+		}
+
+		loaded.SetMapIndex(reflect.ValueOf(key), row)
+		if err := c.setCache(key, row.Interface(), seconds); err != nil {
+			logx.Error(err)
+		}
+	}
+
+	for _, key := range keys {
+		if loaded.MapIndex(reflect.ValueOf(key)).IsValid() {
+			continue
+		}
+
+		if err := c.setCacheWithNotFound(key); err != nil {
+			logx.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// takeCaches takes the cached values of keys into result, returns the sorted missed keys.
+func (c Cache) takeCaches(result reflect.Value, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	vals := make([]string, len(keys))
+	var remote []string
+	var remoteIndexes []int
+	for i, key := range keys {
+		if val, ok := c.takeLocal(key); ok {
+			vals[i] = val
+		} else {
+			remote = append(remote, key)
+			remoteIndexes = append(remoteIndexes, i)
+		}
+	}
+
+	if len(remote) > 0 {
+		remoteVals, err := c.rds.Mget(remote...)
+		if err != nil {
+			c.stat.IncrementCacheFails()
+			// fail fast, in case we bring down the dbs, the same as Take.
+			return nil, err
+		}
+
+		for i, val := range remoteVals {
+			vals[remoteIndexes[i]] = val
+			if c.local != nil && len(val) > 0 {
+				c.local.set(remote[i], val)
+			}
+		}
+	}
+
+	var missed []string
+	for i, key := range keys {
+		switch vals[i] {
+		case "":
+			missed = append(missed, key)
+		case notFoundPlaceholder:
+			c.stat.IncrementCache()
+		default:
+			elem := reflect.New(result.Type().Elem())
+			if err := json.Unmarshal([]byte(vals[i]), elem.Interface()); err != nil {
+				// the bad values are loaded again and overwritten
+				logx.Errorf("unmarshal cache of key %s failed: %s", key, err)
+				missed = append(missed, key)
+				continue
+			}
+
+			c.stat.IncrementCache()
+			result.SetMapIndex(reflect.ValueOf(key), elem.Elem())
+		}
+	}
+	sort.Strings(missed)
+
+	return missed, nil
+}
+
+// queryCache queries the cached value of key into v, returns whether the value is stale.
+func (c Cache) queryCache(key string, v interface{}) (bool, error) {
+	var stale bool
+	data, ok := c.takeLocal(key)
+	if !ok {
+		var ttl time.Duration
+		var err error
+		if c.stale > 0 {
+			data, ttl, err = c.rds.GetWithPttl(key)
+		} else {
+			data, err = c.rds.Get(key)
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if len(data) == 0 {
+			return false, ErrNotFound
+		}
+
+		stale = ttl > 0 && ttl < c.stale
+		// the stale values are not cached locally, in case they are served after expired
+		if c.local != nil && !stale {
+			c.local.set(key, data)
+		}
 	}
 
 	if data == notFoundPlaceholder {
-		return ErrPlaceholder
+		return false, ErrPlaceholder
+	}
+
+	return stale, json.Unmarshal([]byte(data), v)
+}
+
+// randomize randomizes seconds by the deviation, to avoid the keys loaded at the same time
+// expiring together.
+func (c Cache) randomize(seconds int) int {
+	if c.expiryDeviation <= 0 {
+		return seconds
+	}
+
+	deviation := c.expiryDeviation * (2*rand.Float64() - 1)
+	randomized := int(math.Round(float64(seconds) * (1 + deviation)))
+	if randomized < 1 {
+		return 1
+	}
+
+	return randomized
+}
+
+// refresh loads the value of key by query in background, only one refresh of the same key runs
+// at the same time.
+func (c Cache) refresh(ctx context.Context, key string, v interface{}, seconds int,
+	query func(ctx context.Context, v interface{}) error) {
+	if _, ok := c.refreshing.LoadOrStore(key, struct{}{}); ok {
+		return
+	}
+
+	c.stat.IncrementRefresh()
+	threading.GoSafe(func() {
+		defer c.refreshing.Delete(key)
+
+		ctx, cancel := context.WithTimeout(detachedContext{ctx}, c.refreshTimeout)
+		defer cancel()
+
+		val := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+		if err := query(ctx, val); err == ErrNotFound {
+			if err = c.setCacheWithNotFound(key); err != nil {
+				logx.Error(err)
+			}
+		} else if err != nil {
+			c.stat.IncrementRefreshFails()
+			logx.Errorf("refresh cache of key %s failed: %s", key, err)
+		} else if err = c.setCache(key, val, seconds); err != nil {
+			logx.Error(err)
+		}
+	})
+}
+
+// setCache caches the loaded v in redis and the local cache, which is not broadcast.
+func (c Cache) setCache(key string, v interface{}, seconds int) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := c.setRedis(key, string(data), seconds); err != nil {
+		return err
+	}
+
+	if c.local != nil {
+		c.local.set(key, string(data))
+	}
+
+	return nil
+}
+
+// setCacheWithNotFound caches the not found placeholder of the loaded key in redis and
+// the local cache, which is not broadcast.
+func (c Cache) setCacheWithNotFound(key string) error {
+	if err := c.rds.Setex(key, notFoundPlaceholder, c.randomize(notFoundExpiry)); err != nil {
+		return err
+	}
+
+	if c.local != nil {
+		c.local.set(key, notFoundPlaceholder)
+	}
+
+	return nil
+}
+
+// setRedis sets data with the randomized seconds, lengthened by the stale window.
+func (c Cache) setRedis(key, data string, seconds int) error {
+	if seconds > 0 {
+		staleSeconds := int((c.stale + time.Second - 1) / time.Second)
+		return c.rds.Setex(key, data, c.randomize(seconds)+staleSeconds)
+	} else {
+		return c.rds.Set(key, data)
+	}
+}
+
+func (c Cache) takeLocal(key string) (string, bool) {
+	if c.local == nil {
+		return "", false
+	}
+
+	return c.local.get(key)
+}
+
+// claim takes the barrier of key for the batch, returns false with the result of the ongoing call of key
+// if it's taken by others. The barrier is held until the batch finishes.
+func (b *batchLoad) claim(barrier syncx.ExclusiveCalls, key string) (flightResult, bool) {
+	claimed := make(chan struct{})
+	joined := make(chan flightResult, 1)
+	threading.GoSafe(func() {
+		val, fresh, err := barrier.DoEx(key, func() (interface{}, error) {
+			close(claimed)
+			<-b.done
+			return b.result(key)
+		})
+		if !fresh {
+			joined <- flightResult{val: val, err: err}
+		}
+	})
+
+	select {
+	case <-claimed:
+		return flightResult{}, true
+	case res := <-joined:
+		return res, false
+	}
+}
+
+// finish releases the barriers of the batch, the waiting calls get the results of their keys.
+// Only the first call takes effect.
+func (b *batchLoad) finish(err error) {
+	b.once.Do(func() {
+		b.err = err
+		close(b.done)
+	})
+}
+
+// result returns the marshaled value of key, shared with the ongoing Take calls of it,
+// must be called after the batch finished.
+func (b *batchLoad) result(key string) (interface{}, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	val := b.loaded.MapIndex(reflect.ValueOf(key))
+	if !val.IsValid() {
+		return nil, ErrNotFound
+	}
+
+	return json.Marshal(val.Interface())
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// WithExpiryDeviation randomizes the expiries in [(1-deviation)*seconds, (1+deviation)*seconds],
+// 0 to disable it, defaults to 0.05.
+func WithExpiryDeviation(deviation float64) CacheOption {
+	return func(cache *Cache) {
+		cache.expiryDeviation = deviation
+	}
+}
+
+// WithLocalCache puts local in front of redis.
+func WithLocalCache(local *LocalCache) CacheOption {
+	return func(cache *Cache) {
+		cache.local = local
+	}
+}
+
+// WithStaleWhileRevalidate keeps the values stale longer than their seconds in redis, the stale values
+// taken are served while refreshed by a single background query. The values taken by TakeMany are not
+// refreshed, they are served until expired.
+func WithStaleWhileRevalidate(stale time.Duration) CacheOption {
+	return func(cache *Cache) {
+		cache.stale = stale
+	}
+}
+
+// WithRefreshTimeout sets the timeout of the background refreshes, defaults to 5 seconds.
+func WithRefreshTimeout(timeout time.Duration) CacheOption {
+	return func(cache *Cache) {
+		cache.refreshTimeout = timeout
+	}
+}
+
+func unique(keys []string) []string {
+	set := make(map[string]struct{}, len(keys))
+	var ret []string
+	for _, key := range keys {
+		if _, ok := set[key]; !ok {
+			set[key] = struct{}{}
+			ret = append(ret, key)
+		}
 	}
 
-	return json.Unmarshal([]byte(data), v)
+	return ret
 }
@@ -0,0 +1,639 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/stores/redis/redistest"
+	"github.com/vsaien/cuter/lib/syncx"
+)
+
+type user struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestCacheTakeMany(t *testing.T) {
+	s, c := newTestCache(t)
+	defer s.Close()
+
+	s.Set("user#1", `{"id":1,"name":"foo"}`)
+	s.Set("user#2", notFoundPlaceholder)
+
+	var queried [][]string
+	var result map[string]user
+	err := c.TakeMany(&result, []string{"user#1", "user#2", "user#4", "user#3", "user#1"}, 100,
+		func(v interface{}, keys []string) error {
+			queried = append(queried, keys)
+			*v.(*[]user) = []user{
+				{Id: 3, Name: "bar"},
+				{Id: 5, Name: "not wanted"},
+			}
+			return nil
+		}, userKey)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"user#3", "user#4"}}, queried)
+	assert.Equal(t, map[string]user{
+		"user#1": {Id: 1, Name: "foo"},
+		"user#3": {Id: 3, Name: "bar"},
+	}, result)
+
+	val, ok := s.Get("user#3")
+	assert.True(t, ok)
+	assert.Equal(t, `{"id":3,"name":"bar"}`, val)
+	assert.True(t, s.TTL("user#3") > 94*time.Second && s.TTL("user#3") <= 105*time.Second)
+	val, ok = s.Get("user#4")
+	assert.True(t, ok)
+	assert.Equal(t, notFoundPlaceholder, val)
+	assert.True(t, s.TTL("user#4") <= 63*time.Second)
+	_, ok = s.Get("user#5")
+	assert.False(t, ok)
+
+	// all taken from cache
+	result = nil
+	err = c.TakeMany(&result, []string{"user#1", "user#3", "user#4"}, 100,
+		func(v interface{}, keys []string) error {
+			t.Fatal("should not query")
+			return nil
+		}, userKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result))
+}
+
+func TestCacheTakeManyPointers(t *testing.T) {
+	s, c := newTestCache(t)
+	defer s.Close()
+
+	result := make(map[string]*user)
+	err := c.TakeMany(&result, []string{"user#1"}, 100, func(v interface{}, keys []string) error {
+		*v.(*[]*user) = []*user{{Id: 1, Name: "foo"}}
+		return nil
+	}, func(row interface{}) string {
+		return userKey(*row.(*user))
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", result["user#1"].Name)
+}
+
+func TestCacheTakeManyBadValue(t *testing.T) {
+	s, c := newTestCache(t)
+	defer s.Close()
+
+	s.Set("user#1", "bad")
+	var result map[string]user
+	err := c.TakeMany(&result, []string{"user#1"}, 100, func(v interface{}, keys []string) error {
+		*v.(*[]user) = []user{{Id: 1, Name: "foo"}}
+		return nil
+	}, userKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", result["user#1"].Name)
+	val, _ := s.Get("user#1")
+	assert.Equal(t, `{"id":1,"name":"foo"}`, val)
+}
+
+func TestCacheTakeManyErrors(t *testing.T) {
+	s, c := newTestCache(t)
+	defer s.Close()
+
+	var users []user
+	assert.NotNil(t, c.TakeMany(&users, []string{"user#1"}, 100, nil, userKey))
+
+	errDb := errors.New("db down")
+	var result map[string]user
+	err := c.TakeMany(&result, []string{"user#1"}, 100, func(v interface{}, keys []string) error {
+		return errDb
+	}, userKey)
+	assert.Equal(t, errDb, err)
+	assert.Equal(t, uint64(1), c.stat.DbFails)
+	_, ok := s.Get("user#1")
+	assert.False(t, ok)
+
+	s.Close()
+	err = c.TakeMany(&result, []string{"user#1"}, 100, func(v interface{}, keys []string) error {
+		t.Fatal("should not query on cache failures")
+		return nil
+	}, userKey)
+	assert.NotNil(t, err)
+}
+
+func TestCacheTakeManyPanics(t *testing.T) {
+	s, c := newTestCache(t)
+	defer s.Close()
+
+	var result map[string]user
+	assert.Panics(t, func() {
+		c.TakeMany(&result, []string{"user#1"}, 100, func(v interface{}, keys []string) error {
+			panic("db panics")
+		}, userKey)
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.TakeMany(&result, []string{"user#1"}, 100, func(v interface{}, keys []string) error {
+			*v.(*[]user) = []user{{Id: 1}}
+			return nil
+		}, userKey)
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+		assert.Equal(t, user{Id: 1}, result["user#1"])
+	case <-time.After(time.Second):
+		t.Fatal("the barrier of the panicked loading should be released")
+	}
+}
+
+func TestCacheTakeManyExclusive(t *testing.T) {
+	s, c := newTestCache(t)
+	defer s.Close()
+
+	const goroutines = 10
+	var queries int32
+	var start, wg sync.WaitGroup
+	start.Add(1)
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			start.Wait()
+
+			var result map[string]user
+			err := c.TakeMany(&result, []string{"user#2", "user#1"}, 100, func(v interface{}, keys []string) error {
+				atomic.AddInt32(&queries, 1)
+				time.Sleep(100 * time.Millisecond)
+				*v.(*[]user) = []user{{Id: 1}, {Id: 2}}
+				return nil
+			}, userKey)
+			assert.Nil(t, err)
+			assert.Equal(t, 2, len(result))
+		}()
+	}
+	start.Done()
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&queries))
+}
+
+func TestCacheTakeManySharesTake(t *testing.T) {
+	s, c := newTestCache(t)
+	defer s.Close()
+
+	taking := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var u user
+		assert.Nil(t, c.Take(&u, "user#1", 100, func(v interface{}) error {
+			close(taking)
+			time.Sleep(100 * time.Millisecond)
+			*v.(*user) = user{Id: 1, Name: "foo"}
+			return nil
+		}))
+	}()
+
+	<-taking
+	var result map[string]user
+	err := c.TakeMany(&result, []string{"user#1", "user#2"}, 100, func(v interface{}, keys []string) error {
+		assert.Equal(t, []string{"user#2"}, keys)
+		*v.(*[]user) = []user{{Id: 2, Name: "bar"}}
+		return nil
+	}, userKey)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]user{
+		"user#1": {Id: 1, Name: "foo"},
+		"user#2": {Id: 2, Name: "bar"},
+	}, result)
+	<-done
+}
+
+func TestCacheTakeWaitsTakeMany(t *testing.T) {
+	s, c := newTestCache(t)
+	defer s.Close()
+
+	querying := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var result map[string]user
+		assert.Nil(t, c.TakeMany(&result, []string{"user#1", "user#2"}, 100,
+			func(v interface{}, keys []string) error {
+				close(querying)
+				time.Sleep(100 * time.Millisecond)
+				*v.(*[]user) = []user{{Id: 2, Name: "bar"}}
+				return nil
+			}, userKey))
+	}()
+
+	<-querying
+	// each key of the batch is waited, not only the first one
+	var u user
+	assert.Equal(t, ErrNotFound, c.Take(&u, "user#1", 100, func(v interface{}) error {
+		t.Fatal("should wait for the batch")
+		return nil
+	}))
+	assert.Nil(t, c.Take(&u, "user#2", 100, func(v interface{}) error {
+		t.Fatal("should wait for the batch")
+		return nil
+	}))
+	assert.Equal(t, user{Id: 2, Name: "bar"}, u)
+	<-done
+}
+
+func TestCacheTakeManyOverlapped(t *testing.T) {
+	s, c := newTestCache(t)
+	defer s.Close()
+
+	var lock sync.Mutex
+	queried := make(map[string]int)
+	query := func(v interface{}, keys []string) error {
+		lock.Lock()
+		for _, key := range keys {
+			queried[key]++
+		}
+		lock.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+		var users []user
+		for _, key := range keys {
+			var id int
+			fmt.Sscanf(key, "user#%d", &id)
+			users = append(users, user{Id: id})
+		}
+		*v.(*[]user) = users
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for _, keys := range [][]string{
+		{"user#1", "user#2", "user#3"},
+		{"user#3", "user#2"},
+		{"user#2", "user#4"},
+		{"user#4", "user#1"},
+	} {
+		keys := keys
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result map[string]user
+			assert.Nil(t, c.TakeMany(&result, keys, 100, query, userKey))
+			assert.Equal(t, len(keys), len(result))
+		}()
+	}
+	wg.Wait()
+
+	for _, key := range []string{"user#1", "user#2", "user#3", "user#4"} {
+		assert.Equal(t, 1, queried[key], key)
+	}
+}
+
+func newTestCache(t *testing.T) (*redistest.Server, Cache) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+
+	var stat CacheStat
+	return s, NewCache(redis.NewRedis(s.Addr(), redis.NodeType), syncx.NewExclusiveCalls(), &stat)
+}
+
+func userKey(row interface{}) string {
+	data, _ := json.Marshal(row.(user).Id)
+	return strings.Join([]string{"user", string(data)}, "#")
+}
+
+func TestCacheWithLocalCache(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	newCache := func() Cache {
+		local, err := NewLocalCache(rds, "deletion", time.Minute, 10)
+		assert.Nil(t, err)
+		var stat CacheStat
+		return NewCache(rds, syncx.NewExclusiveCalls(), &stat, WithLocalCache(local))
+	}
+	c1 := newCache()
+	defer c1.local.Close()
+	c2 := newCache()
+	defer c2.local.Close()
+	// the local caches share one subscription
+	waitSubscribers(t, rds, "deletion", 1)
+
+	var queries int
+	take := func(c Cache) user {
+		var u user
+		assert.Nil(t, c.Take(&u, "user#1", 100, func(v interface{}) error {
+			queries++
+			*v.(*user) = user{Id: 1, Name: "foo"}
+			return nil
+		}))
+		return u
+	}
+	assert.Equal(t, "foo", take(c1).Name)
+	assert.Equal(t, "foo", take(c2).Name)
+	assert.Equal(t, 1, queries)
+
+	// served by the local caches without reading redis
+	s.Set("user#1", `{"id":1,"name":"bar"}`)
+	assert.Equal(t, "foo", take(c1).Name)
+	assert.Equal(t, "foo", take(c2).Name)
+
+	// the deletion on c1 drops the local cache of c2
+	assert.Nil(t, c1.DelCache("user#1"))
+	_, ok := s.Get("user#1")
+	assert.False(t, ok)
+	for i := 0; i < 100; i++ {
+		if _, ok = c2.local.get("user#1"); !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, ok)
+	assert.Equal(t, "foo", take(c2).Name)
+	assert.Equal(t, 2, queries)
+
+	// not found placeholders are cached locally too
+	var u user
+	assert.Equal(t, ErrNotFound, c1.Take(&u, "user#2", 100, func(v interface{}) error {
+		return ErrNotFound
+	}))
+	s.Set("user#2", `{"id":2,"name":"bar"}`)
+	assert.Equal(t, ErrNotFound, c1.Take(&u, "user#2", 100, func(v interface{}) error {
+		t.Fatal("should not query")
+		return nil
+	}))
+
+	// TakeMany reads the local caches first
+	var result map[string]user
+	assert.Nil(t, c1.TakeMany(&result, []string{"user#1", "user#2", "user#3"}, 100,
+		func(v interface{}, keys []string) error {
+			assert.Equal(t, []string{"user#3"}, keys)
+			*v.(*[]user) = []user{{Id: 3, Name: "baz"}}
+			return nil
+		}, userKey))
+	assert.Equal(t, map[string]user{
+		"user#1": {Id: 1, Name: "foo"},
+		"user#3": {Id: 3, Name: "baz"},
+	}, result)
+	val, ok := c1.local.get("user#3")
+	assert.True(t, ok)
+	assert.Equal(t, `{"id":3,"name":"baz"}`, val)
+
+	// the not found placeholders set on c1 drop the local cache of c2
+	_, ok = c2.local.get("user#1")
+	assert.True(t, ok)
+	assert.Nil(t, c1.SetCacheWithNotFound("user#1"))
+	for i := 0; i < 100; i++ {
+		if _, ok = c2.local.get("user#1"); !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, ok)
+	assert.Equal(t, ErrNotFound, c2.Take(&u, "user#1", 100, func(v interface{}) error {
+		t.Fatal("should not query")
+		return nil
+	}))
+}
+
+func TestLocalCacheClose(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	l1, err := NewLocalCache(rds, "closing", time.Minute, 10)
+	assert.Nil(t, err)
+	l2, err := NewLocalCache(rds, "closing", time.Minute, 10)
+	assert.Nil(t, err)
+	assert.True(t, l1.broadcaster == l2.broadcaster)
+	waitSubscribers(t, rds, "closing", 1)
+
+	// still subscribed by l2
+	assert.Nil(t, l1.Close())
+	assert.Nil(t, l1.Close())
+	waitSubscribers(t, rds, "closing", 1)
+	l2.set("key", "val")
+	l1.Del("key")
+	for i := 0; i < 100; i++ {
+		if _, ok := l2.get("key"); !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, ok := l2.get("key")
+	assert.False(t, ok)
+
+	assert.Nil(t, l2.Close())
+	waitSubscribers(t, rds, "closing", 0)
+
+	// subscribed again by the later ones
+	l3, err := NewLocalCache(rds, "closing", time.Minute, 10)
+	assert.Nil(t, err)
+	defer l3.Close()
+	assert.True(t, l1.broadcaster != l3.broadcaster)
+	waitSubscribers(t, rds, "closing", 1)
+}
+
+func TestLocalCacheSubscribeRetry(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	var attempts int32
+	subscribe := subscribeChannel
+	subscribeChannel = func(rds *redis.Redis, channel string,
+		handle func(channel, message string)) (*redis.Subscription, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return nil, errors.New("subscribing failed")
+		}
+		return subscribe(rds, channel, handle)
+	}
+	defer func() {
+		subscribeChannel = subscribe
+	}()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	local, err := NewLocalCache(rds, "retrying", time.Minute, 10)
+	assert.Nil(t, err)
+	defer local.Close()
+
+	// bypassed before subscribed
+	local.set("key", "val")
+	_, ok := local.get("key")
+	assert.False(t, ok)
+
+	waitSubscribers(t, rds, "retrying", 1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	local.set("key", "val")
+	val, ok := local.get("key")
+	assert.True(t, ok)
+	assert.Equal(t, "val", val)
+}
+
+func TestLocalCacheCloseStopsRetries(t *testing.T) {
+	var attempts int32
+	subscribe := subscribeChannel
+	subscribeChannel = func(rds *redis.Redis, channel string,
+		handle func(channel, message string)) (*redis.Subscription, error) {
+		atomic.AddInt32(&attempts, 1)
+		return nil, errors.New("subscribing failed")
+	}
+	defer func() {
+		subscribeChannel = subscribe
+	}()
+
+	local, err := NewLocalCache(redis.NewRedis("localhost:1", redis.NodeType), "stopping", time.Minute, 10)
+	assert.Nil(t, err)
+	assert.Nil(t, local.Close())
+	time.Sleep(minSubscribeBackoff + 100*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func waitSubscribers(t *testing.T, rds *redis.Redis, channel string, count int64) {
+	var n int64
+	for i := 0; i < 300 && n < count; i++ {
+		var err error
+		n, err = rds.Publish(channel, "")
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, count, n)
+}
+
+func TestCacheExpiryDeviation(t *testing.T) {
+	var stat CacheStat
+	c := NewCache(nil, syncx.NewExclusiveCalls(), &stat)
+	seen := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		seconds := c.randomize(100)
+		assert.True(t, seconds >= 95 && seconds <= 105)
+		seen[seconds] = true
+	}
+	assert.True(t, len(seen) > 1)
+
+	assert.Equal(t, 1, c.randomize(1))
+	c = NewCache(nil, syncx.NewExclusiveCalls(), &stat, WithExpiryDeviation(0))
+	assert.Equal(t, 100, c.randomize(100))
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	var stat CacheStat
+	c := NewCache(redis.NewRedis(s.Addr(), redis.NodeType), syncx.NewExclusiveCalls(), &stat,
+		WithExpiryDeviation(0), WithStaleWhileRevalidate(10*time.Second))
+
+	var queries int32
+	release := make(chan struct{})
+	take := func() user {
+		var u user
+		assert.Nil(t, c.Take(&u, "user#1", 100, func(v interface{}) error {
+			n := atomic.AddInt32(&queries, 1)
+			if n > 1 {
+				// hold the refresh
+				<-release
+			}
+			*v.(*user) = user{Id: 1, Name: fmt.Sprintf("v%d", n)}
+			return nil
+		}))
+		return u
+	}
+
+	assert.Equal(t, "v1", take().Name)
+	ttl := s.TTL("user#1")
+	assert.True(t, ttl > 109*time.Second && ttl <= 110*time.Second)
+	assert.Equal(t, "v1", take().Name)
+	assert.Equal(t, uint64(0), atomic.LoadUint64(&stat.StaleQueries))
+
+	// in the stale window, the stale value is served while refreshing once
+	s.FastForward(105 * time.Second)
+	assert.Equal(t, "v1", take().Name)
+	assert.Equal(t, "v1", take().Name)
+	close(release)
+	for i := 0; i < 100; i++ {
+		if _, ok := c.refreshing.Load("user#1"); !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, "v2", take().Name)
+	assert.True(t, s.TTL("user#1") > 109*time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&queries))
+	assert.Equal(t, uint64(2), atomic.LoadUint64(&stat.StaleQueries))
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&stat.Refreshes))
+	assert.Equal(t, uint64(0), atomic.LoadUint64(&stat.RefreshFails))
+}
+
+func TestCacheRefreshDetached(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	var stat CacheStat
+	c := NewCache(redis.NewRedis(s.Addr(), redis.NodeType), syncx.NewExclusiveCalls(), &stat,
+		WithExpiryDeviation(0), WithStaleWhileRevalidate(10*time.Second), WithRefreshTimeout(time.Second))
+	type ctxKey struct{}
+	refreshed := make(chan context.Context, 1)
+	take := func(ctx context.Context) {
+		var u user
+		assert.Nil(t, c.TakeCtx(ctx, &u, "user#1", 100, func(ctx context.Context, v interface{}) error {
+			if atomic.LoadUint64(&stat.Refreshes) > 0 {
+				refreshed <- ctx
+			}
+			*v.(*user) = user{Id: 1}
+			return nil
+		}))
+	}
+
+	take(context.Background())
+	s.FastForward(105 * time.Second)
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "foo"))
+	take(ctx)
+	// the refresh is not canceled with the taking call
+	cancel()
+
+	refreshCtx := <-refreshed
+	assert.Nil(t, refreshCtx.Err())
+	assert.Equal(t, "foo", refreshCtx.Value(ctxKey{}))
+	deadline, ok := refreshCtx.Deadline()
+	assert.True(t, ok)
+	assert.True(t, time.Until(deadline) <= time.Second)
+}
+
+func TestCacheRefreshFails(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	var stat CacheStat
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	c := NewCache(rds, syncx.NewExclusiveCalls(), &stat, WithStaleWhileRevalidate(10*time.Second))
+	assert.Nil(t, rds.Setex("user#1", `{"id":1,"name":"foo"}`, 5))
+
+	done := make(chan struct{})
+	var u user
+	assert.Nil(t, c.Take(&u, "user#1", 100, func(v interface{}) error {
+		defer close(done)
+		return errors.New("db down")
+	}))
+	assert.Equal(t, "foo", u.Name)
+	<-done
+	for i := 0; i < 100 && atomic.LoadUint64(&stat.RefreshFails) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&stat.RefreshFails))
+	val, _ := s.Get("user#1")
+	assert.Equal(t, `{"id":1,"name":"foo"}`, val)
+}
@@ -17,6 +17,10 @@ type CacheStat struct {
 	CacheQueries uint64
 	CacheFails   uint64
 	DbFails      uint64
+	// the hits on the values to be expired, served while refreshing
+	StaleQueries uint64
+	Refreshes    uint64
+	RefreshFails uint64
 }
 
 func NewCacheStat(name string) CacheStat {
@@ -44,6 +48,18 @@ func (cs *CacheStat) IncrementDbFails() {
 	atomic.AddUint64(&cs.DbFails, 1)
 }
 
+func (cs *CacheStat) IncrementStale() {
+	atomic.AddUint64(&cs.StaleQueries, 1)
+}
+
+func (cs *CacheStat) IncrementRefresh() {
+	atomic.AddUint64(&cs.Refreshes, 1)
+}
+
+func (cs *CacheStat) IncrementRefreshFails() {
+	atomic.AddUint64(&cs.RefreshFails, 1)
+}
+
 func (cs *CacheStat) statLoop() {
 	ticker := time.NewTicker(statInterval)
 	defer ticker.Stop()
@@ -60,8 +76,12 @@ func (cs *CacheStat) statLoop() {
 			percent := 100 * float32(cache) / float32(total)
 			cachef := atomic.SwapUint64(&cs.CacheFails, 0)
 			dbf := atomic.SwapUint64(&cs.DbFails, 0)
-			logx.Statf("(%s) - qpm: %d, cached: %d, cache_percent: %.1f%%, cache_fails: %d, db_fails: %d",
-				cs.name, total, cache, percent, cachef, dbf)
+			stale := atomic.SwapUint64(&cs.StaleQueries, 0)
+			refreshes := atomic.SwapUint64(&cs.Refreshes, 0)
+			refreshf := atomic.SwapUint64(&cs.RefreshFails, 0)
+			logx.Statf("(%s) - qpm: %d, cached: %d, cache_percent: %.1f%%, cache_fails: %d, db_fails: %d, "+
+				"stale: %d, refreshes: %d, refresh_fails: %d",
+				cs.name, total, cache, percent, cachef, dbf, stale, refreshes, refreshf)
 		}
 	}
 }
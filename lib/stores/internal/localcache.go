@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vsaien/cuter/lib/collection"
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/threading"
+)
+
+const (
+	minSubscribeBackoff = time.Second
+	maxSubscribeBackoff = time.Minute
+)
+
+var (
+	broadcasters     = make(map[string]*broadcaster)
+	broadcastersLock sync.Mutex
+	// subscribeChannel is replaceable in the tests to fail subscribing
+	subscribeChannel subscribeFunc = func(rds *redis.Redis, channel string,
+		handle func(channel, message string)) (*redis.Subscription, error) {
+		return rds.Subscribe(handle, channel)
+	}
+)
+
+type (
+	subscribeFunc func(rds *redis.Redis, channel string, handle func(channel, message string)) (
+		*redis.Subscription, error)
+
+	// LocalCache is the in-process cache in front of redis, which saves the round trips of the hot keys.
+	// The keys deleted on one instance are broadcast over the redis channel to be dropped on the others,
+	// the messages lost on disconnections are covered by the short expiry of the entries.
+	LocalCache struct {
+		cache       *collection.Cache
+		broadcaster *broadcaster
+		once        sync.Once
+	}
+
+	// broadcaster broadcasts the deletions over a channel of a redis, the local caches on the same
+	// redis and channel share one subscription, which is closed after all of them are closed.
+	// The local caches are bypassed until subscribed, because the deletions of the others are missed.
+	broadcaster struct {
+		key     string
+		rds     *redis.Redis
+		channel string
+		sub     *redis.Subscription
+		caches  map[*collection.Cache]struct{}
+		done    chan struct{}
+		lock    sync.RWMutex
+	}
+)
+
+// NewLocalCache creates a LocalCache with at most limit entries, which expire after expire,
+// the deletions are broadcast over channel. If subscribing channel fails, the error is logged and
+// retried with backoff in background, the LocalCache is bypassed until subscribed.
+func NewLocalCache(rds *redis.Redis, channel string, expire time.Duration, limit int) (*LocalCache, error) {
+	cache, err := collection.NewCache(expire, collection.WithLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalCache{
+		cache:       cache,
+		broadcaster: joinBroadcaster(rds, channel, cache),
+	}, nil
+}
+
+// Close stops receiving the deletions of the other instances, the LocalCache should not be used after.
+func (lc *LocalCache) Close() error {
+	var err error
+	lc.once.Do(func() {
+		err = lc.broadcaster.leave(lc.cache)
+	})
+
+	return err
+}
+
+// Del deletes key on all the instances.
+func (lc *LocalCache) Del(key string) {
+	lc.cache.Del(key)
+	lc.broadcaster.publish(key)
+}
+
+func (lc *LocalCache) get(key string) (string, bool) {
+	if !lc.broadcaster.subscribed() {
+		return "", false
+	}
+
+	val, ok := lc.cache.Get(key)
+	if !ok {
+		return "", false
+	}
+
+	return val.(string), true
+}
+
+func (lc *LocalCache) set(key, val string) {
+	if lc.broadcaster.subscribed() {
+		lc.cache.Set(key, val)
+	}
+}
+
+// joinBroadcaster registers cache on the broadcaster of rds and channel, subscribes channel if
+// it's the first one.
+func joinBroadcaster(rds *redis.Redis, channel string, cache *collection.Cache) *broadcaster {
+	key := rds.RedisType + "#" + rds.RedisAddr + "#" + channel
+
+	broadcastersLock.Lock()
+	defer broadcastersLock.Unlock()
+
+	b, ok := broadcasters[key]
+	if !ok {
+		b = &broadcaster{
+			key:     key,
+			rds:     rds,
+			channel: channel,
+			caches:  make(map[*collection.Cache]struct{}),
+			done:    make(chan struct{}),
+		}
+		subscribe := subscribeChannel
+		if !b.trySubscribe(subscribe) {
+			threading.GoSafe(func() {
+				b.resubscribe(subscribe)
+			})
+		}
+		broadcasters[key] = b
+	}
+
+	b.lock.Lock()
+	b.caches[cache] = struct{}{}
+	b.lock.Unlock()
+
+	return b
+}
+
+// drop deletes key from the local caches, the ones of the other instances included.
+func (b *broadcaster) drop(key string) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for cache := range b.caches {
+		cache.Del(key)
+	}
+}
+
+// leave unregisters cache, and unsubscribes the channel if it's the last one.
+func (b *broadcaster) leave(cache *collection.Cache) error {
+	broadcastersLock.Lock()
+	defer broadcastersLock.Unlock()
+
+	b.lock.Lock()
+	delete(b.caches, cache)
+	if len(b.caches) > 0 {
+		b.lock.Unlock()
+		return nil
+	}
+
+	close(b.done)
+	sub := b.sub
+	b.lock.Unlock()
+
+	delete(broadcasters, b.key)
+	if sub == nil {
+		return nil
+	}
+
+	return sub.Close()
+}
+
+func (b *broadcaster) publish(key string) {
+	if _, err := b.rds.Publish(b.channel, key); err != nil {
+		logx.Errorf("broadcast deletion of key %s failed: %s", key, err)
+	}
+}
+
+// resubscribe retries subscribing with backoff until subscribed or all the local caches left.
+func (b *broadcaster) resubscribe(subscribe subscribeFunc) {
+	backoff := minSubscribeBackoff
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-b.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if b.trySubscribe(subscribe) {
+			return
+		}
+
+		if backoff *= 2; backoff > maxSubscribeBackoff {
+			backoff = maxSubscribeBackoff
+		}
+	}
+}
+
+func (b *broadcaster) subscribed() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.sub != nil
+}
+
+// trySubscribe subscribes the channel, returns true if subscribed or all the local caches left.
+func (b *broadcaster) trySubscribe(subscribe subscribeFunc) bool {
+	sub, err := subscribe(b.rds, b.channel, func(_, key string) {
+		b.drop(key)
+	})
+	if err != nil {
+		logx.Errorf("local cache on redis %s bypassed, subscribing channel %s failed: %s",
+			b.rds.RedisAddr, b.channel, err)
+		return false
+	}
+
+	b.lock.Lock()
+	select {
+	case <-b.done:
+		b.lock.Unlock()
+		if err := sub.Close(); err != nil {
+			logx.Error(err)
+		}
+	default:
+		b.sub = sub
+		b.lock.Unlock()
+	}
+
+	return true
+}
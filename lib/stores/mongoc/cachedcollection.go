@@ -21,10 +21,15 @@ type CachedCollection struct {
 	cache      internal.Cache
 }
 
-func newCachedCollection(collection mongo.Collection, rds *redis.Redis) CachedCollection {
+func newCachedCollection(collection mongo.Collection, rds *redis.Redis, local *internal.LocalCache) CachedCollection {
+	var opts []internal.CacheOption
+	if local != nil {
+		opts = append(opts, internal.WithLocalCache(local))
+	}
+
 	return CachedCollection{
 		collection: collection,
-		cache:      internal.NewCache(rds, exclusiveCalls, &stat),
+		cache:      internal.NewCache(rds, exclusiveCalls, &stat, opts...),
 	}
 }
 
@@ -1,15 +1,23 @@
 package mongoc
 
 import (
+	"time"
+
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/stores/internal"
 	"github.com/vsaien/cuter/lib/stores/mongo"
 	"github.com/vsaien/cuter/lib/stores/redis"
 
 	"gopkg.in/mgo.v2"
 )
 
+// the channel to broadcast the deletions of the local caches
+const localCacheChannel = "mongoc#cache#deletion"
+
 type Model struct {
 	*mongo.Model
-	rds *redis.Redis
+	rds   *redis.Redis
+	local *internal.LocalCache
 }
 
 func NewModel(db *mgo.Database, collection string, rds *redis.Redis, opts ...mongo.Option) *Model {
@@ -20,7 +28,34 @@ func NewModel(db *mgo.Database, collection string, rds *redis.Redis, opts ...mon
 	}
 }
 
+// NewModelWithLocalCache returns a Model which caches at most limit documents in process for expire
+// in front of redis. The documents deleted by DelCache and the DropCache methods are dropped on all
+// the instances, but the ones changed without them are stale until expired, so keep expire short.
+// If subscribing on rds fails, the local cache is bypassed until subscribed by the retries in background.
+// Close the Model if it's not used anymore.
+func NewModelWithLocalCache(db *mgo.Database, collection string, rds *redis.Redis, expire time.Duration,
+	limit int, opts ...mongo.Option) *Model {
+	model := NewModel(db, collection, rds, opts...)
+	local, err := internal.NewLocalCache(rds, localCacheChannel, expire, limit)
+	if err != nil {
+		logx.Errorf("local cache on redis %s disabled: %s", rds.RedisAddr, err.Error())
+	} else {
+		model.local = local
+	}
+
+	return model
+}
+
+// Close releases the local cache, the underlying session is not closed.
+func (mm *Model) Close() error {
+	if mm.local == nil {
+		return nil
+	}
+
+	return mm.local.Close()
+}
+
 func (mm *Model) GetCollection(session *mgo.Session) CachedCollection {
 	collection := mm.Model.GetCollection(session)
-	return newCachedCollection(collection, mm.rds)
+	return newCachedCollection(collection, mm.rds, mm.local)
 }
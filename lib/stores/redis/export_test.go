@@ -0,0 +1,11 @@
+package redis
+
+// exported for the tests in package redis_test
+var (
+	AcquireBackoff     = acquireBackoff
+	CloseSubscriptions = closeSubscriptions
+	FencingKey         = fencingKey
+	LiveSubscriptions  = liveSubscriptions
+	MaxAcquireBackoff  = maxAcquireBackoff
+	MinAcquireBackoff  = minAcquireBackoff
+)
@@ -0,0 +1,198 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vsaien/cuter/lib/breaker"
+	"github.com/vsaien/cuter/lib/logx"
+
+	red "github.com/go-redis/redis"
+)
+
+type (
+	// Pipeliner queues the commands to be sent to redis in one round trip.
+	Pipeliner = red.Pipeliner
+
+	// PipelineResults holds the results of the pipelined commands in the queued order.
+	PipelineResults []red.Cmder
+)
+
+// Pipelined sends the commands queued by fn in one round trip. The commands of the cluster type
+// are grouped by nodes. The returned error is the one of the first failed command, red.Nil of
+// the missing keys is not taken as failures, the results of each command are taken by the typed
+// accessors of the results.
+func (s *Redis) Pipelined(fn func(Pipeliner) error) (PipelineResults, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.execPipeline(conn.Pipeline(), fn)
+}
+
+// TxPipelined is the same as Pipelined, but the commands are wrapped by MULTI/EXEC to be executed
+// atomically. The keys of the cluster type must reside in the same slot, like using the hash tags.
+func (s *Redis) TxPipelined(fn func(Pipeliner) error) (PipelineResults, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.execPipeline(conn.TxPipeline(), fn)
+}
+
+// execPipeline executes the commands queued by fn in pipe, which are protected by the breaker
+// and logged if slow.
+func (s *Redis) execPipeline(pipe Pipeliner, fn func(Pipeliner) error) (PipelineResults, error) {
+	defer pipe.Close()
+
+	if err := fn(pipe); err != nil {
+		return nil, err
+	}
+
+	var cmds []red.Cmder
+	start := time.Now()
+	err := breaker.DoWithAcceptable(s.RedisAddr, func() error {
+		var err error
+		cmds, err = pipe.Exec()
+		return err
+	}, acceptable)
+	if duration := time.Since(start); duration > slowThreshold {
+		logx.Slowf("[REDIS] slowcall(%s) on executing pipeline: %s", duration, formatCmds(cmds))
+	}
+	if err != red.Nil {
+		return cmds, err
+	}
+
+	// Exec reports the first error of the commands, which might be red.Nil followed by real errors
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != red.Nil {
+			return cmds, err
+		}
+	}
+
+	return cmds, nil
+}
+
+func (r PipelineResults) Len() int {
+	return len(r)
+}
+
+// Err returns the error of the ith command, nil on red.Nil.
+func (r PipelineResults) Err(i int) error {
+	if err := r[i].Err(); err != red.Nil {
+		return err
+	}
+
+	return nil
+}
+
+// Bool returns the result of the ith command as bool, like SETNX, EXPIRE and SISMEMBER.
+func (r PipelineResults) Bool(i int) (bool, error) {
+	switch cmd := r[i].(type) {
+	case *red.BoolCmd:
+		return cmd.Result()
+	case *red.IntCmd:
+		val, err := cmd.Result()
+		return val != 0, err
+	default:
+		return false, typeError(i, cmd, "bool")
+	}
+}
+
+// Float64 returns the result of the ith command as float64, like INCRBYFLOAT and ZSCORE,
+// 0 on missing keys.
+func (r PipelineResults) Float64(i int) (float64, error) {
+	switch cmd := r[i].(type) {
+	case *red.FloatCmd:
+		val, err := cmd.Result()
+		if err == red.Nil {
+			return 0, nil
+		}
+		return val, err
+	case *red.StringCmd:
+		val, err := r.String(i)
+		if err != nil || len(val) == 0 {
+			return 0, err
+		}
+		return strconv.ParseFloat(val, 64)
+	default:
+		return 0, typeError(i, cmd, "float64")
+	}
+}
+
+// Int64 returns the result of the ith command as int64, like INCR, DEL and the GET of integers,
+// 0 on missing keys.
+func (r PipelineResults) Int64(i int) (int64, error) {
+	switch cmd := r[i].(type) {
+	case *red.IntCmd:
+		return cmd.Result()
+	case *red.StringCmd:
+		val, err := r.String(i)
+		if err != nil || len(val) == 0 {
+			return 0, err
+		}
+		return strconv.ParseInt(val, 10, 64)
+	default:
+		return 0, typeError(i, cmd, "int64")
+	}
+}
+
+// String returns the result of the ith command as string, like GET and HGET, empty on missing keys.
+func (r PipelineResults) String(i int) (string, error) {
+	switch cmd := r[i].(type) {
+	case *red.StringCmd:
+		val, err := cmd.Result()
+		if err == red.Nil {
+			return "", nil
+		}
+		return val, err
+	case *red.StatusCmd:
+		return cmd.Result()
+	default:
+		return "", typeError(i, cmd, "string")
+	}
+}
+
+// StringMap returns the result of the ith command as map, like HGETALL.
+func (r PipelineResults) StringMap(i int) (map[string]string, error) {
+	switch cmd := r[i].(type) {
+	case *red.StringStringMapCmd:
+		return cmd.Result()
+	default:
+		return nil, typeError(i, cmd, "map[string]string")
+	}
+}
+
+// Strings returns the result of the ith command as strings, like MGET, LRANGE and SMEMBERS,
+// the missing values of MGET are empty.
+func (r PipelineResults) Strings(i int) ([]string, error) {
+	switch cmd := r[i].(type) {
+	case *red.StringSliceCmd:
+		return cmd.Result()
+	case *red.SliceCmd:
+		vals, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+		return toStrings(vals), nil
+	default:
+		return nil, typeError(i, cmd, "[]string")
+	}
+}
+
+func formatCmds(cmds []red.Cmder) string {
+	formatted := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		formatted[i] = formatCmd(cmd)
+	}
+
+	return strings.Join(formatted, "; ")
+}
+
+func typeError(i int, cmd red.Cmder, expect string) error {
+	return fmt.Errorf("result %d of %s is %T, can't be taken as %s", i, cmd.Name(), cmd, expect)
+}
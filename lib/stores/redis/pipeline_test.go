@@ -0,0 +1,163 @@
+package redis_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/stores/redis/redistest"
+)
+
+func TestRedisPipelined(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	assert.Nil(t, rds.Set("a", "1"))
+	results, err := rds.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set("b", "1.5", 0)
+		pipe.Get("a")
+		pipe.Get("b")
+		pipe.Get("c")
+		pipe.Incr("a")
+		pipe.SetNX("a", "3", 0)
+		pipe.MGet("a", "c")
+		pipe.HSet("h", "f", "v")
+		pipe.HGetAll("h")
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 9, results.Len())
+
+	val, err := results.String(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", val)
+	n, err := results.Int64(1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	f, err := results.Float64(2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, f)
+	val, err = results.String(3)
+	assert.Nil(t, err)
+	assert.Equal(t, "", val)
+	assert.Nil(t, results.Err(3))
+	n, err = results.Int64(4)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	ok, err := results.Bool(5)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	vals, err := results.Strings(6)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2", ""}, vals)
+	ok, err = results.Bool(7)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	hash, err := results.StringMap(8)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"f": "v"}, hash)
+
+	_, err = results.Strings(0)
+	assert.NotNil(t, err)
+	_, err = results.StringMap(1)
+	assert.NotNil(t, err)
+}
+
+func TestRedisPipelinedErrors(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	errQueue := errors.New("queue failed")
+	_, err = rds.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set("a", "1", 0)
+		return errQueue
+	})
+	assert.Equal(t, errQueue, err)
+	exists, err := rds.Exists("a")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	assert.Nil(t, rds.Set("a", "foo"))
+	results, err := rds.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Incr("a")
+		pipe.Get("a")
+		return nil
+	})
+	assert.NotNil(t, err)
+	assert.NotNil(t, results.Err(0))
+	val, err := results.String(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", val)
+
+	// the errors after red.Nil of the missing keys are reported
+	results, err = rds.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Get("missing")
+		pipe.Incr("a")
+		return nil
+	})
+	assert.NotNil(t, err)
+	assert.Nil(t, results.Err(0))
+	assert.Equal(t, err, results.Err(1))
+
+	// red.Nil only is not an error
+	results, err = rds.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Get("missing")
+		pipe.Get("a")
+		return nil
+	})
+	assert.Nil(t, err)
+	val, err = results.String(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "", val)
+}
+
+func TestRedisTxPipelined(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	results, err := rds.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Incr("counter")
+		pipe.IncrBy("counter", 10)
+		pipe.Expire("counter", time.Minute)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, results.Len())
+	n, err := results.Int64(1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), n)
+	ok, err := results.Bool(2)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ttl, err := rds.Ttl("counter")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= 60)
+}
+
+func TestRedisGetWithPttl(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	assert.Nil(t, rds.Setex("a", "1", 10))
+	assert.Nil(t, rds.Set("b", "2"))
+
+	val, ttl, err := rds.GetWithPttl("a")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", val)
+	assert.True(t, ttl > 9*time.Second && ttl <= 10*time.Second)
+	val, ttl, err = rds.GetWithPttl("b")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", val)
+	assert.True(t, ttl < 0)
+	val, ttl, err = rds.GetWithPttl("c")
+	assert.Nil(t, err)
+	assert.Equal(t, "", val)
+	assert.True(t, ttl < 0)
+}
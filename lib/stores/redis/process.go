@@ -2,6 +2,7 @@ package redis
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
@@ -10,6 +11,9 @@ import (
 	red "github.com/go-redis/redis"
 )
 
+// the type of the errors replied by redis, like red.Nil and WRONGTYPE
+var replyErrorType = reflect.TypeOf(red.Nil)
+
 func process(oldProcess func(red.Cmder) error) func(red.Cmder) error {
 	return func(cmd red.Cmder) error {
 		start := time.Now()
@@ -17,15 +21,26 @@ func process(oldProcess func(red.Cmder) error) func(red.Cmder) error {
 		defer func() {
 			duration := time.Since(start)
 			if duration > slowThreshold {
-				var buf strings.Builder
-				buf.WriteString(cmd.Name())
-				for _, arg := range cmd.Args() {
-					buf.WriteString(fmt.Sprintf(" %v", arg))
-				}
-				logx.Slowf("[REDIS] slowcall(%s) on executing: %s", duration, buf.String())
+				logx.Slowf("[REDIS] slowcall(%s) on executing: %s", duration, formatCmd(cmd))
 			}
 		}()
 
 		return oldProcess(cmd)
 	}
 }
+
+// acceptable returns true on the errors replied by redis, which don't mean redis is unavailable,
+// like red.Nil of the missing keys and WRONGTYPE, so they don't open the breakers of the pipelines.
+func acceptable(err error) bool {
+	return err == nil || reflect.TypeOf(err) == replyErrorType
+}
+
+func formatCmd(cmd red.Cmder) string {
+	var buf strings.Builder
+	buf.WriteString(cmd.Name())
+	for _, arg := range cmd.Args() {
+		buf.WriteString(fmt.Sprintf(" %v", arg))
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,19 @@
+package redis
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	red "github.com/go-redis/redis"
+)
+
+func TestAcceptable(t *testing.T) {
+	assert.True(t, acceptable(nil))
+	assert.True(t, acceptable(red.Nil))
+	assert.True(t, acceptable(red.TxFailedErr))
+	assert.False(t, acceptable(io.EOF))
+	assert.False(t, acceptable(errors.New("redis: connection pool timeout")))
+}
@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/system"
+	"github.com/vsaien/cuter/lib/threading"
+
+	red "github.com/go-redis/redis"
+)
+
+// the max number of the messages handled concurrently on each subscription
+const subscribeWorkers = 16
+
+var (
+	// the live subscriptions, closed by one shutdown listener, removed on closing
+	subscriptions     = make(map[*Subscription]struct{})
+	subscriptionsLock sync.Mutex
+	shutdownOnce      sync.Once
+)
+
+type (
+	// Subscription receives the messages of the subscribed channels or patterns until closed.
+	Subscription struct {
+		pubsub *red.PubSub
+		runner *threading.TaskRunner
+		done   chan struct{}
+		once   sync.Once
+		err    error
+	}
+
+	subscriber interface {
+		Subscribe(channels ...string) *red.PubSub
+		PSubscribe(patterns ...string) *red.PubSub
+	}
+)
+
+// Publish publishes message to channel, returns the number of the clients that received it.
+func (s *Redis) Publish(channel, message string) (int64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.Publish(channel, message).Result()
+}
+
+// PSubscribe is like Subscribe, but subscribes the channels matching the glob-style patterns.
+func (s *Redis) PSubscribe(handle func(channel, message string), patterns ...string) (*Subscription, error) {
+	client, err := getSubscriber(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSubscription(client.PSubscribe(patterns...), handle), nil
+}
+
+// Subscribe subscribes channels, the messages are handled by handle on the background goroutines,
+// at most subscribeWorkers at the same time, so the messages might be handled out of order.
+// The connection is checked by pings, and the channels are subscribed again on reconnecting,
+// the messages published during the disconnection are lost.
+// The subscription is closed on shutting down the process if not closed before.
+func (s *Redis) Subscribe(handle func(channel, message string), channels ...string) (*Subscription, error) {
+	client, err := getSubscriber(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSubscription(client.Subscribe(channels...), handle), nil
+}
+
+func newSubscription(pubsub *red.PubSub, handle func(channel, message string)) *Subscription {
+	sub := &Subscription{
+		pubsub: pubsub,
+		runner: threading.NewTaskRunner(subscribeWorkers),
+		done:   make(chan struct{}),
+	}
+
+	// the channel of pubsub is closed on closing pubsub, the reconnections are handled inside
+	messages := pubsub.Channel()
+	threading.GoSafe(func() {
+		defer close(sub.done)
+
+		for msg := range messages {
+			channel, payload := msg.Channel, msg.Payload
+			sub.runner.Schedule(func() {
+				handle(channel, payload)
+			})
+		}
+	})
+	subscriptionsLock.Lock()
+	subscriptions[sub] = struct{}{}
+	subscriptionsLock.Unlock()
+	shutdownOnce.Do(func() {
+		system.AddShutdownListener(closeSubscriptions)
+	})
+
+	return sub
+}
+
+// Close unsubscribes and closes the connection, then waits for the received messages to be handled,
+// so it should not be called in the handlers.
+func (sub *Subscription) Close() error {
+	sub.once.Do(func() {
+		subscriptionsLock.Lock()
+		delete(subscriptions, sub)
+		subscriptionsLock.Unlock()
+
+		sub.err = sub.pubsub.Close()
+		<-sub.done
+		sub.runner.Wait()
+	})
+
+	return sub.err
+}
+
+// closeSubscriptions closes the live subscriptions on shutting down the process.
+func closeSubscriptions() {
+	subscriptionsLock.Lock()
+	subs := make([]*Subscription, 0, len(subscriptions))
+	for sub := range subscriptions {
+		subs = append(subs, sub)
+	}
+	subscriptionsLock.Unlock()
+
+	for _, sub := range subs {
+		if err := sub.Close(); err != nil {
+			logx.Error(err)
+		}
+	}
+}
+
+func liveSubscriptions() int {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+
+	return len(subscriptions)
+}
+
+func getSubscriber(r *Redis) (subscriber, error) {
+	conn, err := getRedis(r)
+	if err != nil {
+		return nil, err
+	}
+
+	client, ok := conn.(subscriber)
+	if !ok {
+		return nil, fmt.Errorf("redis type '%s' doesn't support subscribing", r.RedisType)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,110 @@
+package redis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/stores/redis/redistest"
+)
+
+func TestRedisSubscribe(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	received := make(chan [2]string, 10)
+	sub, err := rds.Subscribe(func(channel, message string) {
+		received <- [2]string{channel, message}
+	}, "a", "b")
+	assert.Nil(t, err)
+	psub, err := rds.PSubscribe(func(channel, message string) {
+		received <- [2]string{channel, message}
+	}, "c*")
+	assert.Nil(t, err)
+	defer psub.Close()
+
+	n, err := rds.Publish("b", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, [2]string{"b", "hello"}, <-received)
+	n, err = rds.Publish("cc", "world")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, [2]string{"cc", "world"}, <-received)
+
+	assert.Nil(t, sub.Close())
+	// closing multiple times is fine
+	assert.Nil(t, sub.Close())
+}
+
+func TestRedisSubscriptionsClosedOnShutdown(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	live := redis.LiveSubscriptions()
+	sub, err := rds.Subscribe(func(_, _ string) {}, "a")
+	assert.Nil(t, err)
+	psub, err := rds.PSubscribe(func(_, _ string) {}, "b*")
+	assert.Nil(t, err)
+	assert.Equal(t, live+2, redis.LiveSubscriptions())
+
+	// the closed ones are not kept
+	assert.Nil(t, sub.Close())
+	assert.Equal(t, live+1, redis.LiveSubscriptions())
+
+	redis.CloseSubscriptions()
+	assert.Equal(t, 0, redis.LiveSubscriptions())
+	n := int64(-1)
+	for i := 0; i < 100 && n != 0; i++ {
+		n, err = rds.Publish("bb", "hello")
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int64(0), n)
+	assert.Nil(t, psub.Close())
+}
+
+func TestRedisSubscribeResubscribe(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	received := make(chan string, 100)
+	sub, err := rds.Subscribe(func(_, message string) {
+		received <- message
+	}, "a")
+	assert.Nil(t, err)
+	defer sub.Close()
+	psub, err := rds.PSubscribe(func(_, message string) {
+		received <- message
+	}, "b*")
+	assert.Nil(t, err)
+	defer psub.Close()
+
+	s.DropConnections()
+	// the messages published before subscribing again are lost
+	for _, channel := range []string{"a", "bb"} {
+		assert.True(t, publishUntilReceived(rds, channel, received))
+	}
+}
+
+func publishUntilReceived(rds *redis.Redis, channel string, received chan string) bool {
+	for i := 0; i < 100; i++ {
+		rds.Publish(channel, channel)
+		select {
+		case message := <-received:
+			if message == channel {
+				return true
+			}
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	return false
+}
@@ -1,11 +1,17 @@
 package redis
 
 import (
+	"context"
+	"crypto/sha1"
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/vsaien/cuter/lib/threading"
+
 	red "github.com/go-redis/redis"
 )
 
@@ -18,12 +24,16 @@ const (
 	readWriteTimeout     = 2 * time.Second
 
 	slowThreshold = time.Millisecond * 100
+
+	noScriptPrefix = "NOSCRIPT"
 )
 
 var (
 	ErrNilNode  = errors.New("nil redis node")
 	ErrNotFound = errors.New("key not found")
 	ErrTimeout  = errors.New("timeout on talkin to redis")
+	// ErrPingFailed is returned by HealthCheck if redis doesn't reply PONG.
+	ErrPingFailed = errors.New("ping redis failed")
 )
 
 type (
@@ -32,6 +42,34 @@ type (
 		Score int64
 	}
 
+	FloatPair struct {
+		Key   string
+		Score float64
+	}
+
+	// GeoLocation is the member of the geospatial index, Dist is only set on searching.
+	GeoLocation = red.GeoLocation
+
+	// GeoSearchQuery is the area of GEOSEARCH, centered on Member if not empty, otherwise on Longitude
+	// and Latitude, within Radius if not 0, otherwise in the box of Width and Height.
+	GeoSearchQuery struct {
+		Member    string
+		Longitude float64
+		Latitude  float64
+		Radius    float64
+		Width     float64
+		Height    float64
+		// m, km, ft or mi, m if empty
+		Unit string
+		// ASC or DESC, unsorted if empty
+		Sort string
+		// 0 means no limit
+		Count int64
+	}
+
+	// ZStore is the weights and the aggregate function of ZUNIONSTORE and ZINTERSTORE.
+	ZStore = red.ZStore
+
 	// thread-safe
 	Redis struct {
 		RedisAddr string
@@ -57,6 +95,28 @@ func NewRedis(redisAddr, redisType string, redisPass ...string) *Redis {
 	}
 }
 
+func (s *Redis) Bitcount(key string, start, end int64) (int64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.BitCount(key, &red.BitCount{
+		Start: start,
+		End:   end,
+	}).Result()
+}
+
+// Bitpos returns the position of the first bit set to bit in the bytes from start to end, -1 if not found.
+func (s *Redis) Bitpos(key string, bit int64, start, end int64) (int64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.BitPos(key, bit, start, end).Result()
+}
+
 // Use passed in redis connection to execute blocking queries
 // Doesn't benefit from pooling redis connections of blocking queries
 func (s *Redis) Blpop(redisNode RedisNode, key string) (string, error) {
@@ -115,6 +175,35 @@ func (s *Redis) Eval(script string, keys []string, args ...interface{}) (interfa
 	return conn.Eval(script, keys, args...).Result()
 }
 
+// EvalCached evaluates the script by its sha1 digest if it's cached by ScriptCache,
+// otherwise, or if the script is not loaded on the redis node, evaluates the script itself,
+// which loads the script on the node for the later calls.
+func (s *Redis) EvalCached(script string, keys []string, args ...interface{}) (interface{}, error) {
+	cache := GetScriptCache()
+	if sha, ok := cache.GetSha(script); ok {
+		val, err := s.EvalSha(sha, keys, args...)
+		if err == nil || !strings.HasPrefix(err.Error(), noScriptPrefix) {
+			return val, err
+		}
+	}
+
+	val, err := s.Eval(script, keys, args...)
+	if err == nil || err == Nil {
+		cache.SetSha(script, fmt.Sprintf("%x", sha1.Sum([]byte(script))))
+	}
+
+	return val, err
+}
+
+func (s *Redis) EvalSha(sha string, keys []string, args ...interface{}) (interface{}, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.EvalSha(sha, keys, args...).Result()
+}
+
 func (s *Redis) Exists(key string) (bool, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -146,6 +235,35 @@ func (s *Redis) Expireat(key string, expireTime int64) error {
 	return conn.ExpireAt(key, time.Unix(expireTime, 0)).Err()
 }
 
+func (s *Redis) Geoadd(key string, geoLocations ...*GeoLocation) (int64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.GeoAdd(key, geoLocations...).Result()
+}
+
+// Geosearch returns the members of key in the area of query with the coordinates and the distances.
+func (s *Redis) Geosearch(key string, query GeoSearchQuery) ([]GeoLocation, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, err
+	}
+
+	client, ok := conn.(doer)
+	if !ok {
+		return nil, fmt.Errorf("redis type '%s' doesn't support GEOSEARCH", s.RedisType)
+	}
+
+	val, err := client.Do(query.args(key)...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return toGeoLocations(val)
+}
+
 func (s *Redis) Get(key string) (string, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -161,6 +279,55 @@ func (s *Redis) Get(key string) (string, error) {
 	}
 }
 
+func (s *Redis) Getbit(key string, offset int64) (int, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if val, err := conn.GetBit(key, offset).Result(); err != nil {
+		return 0, err
+	} else {
+		return int(val), nil
+	}
+}
+
+// Getset sets key to value and returns the old value, empty if key doesn't exist.
+func (s *Redis) Getset(key, value string) (string, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return "", err
+	}
+
+	if val, err := conn.GetSet(key, value).Result(); err == red.Nil {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	} else {
+		return val, nil
+	}
+}
+
+// GetWithPttl returns the value of key with its time to live in one round trip,
+// the ttl is negative if key has no expiry or doesn't exist.
+func (s *Redis) GetWithPttl(key string) (string, time.Duration, error) {
+	results, err := s.Pipelined(func(pipe Pipeliner) error {
+		pipe.Get(key)
+		pipe.PTTL(key)
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	val, err := results.String(0)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return val, results[1].(*red.DurationCmd).Val(), nil
+}
+
 func (s *Redis) Hdel(key, field string) (bool, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -308,6 +475,15 @@ func (s *Redis) Incrby(key string, increment int64) (int64, error) {
 	return conn.IncrBy(key, int64(increment)).Result()
 }
 
+func (s *Redis) Incrbyfloat(key string, increment float64) (float64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.IncrByFloat(key, increment).Result()
+}
+
 func (s *Redis) Keys(pattern string) ([]string, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -317,6 +493,22 @@ func (s *Redis) Keys(pattern string) ([]string, error) {
 	return conn.Keys(pattern).Result()
 }
 
+// Lindex returns the element at index of the list, empty if out of range.
+func (s *Redis) Lindex(key string, index int64) (string, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return "", err
+	}
+
+	if val, err := conn.LIndex(key, index).Result(); err == red.Nil {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	} else {
+		return val, nil
+	}
+}
+
 func (s *Redis) Llen(key string) (int, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -361,7 +553,30 @@ func (s *Redis) Lrem(key string, count int, value string) (int, error) {
 	}
 }
 
+func (s *Redis) Lset(key string, index int64, value string) error {
+	conn, err := getRedis(s)
+	if err != nil {
+		return err
+	}
+
+	return conn.LSet(key, index, value).Err()
+}
+
+func (s *Redis) Ltrim(key string, start, stop int64) error {
+	conn, err := getRedis(s)
+	if err != nil {
+		return err
+	}
+
+	return conn.LTrim(key, start, stop).Err()
+}
+
+// Mget returns the values of keys, the values of the missing keys are empty.
 func (s *Redis) Mget(keys ...string) ([]string, error) {
+	if s.RedisType == ClusterType && len(keys) > 1 {
+		return s.mgetPipelined(keys)
+	}
+
 	conn, err := getRedis(s)
 	if err != nil {
 		return nil, err
@@ -405,6 +620,16 @@ func (s *Redis) Pfcount(key string) (int64, error) {
 	return conn.PFCount(key).Result()
 }
 
+// Pfmerge merges the HyperLogLogs of keys into dest, the keys must reside in the same slot on clusters.
+func (s *Redis) Pfmerge(dest string, keys ...string) error {
+	conn, err := getRedis(s)
+	if err != nil {
+		return err
+	}
+
+	return conn.PFMerge(dest, keys...).Err()
+}
+
 func (s *Redis) Ping() bool {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -418,6 +643,43 @@ func (s *Redis) Ping() bool {
 	}
 }
 
+// HealthCheck pings the redis by Ping, it returns the error of ctx if ctx is done before the ping,
+// so that the deadline of ctx is honored, it can be registered by service.RegisterHealthCheck.
+func (s *Redis) HealthCheck(ctx context.Context) error {
+	// buffered, the ping is left to finish if ctx is done first
+	pong := make(chan bool, 1)
+	threading.GoSafe(func() {
+		pong <- s.Ping()
+	})
+
+	select {
+	case ok := <-pong:
+		if !ok {
+			return ErrPingFailed
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Rpoplpush moves the last element of source to the head of destination and returns it,
+// empty if source is empty. The keys must reside in the same slot on clusters.
+func (s *Redis) Rpoplpush(source, destination string) (string, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return "", err
+	}
+
+	if val, err := conn.RPopLPush(source, destination).Result(); err == red.Nil {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	} else {
+		return val, nil
+	}
+}
+
 func (s *Redis) Rpush(key string, values ...interface{}) (int, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -484,6 +746,20 @@ func (s *Redis) Set(key string, value string) error {
 	return conn.Set(key, value, 0).Err()
 }
 
+// Setbit sets the bit at offset to value, returns the original bit.
+func (s *Redis) Setbit(key string, offset int64, value int) (int, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if val, err := conn.SetBit(key, offset, value).Result(); err != nil {
+		return 0, err
+	} else {
+		return int(val), nil
+	}
+}
+
 func (s *Redis) Setex(key, value string, seconds int) error {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -589,6 +865,22 @@ func (s *Redis) Zadd(key string, score int64, value string) (bool, error) {
 	}
 }
 
+func (s *Redis) ZaddFloat(key string, score float64, value string) (bool, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return false, err
+	}
+
+	if val, err := conn.ZAdd(key, red.Z{
+		Score:  score,
+		Member: value,
+	}).Result(); err != nil {
+		return false, err
+	} else {
+		return val == 1, nil
+	}
+}
+
 func (s *Redis) Zcard(key string) (int, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -629,6 +921,26 @@ func (s *Redis) Zincrby(key string, increment int64, field string) (int64, error
 	}
 }
 
+func (s *Redis) ZincrbyFloat(key string, increment float64, field string) (float64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.ZIncrBy(key, increment, field).Result()
+}
+
+// Zinterstore stores the intersection of the sorted sets of keys into dest, returns the size of dest.
+// The keys must reside in the same slot on clusters.
+func (s *Redis) Zinterstore(dest string, store ZStore, keys ...string) (int64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.ZInterStore(dest, store, keys...).Result()
+}
+
 func (s *Redis) Zscore(key string, value string) (int64, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -642,6 +954,15 @@ func (s *Redis) Zscore(key string, value string) (int64, error) {
 	}
 }
 
+func (s *Redis) ZscoreFloat(key string, value string) (float64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.ZScore(key, value).Result()
+}
+
 func (s *Redis) Zrank(key, field string) (int64, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -713,6 +1034,19 @@ func (s *Redis) ZrangeWithScores(key string, start, stop int64) ([]Pair, error)
 	}
 }
 
+func (s *Redis) ZrangeWithScoresByFloat(key string, start, stop int64) ([]FloatPair, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if vals, err := conn.ZRangeWithScores(key, start, stop).Result(); err != nil {
+		return nil, err
+	} else {
+		return toFloatPairs(vals), nil
+	}
+}
+
 func (s *Redis) ZrangebyscoreWithScores(key string, start, stop int64) ([]Pair, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -751,6 +1085,54 @@ func (s *Redis) ZrangebyscoreWithScoresAndLimit(key string, start, stop int64, p
 	}
 }
 
+func (s *Redis) ZrangebyscoreWithScoresByFloat(key string, start, stop float64) ([]FloatPair, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if vals, err := conn.ZRangeByScoreWithScores(key, red.ZRangeBy{
+		Min: formatScore(start),
+		Max: formatScore(stop),
+	}).Result(); err != nil {
+		return nil, err
+	} else {
+		return toFloatPairs(vals), nil
+	}
+}
+
+// Zrangebylex returns the members between start and stop of the sorted set with the same scores,
+// like [a, (a, - and +.
+func (s *Redis) Zrangebylex(key, start, stop string) ([]string, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.ZRangeByLex(key, red.ZRangeBy{
+		Min: start,
+		Max: stop,
+	}).Result()
+}
+
+func (s *Redis) ZrangebylexWithLimit(key, start, stop string, page, size int) ([]string, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.ZRangeByLex(key, red.ZRangeBy{
+		Min:    start,
+		Max:    stop,
+		Offset: int64(page * size),
+		Count:  int64(size),
+	}).Result()
+}
+
 func (s *Redis) Zrevrange(key string, start, stop int64) ([]string, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -798,6 +1180,56 @@ func (s *Redis) ZrevrangebyscoreWithScoresAndLimit(key string, start, stop int64
 	}
 }
 
+func (s *Redis) ZrevrangebyscoreWithScoresByFloat(key string, start, stop float64) ([]FloatPair, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if vals, err := conn.ZRevRangeByScoreWithScores(key, red.ZRangeBy{
+		Min: formatScore(start),
+		Max: formatScore(stop),
+	}).Result(); err != nil {
+		return nil, err
+	} else {
+		return toFloatPairs(vals), nil
+	}
+}
+
+// Zunionstore stores the union of the sorted sets of keys into dest, returns the size of dest.
+// The keys must reside in the same slot on clusters.
+func (s *Redis) Zunionstore(dest string, store ZStore, keys ...string) (int64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.ZUnionStore(dest, store, keys...).Result()
+}
+
+// mgetPipelined gets the values of keys by the pipelined GETs, because the keys might reside in
+// different slots of the cluster, which can't be fetched by one MGET.
+func (s *Redis) mgetPipelined(keys []string) ([]string, error) {
+	results, err := s.Pipelined(func(pipe Pipeliner) error {
+		for _, key := range keys {
+			pipe.Get(key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	vals := make([]string, len(keys))
+	for i := range keys {
+		if vals[i], err = results.String(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return vals, nil
+}
+
 func (s *Redis) scriptLoad(script string) (string, error) {
 	conn, err := getRedis(s)
 	if err != nil {
@@ -837,6 +1269,108 @@ func toPairs(vals []red.Z) []Pair {
 	return pairs
 }
 
+func (q GeoSearchQuery) args(key string) []interface{} {
+	unit := q.Unit
+	if len(unit) == 0 {
+		unit = "m"
+	}
+
+	args := []interface{}{"geosearch", key}
+	if len(q.Member) > 0 {
+		args = append(args, "frommember", q.Member)
+	} else {
+		args = append(args, "fromlonlat", q.Longitude, q.Latitude)
+	}
+	if q.Radius > 0 {
+		args = append(args, "byradius", q.Radius, unit)
+	} else {
+		args = append(args, "bybox", q.Width, q.Height, unit)
+	}
+	if len(q.Sort) > 0 {
+		args = append(args, q.Sort)
+	}
+	if q.Count > 0 {
+		args = append(args, "count", q.Count)
+	}
+
+	return append(args, "withcoord", "withdist")
+}
+
+// formatScore formats the scores of the ranges, -Inf and +Inf are formatted as -inf and +inf.
+func formatScore(score float64) string {
+	if math.IsInf(score, -1) {
+		return "-inf"
+	} else if math.IsInf(score, 1) {
+		return "+inf"
+	}
+
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+func toFloatPairs(vals []red.Z) []FloatPair {
+	pairs := make([]FloatPair, len(vals))
+	for i, val := range vals {
+		switch member := val.Member.(type) {
+		case string:
+			pairs[i] = FloatPair{
+				Key:   member,
+				Score: val.Score,
+			}
+		default:
+			pairs[i] = FloatPair{
+				Key:   fmt.Sprint(val.Member),
+				Score: val.Score,
+			}
+		}
+	}
+	return pairs
+}
+
+// toGeoLocations parses the reply of GEOSEARCH with WITHCOORD and WITHDIST, each item is
+// like [member, distance, [longitude, latitude]].
+func toGeoLocations(val interface{}) ([]GeoLocation, error) {
+	items, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply of GEOSEARCH: %v", val)
+	}
+
+	locations := make([]GeoLocation, len(items))
+	for i, item := range items {
+		fields, ok := item.([]interface{})
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected item of GEOSEARCH: %v", item)
+		}
+
+		coord, ok := fields[2].([]interface{})
+		if !ok || len(coord) != 2 {
+			return nil, fmt.Errorf("unexpected coordinates of GEOSEARCH: %v", fields[2])
+		}
+
+		floats := make([]float64, 3)
+		for j, field := range []interface{}{fields[1], coord[0], coord[1]} {
+			str, ok := field.(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected item of GEOSEARCH: %v", item)
+			}
+
+			f, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return nil, err
+			}
+			floats[j] = f
+		}
+
+		locations[i] = GeoLocation{
+			Name:      fmt.Sprint(fields[0]),
+			Dist:      floats[0],
+			Longitude: floats[1],
+			Latitude:  floats[2],
+		}
+	}
+
+	return locations, nil
+}
+
 func toStrings(vals []interface{}) []string {
 	ret := make([]string, len(vals))
 	for i, val := range vals {
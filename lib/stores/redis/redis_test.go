@@ -0,0 +1,341 @@
+package redis_test
+
+import (
+	"context"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/stores/redis/redistest"
+)
+
+func TestRedisFloatScores(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	ok, err := rds.ZaddFloat("z", 1.5, "a")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.ZaddFloat("z", 2.25, "b")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.ZaddFloat("z", -0.5, "c")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.ZaddFloat("z", 1.75, "a")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	score, err := rds.ZincrbyFloat("z", 0.5, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, 2.25, score)
+	score, err = rds.ZscoreFloat("z", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, 2.25, score)
+
+	pairs, err := rds.ZrangeWithScoresByFloat("z", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.FloatPair{
+		{Key: "c", Score: -0.5},
+		{Key: "a", Score: 2.25},
+		{Key: "b", Score: 2.25},
+	}, pairs)
+	pairs, err = rds.ZrangebyscoreWithScoresByFloat("z", 0, math.Inf(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.FloatPair{
+		{Key: "a", Score: 2.25},
+		{Key: "b", Score: 2.25},
+	}, pairs)
+	pairs, err = rds.ZrevrangebyscoreWithScoresByFloat("z", math.Inf(-1), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.FloatPair{
+		{Key: "c", Score: -0.5},
+	}, pairs)
+
+	// the int64 api truncates the scores
+	ipairs, err := rds.ZrangeWithScores("z", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.Pair{{Key: "c", Score: 0}}, ipairs)
+}
+
+func TestRedisZstore(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	for _, pair := range []redis.FloatPair{{"a", 1}, {"b", 2}, {"c", 3}} {
+		_, err := rds.ZaddFloat("z1", pair.Score, pair.Key)
+		assert.Nil(t, err)
+	}
+	for _, pair := range []redis.FloatPair{{"b", 10}, {"c", 20}, {"d", 30}} {
+		_, err := rds.ZaddFloat("z2", pair.Score, pair.Key)
+		assert.Nil(t, err)
+	}
+
+	n, err := rds.Zunionstore("union", redis.ZStore{}, "z1", "z2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), n)
+	pairs, err := rds.ZrangeWithScoresByFloat("union", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.FloatPair{{"a", 1}, {"b", 12}, {"c", 23}, {"d", 30}}, pairs)
+
+	n, err = rds.Zinterstore("inter", redis.ZStore{
+		Weights:   []float64{2, 0.5},
+		Aggregate: "MAX",
+	}, "z1", "z2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	pairs, err = rds.ZrangeWithScoresByFloat("inter", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.FloatPair{{"b", 5}, {"c", 10}}, pairs)
+}
+
+func TestRedisZrangebylex(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	for _, member := range []string{"d", "a", "c", "b", "e"} {
+		_, err := rds.Zadd("z", 0, member)
+		assert.Nil(t, err)
+	}
+
+	vals, err := rds.Zrangebylex("z", "-", "+")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, vals)
+	vals, err = rds.Zrangebylex("z", "(b", "[d")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "d"}, vals)
+	vals, err = rds.ZrangebylexWithLimit("z", "-", "+", 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "d"}, vals)
+	vals, err = rds.ZrangebylexWithLimit("z", "-", "+", 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, vals)
+}
+
+func TestRedisBitmap(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	old, err := rds.Setbit("b", 7, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, old)
+	old, err = rds.Setbit("b", 7, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, old)
+	_, err = rds.Setbit("b", 10, 1)
+	assert.Nil(t, err)
+
+	bit, err := rds.Getbit("b", 7)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, bit)
+	bit, err = rds.Getbit("b", 8)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, bit)
+	bit, err = rds.Getbit("b", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, bit)
+
+	n, err := rds.Bitcount("b", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = rds.Bitcount("b", 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	pos, err := rds.Bitpos("b", 1, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), pos)
+	pos, err = rds.Bitpos("b", 1, 1, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), pos)
+	pos, err = rds.Bitpos("b", 0, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), pos)
+	pos, err = rds.Bitpos("none", 1, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), pos)
+}
+
+func TestRedisGeo(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	n, err := rds.Geoadd("g", &redis.GeoLocation{
+		Name:      "Palermo",
+		Longitude: 13.361389,
+		Latitude:  38.115556,
+	}, &redis.GeoLocation{
+		Name:      "Catania",
+		Longitude: 15.087269,
+		Latitude:  37.502669,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	locations, err := rds.Geosearch("g", redis.GeoSearchQuery{
+		Longitude: 15,
+		Latitude:  37,
+		Radius:    200,
+		Unit:      "km",
+		Sort:      "ASC",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(locations))
+	assert.Equal(t, "Catania", locations[0].Name)
+	assert.InDelta(t, 56.4413, locations[0].Dist, 0.01)
+	assert.InDelta(t, 15.087269, locations[0].Longitude, 1e-6)
+	assert.InDelta(t, 37.502669, locations[0].Latitude, 1e-6)
+	assert.Equal(t, "Palermo", locations[1].Name)
+	assert.InDelta(t, 190.4424, locations[1].Dist, 0.01)
+
+	locations, err = rds.Geosearch("g", redis.GeoSearchQuery{
+		Member: "Palermo",
+		Width:  100,
+		Height: 100,
+		Unit:   "km",
+		Count:  1,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(locations))
+	assert.Equal(t, "Palermo", locations[0].Name)
+	assert.Equal(t, float64(0), locations[0].Dist)
+}
+
+func TestRedisPfmerge(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	ok, err := rds.Pfadd("h1", "a", "b", "c")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.Pfadd("h1", "a")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = rds.Pfadd("h2", "c", "d")
+	assert.Nil(t, err)
+
+	assert.Nil(t, rds.Pfmerge("h", "h1", "h2"))
+	n, err := rds.Pfcount("h")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), n)
+}
+
+func TestRedisStrings(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	val, err := rds.Getset("a", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", val)
+	val, err = rds.Getset("a", "2.5")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", val)
+
+	f, err := rds.Incrbyfloat("a", 0.25)
+	assert.Nil(t, err)
+	assert.Equal(t, 2.75, f)
+	f, err = rds.Incrbyfloat("b", -1.5)
+	assert.Nil(t, err)
+	assert.Equal(t, -1.5, f)
+
+	_, err = rds.ZaddFloat("z", 1, "a")
+	assert.Nil(t, err)
+	_, err = rds.Getset("z", "1")
+	assert.NotNil(t, err)
+}
+
+func TestRedisLists(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	n, err := rds.Rpush("l", "a", "b", "c", "d")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+
+	val, err := rds.Lindex("l", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", val)
+	val, err = rds.Lindex("l", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "d", val)
+	val, err = rds.Lindex("l", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "", val)
+
+	assert.Nil(t, rds.Lset("l", 0, "x"))
+	assert.NotNil(t, rds.Lset("l", 10, "x"))
+	assert.NotNil(t, rds.Lset("none", 0, "x"))
+
+	assert.Nil(t, rds.Ltrim("l", 0, 2))
+	vals, err := rds.Lrange("l", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"x", "b", "c"}, vals)
+
+	val, err = rds.Rpoplpush("l", "m")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", val)
+	val, err = rds.Rpoplpush("l", "l")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", val)
+	vals, err = rds.Lrange("l", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "x"}, vals)
+	vals, err = rds.Lrange("m", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c"}, vals)
+	val, err = rds.Rpoplpush("none", "m")
+	assert.Nil(t, err)
+	assert.Equal(t, "", val)
+
+	assert.Nil(t, rds.Ltrim("m", 1, 0))
+	n, err = rds.Llen("m")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRedisHealthCheck(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+	assert.Nil(t, rds.HealthCheck(context.Background()))
+
+	// accepts the connections but never replies
+	listener, err := net.Listen("tcp", "localhost:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// never replies, the connections are closed after the test
+			go func() {
+				<-done
+				conn.Close()
+			}()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = redis.NewRedis(listener.Addr().String(), redis.NodeType).HealthCheck(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	clean()
+	assert.Equal(t, redis.ErrPingFailed, rds.HealthCheck(context.Background()))
+}
@@ -1,39 +1,70 @@
 package redis
 
 import (
+	"context"
 	"math/rand"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/threading"
 
 	red "github.com/go-redis/redis"
 )
 
 const (
-	letters     = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// returns the fencing token if acquired, otherwise 0, the token is increased on each new holder,
+	// and kept on acquiring again by the holder, which resets the expiry if ARGV[3] is 1, otherwise
+	// only lengthens it, so that the reentrant acquiring doesn't shorten the expiry of the outer one.
 	lockCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
-    redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
-    return "OK"
+    if ARGV[3] == "1" or redis.call("PTTL", KEYS[1]) < tonumber(ARGV[2]) then
+        redis.call("PEXPIRE", KEYS[1], ARGV[2])
+    end
+    return tonumber(redis.call("GET", KEYS[2])) or redis.call("INCR", KEYS[2])
+elseif redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+    return redis.call("INCR", KEYS[2])
 else
-    return redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2])
+    return 0
 end`
 	delCommand = `if redis.call("get", KEYS[1]) == ARGV[1] then
     return redis.call("del", KEYS[1])
 else
     return 0
+end`
+	renewCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+else
+    return 0
 end`
 	randomLen       = 16
 	tolerance       = 500 // milliseconds
 	millisPerSecond = 1000
+	// the expiry of the locks acquired by AcquireCtx if not set by SetExpire
+	defaultWatchdogSeconds = 10
+	// the lock is renewed each 1/renewsPerExpiry of the expiry
+	renewsPerExpiry   = 3
+	minAcquireBackoff = 10 * time.Millisecond
+	maxAcquireBackoff = 500 * time.Millisecond
 )
 
+// RedisLock is a distributed lock on redis. Acquiring again by the holder refreshes the expiry,
+// and one Release releases the lock, unless created by NewReentrantRedisLock.
 type RedisLock struct {
-	store   *Redis
-	seconds uint32
-	key     string
-	id      string
+	store     *Redis
+	seconds   uint32
+	key       string
+	id        string
+	reentrant bool
+	lock      sync.Mutex
+	// the times acquired but not released yet
+	holds int
+	token int64
+	// closed to stop the watchdog
+	watchdog chan struct{}
 }
 
 func init() {
@@ -48,10 +79,101 @@ func NewRedisLock(store *Redis, key string) *RedisLock {
 	}
 }
 
+// NewReentrantRedisLock returns a RedisLock which is reentrant, the lock is released after released
+// as many times as acquired, and acquiring again by the holder never shortens the expiry.
+func NewReentrantRedisLock(store *Redis, key string) *RedisLock {
+	rl := NewRedisLock(store, key)
+	rl.reentrant = true
+	return rl
+}
+
+// Acquire acquires the lock without waiting, the lock expires after the seconds set by SetExpire.
 func (rl *RedisLock) Acquire() (bool, error) {
-	seconds := atomic.LoadUint32(&rl.seconds)
-	resp, err := rl.store.Eval(lockCommand, []string{rl.key}, []string{
-		rl.id, strconv.Itoa(int(seconds)*millisPerSecond + tolerance)})
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	return rl.acquire(int(atomic.LoadUint32(&rl.seconds)))
+}
+
+// AcquireCtx acquires the lock, waits with backoff until acquired or ctx done, returns the fencing
+// token, which increases on each new holder, so that the writes with stale tokens can be rejected.
+// The lock is renewed by a watchdog until released, the expiry defaults to 10 seconds if not set
+// by SetExpire, which only takes effect if the holder is gone without releasing.
+func (rl *RedisLock) AcquireCtx(ctx context.Context) (int64, error) {
+	seconds := int(atomic.LoadUint32(&rl.seconds))
+	if seconds == 0 {
+		seconds = defaultWatchdogSeconds
+	}
+
+	for attempt := 0; ; attempt++ {
+		rl.lock.Lock()
+		ok, err := rl.acquire(seconds)
+		if ok {
+			rl.startWatchdog(seconds)
+			token := rl.token
+			rl.lock.Unlock()
+			return token, nil
+		}
+		rl.lock.Unlock()
+		if err != nil {
+			return 0, err
+		}
+
+		timer := time.NewTimer(acquireBackoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Release releases the lock, returns true if released or still held because of reentrancy.
+func (rl *RedisLock) Release() (bool, error) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if rl.reentrant && rl.holds > 1 {
+		rl.holds--
+		return true, nil
+	}
+
+	rl.holds = 0
+	rl.token = 0
+	rl.stopWatchdog()
+	resp, err := rl.store.EvalCached(delCommand, []string{rl.key}, []string{rl.id})
+	if err != nil {
+		return false, err
+	}
+
+	if reply, ok := resp.(int64); !ok {
+		return false, nil
+	} else {
+		return reply == 1, nil
+	}
+}
+
+func (rl *RedisLock) SetExpire(seconds int) {
+	atomic.StoreUint32(&rl.seconds, uint32(seconds))
+}
+
+// Token returns the fencing token of the held lock, 0 if not held.
+func (rl *RedisLock) Token() int64 {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	return rl.token
+}
+
+// acquire must be called with rl.lock held.
+func (rl *RedisLock) acquire(seconds int) (bool, error) {
+	refresh := "1"
+	if rl.reentrant {
+		refresh = "0"
+	}
+	resp, err := rl.store.EvalCached(lockCommand, []string{rl.key, fencingKey(rl.key)}, []string{
+		rl.id, strconv.Itoa(seconds*millisPerSecond + tolerance), refresh})
 	if err == red.Nil {
 		return false, nil
 	} else if err != nil {
@@ -61,30 +183,115 @@ func (rl *RedisLock) Acquire() (bool, error) {
 		return false, nil
 	}
 
-	reply, ok := resp.(string)
-	if ok && reply == "OK" {
-		return true, nil
-	} else {
+	token, ok := resp.(int64)
+	if !ok {
 		logx.Errorf("Unknown reply when acquiring lock for %s: %v", rl.key, resp)
 		return false, nil
+	} else if token == 0 {
+		return false, nil
+	}
+
+	if rl.reentrant {
+		rl.holds++
+	} else {
+		rl.holds = 1
 	}
+	rl.token = token
+	return true, nil
 }
 
-func (rl *RedisLock) Release() (bool, error) {
-	resp, err := rl.store.Eval(delCommand, []string{rl.key}, []string{rl.id})
+func (rl *RedisLock) renew(seconds int) (bool, error) {
+	resp, err := rl.store.EvalCached(renewCommand, []string{rl.key}, []string{
+		rl.id, strconv.Itoa(seconds*millisPerSecond + tolerance)})
 	if err != nil {
 		return false, err
 	}
 
-	if reply, ok := resp.(int); !ok {
-		return false, nil
-	} else {
-		return reply == 1, nil
+	reply, ok := resp.(int64)
+	return ok && reply == 1, nil
+}
+
+// startWatchdog must be called with rl.lock held.
+func (rl *RedisLock) startWatchdog(seconds int) {
+	if rl.watchdog != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	rl.watchdog = done
+	threading.GoSafe(func() {
+		ticker := time.NewTicker(time.Duration(seconds) * time.Second / renewsPerExpiry)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ok, err := rl.renew(seconds)
+				if err != nil {
+					// retry on next tick, the lock is still valid before expiry
+					logx.Errorf("Error on renewing lock for %s, %s", rl.key, err.Error())
+				} else if !ok {
+					logx.Errorf("Lock for %s is lost, stop renewing", rl.key)
+					rl.lost(done)
+					return
+				}
+			}
+		}
+	})
+}
+
+// lost clears the state of the lock lost, which is expired or taken by others,
+// unless it's released and acquired again already after the watchdog stopped.
+func (rl *RedisLock) lost(watchdog chan struct{}) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if rl.watchdog == watchdog {
+		rl.watchdog = nil
+		rl.holds = 0
+		rl.token = 0
 	}
 }
 
-func (rl *RedisLock) SetExpire(seconds int) {
-	atomic.StoreUint32(&rl.seconds, uint32(seconds))
+// stopWatchdog must be called with rl.lock held.
+func (rl *RedisLock) stopWatchdog() {
+	if rl.watchdog != nil {
+		close(rl.watchdog)
+		rl.watchdog = nil
+	}
+}
+
+// acquireBackoff returns the exponential backoff with jitter before the next attempt.
+func acquireBackoff(attempt int) time.Duration {
+	backoff := maxAcquireBackoff
+	if attempt < 6 {
+		backoff = minAcquireBackoff << uint(attempt)
+		if backoff > maxAcquireBackoff {
+			backoff = maxAcquireBackoff
+		}
+	}
+
+	// between backoff/2 and backoff
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// fencingKey returns the key of the fencing tokens of key, which is in the same slot as key on clusters,
+// except the keys with } but without hash tags, which can't be put in a hash tag.
+func fencingKey(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			// key has a hash tag already
+			return key + ":fencing"
+		}
+	}
+
+	if strings.IndexByte(key, '}') >= 0 {
+		return key + ":fencing"
+	}
+
+	return "{" + key + "}:fencing"
 }
 
 func randomStr(n int) string {
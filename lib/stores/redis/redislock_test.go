@@ -0,0 +1,206 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/stores/redis/redistest"
+)
+
+func TestAcquireBackoff(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		backoff := redis.MinAcquireBackoff << uint(attempt)
+		if attempt >= 6 || backoff > redis.MaxAcquireBackoff {
+			backoff = redis.MaxAcquireBackoff
+		}
+
+		for i := 0; i < 100; i++ {
+			val := redis.AcquireBackoff(attempt)
+			assert.True(t, val >= backoff/2 && val <= backoff, "attempt %d: %s", attempt, val)
+		}
+	}
+	assert.True(t, redis.AcquireBackoff(1000) <= redis.MaxAcquireBackoff)
+	assert.True(t, redis.AcquireBackoff(0) <= 10*time.Millisecond)
+}
+
+func TestFencingKey(t *testing.T) {
+	tests := map[string]string{
+		"lock":      "{lock}:fencing",
+		"a{b}c":     "a{b}c:fencing",
+		"a{}c":      "a{}c:fencing",
+		"a{b":       "{a{b}:fencing",
+		"user:{42}": "user:{42}:fencing",
+	}
+
+	for key, expect := range tests {
+		assert.Equal(t, expect, redis.FencingKey(key))
+	}
+}
+
+func TestRedisLock(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	first := redis.NewRedisLock(rds, "lock")
+	first.SetExpire(10)
+	ok, err := first.Acquire()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	token := first.Token()
+	assert.True(t, token > 0)
+
+	second := redis.NewRedisLock(rds, "lock")
+	ok, err = second.Acquire()
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// acquiring again by the holder refreshes the expiry, and keeps the token
+	s.FastForward(5 * time.Second)
+	ok, err = first.Acquire()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, s.TTL("lock") > 10*time.Second)
+	assert.Equal(t, token, first.Token())
+
+	// released by one Release, even acquired twice
+	ok, err = first.Release()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), first.Token())
+	ok, err = second.Acquire()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// the token increases on each new holder
+	assert.Equal(t, token+1, second.Token())
+
+	// not released by the others
+	ok, err = first.Release()
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, ok = s.Get("lock")
+	assert.True(t, ok)
+}
+
+func TestRedisLockReentrant(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	lock := redis.NewReentrantRedisLock(rds, "lock")
+	lock.SetExpire(100)
+	ok, err := lock.Acquire()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	token := lock.Token()
+
+	// the inner acquiring doesn't shorten the expiry of the outer one
+	lock.SetExpire(10)
+	ok, err = lock.Acquire()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, s.TTL("lock") > 90*time.Second)
+	assert.Equal(t, token, lock.Token())
+
+	ok, err = lock.Release()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// still held by the outer one
+	_, ok = s.Get("lock")
+	assert.True(t, ok)
+	assert.Equal(t, token, lock.Token())
+
+	ok, err = lock.Release()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, ok = s.Get("lock")
+	assert.False(t, ok)
+}
+
+func TestRedisLockAcquireCtx(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	first := redis.NewRedisLock(rds, "lock")
+	token, err := first.AcquireCtx(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, token > 0)
+
+	// times out while held by the others
+	second := redis.NewRedisLock(rds, "lock")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	start := time.Now()
+	_, err = second.AcquireCtx(ctx)
+	cancel()
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	// blocks until released
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		secondToken, err := second.AcquireCtx(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, token+1, secondToken)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	ok, err := first.Release()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	wg.Wait()
+
+	ok, err = second.Release()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestRedisLockWatchdog(t *testing.T) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	lock := redis.NewRedisLock(rds, "lock")
+	// renewed every second
+	lock.SetExpire(3)
+	token, err := lock.AcquireCtx(context.Background())
+	assert.Nil(t, err)
+
+	// the expiry is renewed by the watchdog
+	s.FastForward(2 * time.Second)
+	assert.True(t, s.TTL("lock") < 2*time.Second)
+	var renewed bool
+	for i := 0; i < 30 && !renewed; i++ {
+		time.Sleep(100 * time.Millisecond)
+		renewed = s.TTL("lock") > 2*time.Second
+	}
+	assert.True(t, renewed)
+	assert.Equal(t, token, lock.Token())
+
+	// the state is cleared after the lock is lost
+	_, err = rds.Del("lock")
+	assert.Nil(t, err)
+	var lost bool
+	for i := 0; i < 30 && !lost; i++ {
+		time.Sleep(100 * time.Millisecond)
+		lost = lock.Token() == 0
+	}
+	assert.True(t, lost)
+
+	// acquired again with a new token and a new watchdog
+	newToken, err := lock.AcquireCtx(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, token+1, newToken)
+	ok, err := lock.Release()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
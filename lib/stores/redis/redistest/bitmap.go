@@ -0,0 +1,185 @@
+package redistest
+
+import (
+	"errors"
+	"math/bits"
+	"strconv"
+)
+
+var (
+	errBitOffset = errors.New("ERR bit offset is not an integer or out of range")
+	errBitValue  = errors.New("ERR bit is not an integer or out of range")
+)
+
+// the bitmaps are the strings, the bits of each byte are counted from the most significant one.
+
+// lookupString returns the string value of key, must be called with the lock held.
+func (s *Server) lookupString(key string) (string, bool, error) {
+	switch val := s.lookup(key).(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return val, true, nil
+	default:
+		return "", false, errWrongType
+	}
+}
+
+// byteRange converts the inclusive byte range of BITCOUNT and BITPOS to the valid indexes.
+func byteRange(args []string, n int) (int, int, bool, error) {
+	start, stop := 0, n-1
+	if len(args) > 0 {
+		var err error
+		if start, err = strconv.Atoi(args[0]); err != nil {
+			return 0, 0, false, errNotInt
+		}
+		if len(args) > 1 {
+			if stop, err = strconv.Atoi(args[1]); err != nil {
+				return 0, 0, false, errNotInt
+			}
+		}
+	}
+
+	start, stop, ok := indexRange(start, stop, n)
+	return start, stop, ok, nil
+}
+
+// bitcount supports BITCOUNT key [start end]
+func bitcount(s *Server, args []string) reply {
+	if len(args) != 1 && len(args) != 3 {
+		return errSyntax
+	}
+
+	val, _, err := s.lookupString(args[0])
+	if err != nil {
+		return err
+	}
+
+	start, stop, ok, err := byteRange(args[1:], len(val))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return 0
+	}
+
+	var n int
+	for i := start; i <= stop; i++ {
+		n += bits.OnesCount8(val[i])
+	}
+
+	return n
+}
+
+// bitpos supports BITPOS key bit [start [end]]
+func bitpos(s *Server, args []string) reply {
+	if len(args) < 2 || len(args) > 4 {
+		return errSyntax
+	}
+
+	if args[1] != "0" && args[1] != "1" {
+		return errBitValue
+	}
+	bit := args[1] == "1"
+
+	val, found, err := s.lookupString(args[0])
+	if err != nil {
+		return err
+	}
+	if !found {
+		if bit {
+			return -1
+		}
+		return 0
+	}
+
+	start, stop, ok, err := byteRange(args[2:], len(val))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return -1
+	}
+
+	for i := start; i <= stop; i++ {
+		for j := 0; j < 8; j++ {
+			if (val[i]&(0x80>>uint(j)) != 0) == bit {
+				return i*8 + j
+			}
+		}
+	}
+
+	// the clear bits are looked for beyond the string if the end is not given
+	if !bit && len(args) < 4 {
+		return (stop + 1) * 8
+	}
+
+	return -1
+}
+
+func getbit(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	offset, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return errBitOffset
+	}
+
+	val, _, err := s.lookupString(args[0])
+	if err != nil {
+		return err
+	}
+
+	index := int(offset / 8)
+	if index >= len(val) || val[index]&(0x80>>(offset%8)) == 0 {
+		return 0
+	}
+
+	return 1
+}
+
+func setbit(s *Server, args []string) reply {
+	if len(args) != 3 {
+		return errSyntax
+	}
+
+	offset, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return errBitOffset
+	}
+	if args[2] != "0" && args[2] != "1" {
+		return errBitValue
+	}
+
+	val, _, err := s.lookupString(args[0])
+	if err != nil {
+		return err
+	}
+
+	index := int(offset / 8)
+	b := []byte(val)
+	if index >= len(b) {
+		b = append(b, make([]byte, index+1-len(b))...)
+	}
+
+	mask := byte(0x80 >> (offset % 8))
+	var old int
+	if b[index]&mask != 0 {
+		old = 1
+	}
+	if args[2] == "1" {
+		b[index] |= mask
+	} else {
+		b[index] &^= mask
+	}
+
+	if e, ok := s.data[args[0]]; ok {
+		e.value = string(b)
+	} else {
+		s.data[args[0]] = &entry{value: string(b)}
+	}
+
+	return old
+}
@@ -0,0 +1,271 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the earth radius used by redis, in meters
+const earthRadius = 6372797.560856
+
+var (
+	errBadCoordinates = errors.New("ERR invalid longitude,latitude pair")
+	errBadUnit        = errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+	errNoMember       = errors.New("ERR could not decode requested zset member")
+	units             = map[string]float64{
+		"m":  1,
+		"km": 1000,
+		"ft": 0.3048,
+		"mi": 1609.34,
+	}
+)
+
+type (
+	// geo maps the members to the coordinates.
+	geo map[string]coordinate
+
+	coordinate struct {
+		longitude float64
+		latitude  float64
+	}
+
+	geoResult struct {
+		member string
+		coordinate
+		dist float64
+	}
+)
+
+// distance returns the distance between c and other in meters by the haversine formula.
+func (c coordinate) distance(other coordinate) float64 {
+	lat1, lat2 := radians(c.latitude), radians(other.latitude)
+	u := math.Sin((lat2 - lat1) / 2)
+	v := math.Sin(radians(other.longitude-c.longitude) / 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1)*math.Cos(lat2)*v*v))
+}
+
+// lookupGeo returns the geospatial index of key, creates it if create is true and not exists,
+// must be called with the lock held.
+func (s *Server) lookupGeo(key string, create bool) (geo, error) {
+	switch val := s.lookup(key).(type) {
+	case nil:
+		if !create {
+			return nil, nil
+		}
+		g := make(geo)
+		s.data[key] = &entry{value: g}
+		return g, nil
+	case geo:
+		return val, nil
+	default:
+		return nil, errWrongType
+	}
+}
+
+func parseCoordinate(lon, lat string) (coordinate, error) {
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return coordinate{}, errNotFloat
+	}
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return coordinate{}, errNotFloat
+	}
+	if longitude < -180 || longitude > 180 || latitude < -85.05112878 || latitude > 85.05112878 {
+		return coordinate{}, errBadCoordinates
+	}
+
+	return coordinate{longitude: longitude, latitude: latitude}, nil
+}
+
+func parseUnit(unit string) (float64, error) {
+	if factor, ok := units[strings.ToLower(unit)]; ok {
+		return factor, nil
+	}
+
+	return 0, errBadUnit
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// geoadd supports GEOADD key longitude latitude member [longitude latitude member ...]
+func geoadd(s *Server, args []string) reply {
+	if len(args) < 4 || (len(args)-1)%3 != 0 {
+		return errSyntax
+	}
+
+	coords := make([]coordinate, 0, (len(args)-1)/3)
+	for i := 1; i < len(args); i += 3 {
+		c, err := parseCoordinate(args[i], args[i+1])
+		if err != nil {
+			return err
+		}
+		coords = append(coords, c)
+	}
+
+	g, err := s.lookupGeo(args[0], true)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	for i, c := range coords {
+		member := args[i*3+3]
+		if _, ok := g[member]; !ok {
+			n++
+		}
+		g[member] = c
+	}
+
+	return n
+}
+
+// geosearch supports GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius unit|BYBOX width height unit [ASC|DESC] [COUNT count] [WITHCOORD] [WITHDIST]
+func geosearch(s *Server, args []string) reply {
+	if len(args) < 1 {
+		return errSyntax
+	}
+
+	g, err := s.lookupGeo(args[0], false)
+	if err != nil {
+		return err
+	}
+
+	var center *coordinate
+	var radius, width, height, factor float64
+	var sorting string
+	var count int
+	var withCoord, withDist bool
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "frommember":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			c, ok := g[args[i+1]]
+			if !ok {
+				return errNoMember
+			}
+			center = &c
+			i++
+		case "fromlonlat":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			c, err := parseCoordinate(args[i+1], args[i+2])
+			if err != nil {
+				return err
+			}
+			center = &c
+			i += 2
+		case "byradius":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			if radius, err = strconv.ParseFloat(args[i+1], 64); err != nil || radius <= 0 {
+				return errNotFloat
+			}
+			if factor, err = parseUnit(args[i+2]); err != nil {
+				return err
+			}
+			i += 2
+		case "bybox":
+			if i+3 >= len(args) {
+				return errSyntax
+			}
+			if width, err = strconv.ParseFloat(args[i+1], 64); err != nil || width <= 0 {
+				return errNotFloat
+			}
+			if height, err = strconv.ParseFloat(args[i+2], 64); err != nil || height <= 0 {
+				return errNotFloat
+			}
+			if factor, err = parseUnit(args[i+3]); err != nil {
+				return err
+			}
+			i += 3
+		case "asc", "desc":
+			sorting = strings.ToLower(args[i])
+		case "count":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count <= 0 {
+				return errors.New("ERR COUNT must be > 0")
+			}
+			i++
+		case "withcoord":
+			withCoord = true
+		case "withdist":
+			withDist = true
+		default:
+			return errSyntax
+		}
+	}
+	if center == nil || factor == 0 {
+		return errSyntax
+	}
+
+	var results []geoResult
+	for member, c := range g {
+		dist := center.distance(c)
+		if radius > 0 {
+			if dist > radius*factor {
+				continue
+			}
+		} else {
+			dx := center.distance(coordinate{longitude: c.longitude, latitude: center.latitude})
+			dy := center.distance(coordinate{longitude: center.longitude, latitude: c.latitude})
+			if dx > width*factor/2 || dy > height*factor/2 {
+				continue
+			}
+		}
+
+		results = append(results, geoResult{
+			member:     member,
+			coordinate: c,
+			dist:       dist / factor,
+		})
+	}
+
+	// the count without sorting returns the nearest ones like redis
+	if len(sorting) > 0 || count > 0 {
+		sort.Slice(results, func(i, j int) bool {
+			if sorting == "desc" {
+				return results[i].dist > results[j].dist
+			}
+			return results[i].dist < results[j].dist
+		})
+	}
+	if count > 0 && count < len(results) {
+		results = results[:count]
+	}
+
+	items := make([]interface{}, len(results))
+	for i, result := range results {
+		if !withCoord && !withDist {
+			items[i] = result.member
+			continue
+		}
+
+		item := []interface{}{result.member}
+		if withDist {
+			item = append(item, fmt.Sprintf("%.4f", result.dist))
+		}
+		if withCoord {
+			item = append(item, []interface{}{
+				strconv.FormatFloat(result.longitude, 'f', -1, 64),
+				strconv.FormatFloat(result.latitude, 'f', -1, 64),
+			})
+		}
+		items[i] = item
+	}
+
+	return items
+}
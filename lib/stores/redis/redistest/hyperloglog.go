@@ -0,0 +1,92 @@
+package redistest
+
+// hyperLogLog keeps the exact elements, so the counts are accurate in the tests.
+type hyperLogLog map[string]struct{}
+
+// lookupHyperLogLog returns the HyperLogLog of key, creates it if create is true and not exists,
+// must be called with the lock held.
+func (s *Server) lookupHyperLogLog(key string, create bool) (hyperLogLog, bool, error) {
+	switch val := s.lookup(key).(type) {
+	case nil:
+		if !create {
+			return nil, false, nil
+		}
+		h := make(hyperLogLog)
+		s.data[key] = &entry{value: h}
+		return h, true, nil
+	case hyperLogLog:
+		return val, false, nil
+	default:
+		return nil, false, errWrongType
+	}
+}
+
+func pfadd(s *Server, args []string) reply {
+	if len(args) < 1 {
+		return errSyntax
+	}
+
+	h, created, err := s.lookupHyperLogLog(args[0], true)
+	if err != nil {
+		return err
+	}
+
+	changed := created
+	for _, element := range args[1:] {
+		if _, ok := h[element]; !ok {
+			h[element] = struct{}{}
+			changed = true
+		}
+	}
+
+	if changed {
+		return 1
+	}
+	return 0
+}
+
+func pfcount(s *Server, args []string) reply {
+	if len(args) < 1 {
+		return errSyntax
+	}
+
+	union := make(map[string]struct{})
+	for _, key := range args {
+		h, _, err := s.lookupHyperLogLog(key, false)
+		if err != nil {
+			return err
+		}
+		for element := range h {
+			union[element] = struct{}{}
+		}
+	}
+
+	return len(union)
+}
+
+func pfmerge(s *Server, args []string) reply {
+	if len(args) < 1 {
+		return errSyntax
+	}
+
+	sources := make([]hyperLogLog, 0, len(args)-1)
+	for _, key := range args[1:] {
+		h, _, err := s.lookupHyperLogLog(key, false)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, h)
+	}
+
+	dest, _, err := s.lookupHyperLogLog(args[0], true)
+	if err != nil {
+		return err
+	}
+	for _, h := range sources {
+		for element := range h {
+			dest[element] = struct{}{}
+		}
+	}
+
+	return simpleString("OK")
+}
@@ -0,0 +1,280 @@
+package redistest
+
+import (
+	"errors"
+	"strconv"
+)
+
+var (
+	errNoSuchKey  = errors.New("ERR no such key")
+	errOutOfRange = errors.New("ERR index out of range")
+)
+
+// list is the list of the values, the key is deleted when the list is empty.
+type list struct {
+	values []string
+}
+
+// lookupList returns the list of key, creates it if create is true and not exists,
+// must be called with the lock held.
+func (s *Server) lookupList(key string, create bool) (*list, error) {
+	switch val := s.lookup(key).(type) {
+	case nil:
+		if !create {
+			return nil, nil
+		}
+		l := new(list)
+		s.data[key] = &entry{value: l}
+		return l, nil
+	case *list:
+		return val, nil
+	default:
+		return nil, errWrongType
+	}
+}
+
+// cleanList deletes key if l is empty, must be called with the lock held.
+func (s *Server) cleanList(key string, l *list) {
+	if l != nil && len(l.values) == 0 {
+		delete(s.data, key)
+	}
+}
+
+// indexRange converts the inclusive start and stop, which might be negative to count from the end,
+// to the valid indexes of n elements, returns false if the range is empty.
+func indexRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	return start, stop, start <= stop && start < n
+}
+
+func lindex(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInt
+	}
+
+	l, err := s.lookupList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return nil
+	}
+
+	if index < 0 {
+		index += len(l.values)
+	}
+	if index < 0 || index >= len(l.values) {
+		return nil
+	}
+
+	return l.values[index]
+}
+
+func llen(s *Server, args []string) reply {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	l, err := s.lookupList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return 0
+	}
+
+	return len(l.values)
+}
+
+func lpop(s *Server, args []string) reply {
+	return pop(s, args, true)
+}
+
+func lpush(s *Server, args []string) reply {
+	return push(s, args, true)
+}
+
+func lrange(s *Server, args []string) reply {
+	if len(args) != 3 {
+		return errSyntax
+	}
+
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInt
+	}
+	stop, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errNotInt
+	}
+
+	l, err := s.lookupList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return []string{}
+	}
+
+	start, stop, ok := indexRange(start, stop, len(l.values))
+	if !ok {
+		return []string{}
+	}
+
+	return append([]string(nil), l.values[start:stop+1]...)
+}
+
+func lset(s *Server, args []string) reply {
+	if len(args) != 3 {
+		return errSyntax
+	}
+
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInt
+	}
+
+	l, err := s.lookupList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return errNoSuchKey
+	}
+
+	if index < 0 {
+		index += len(l.values)
+	}
+	if index < 0 || index >= len(l.values) {
+		return errOutOfRange
+	}
+
+	l.values[index] = args[2]
+	return simpleString("OK")
+}
+
+func ltrim(s *Server, args []string) reply {
+	if len(args) != 3 {
+		return errSyntax
+	}
+
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInt
+	}
+	stop, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errNotInt
+	}
+
+	l, err := s.lookupList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return simpleString("OK")
+	}
+
+	if start, stop, ok := indexRange(start, stop, len(l.values)); ok {
+		l.values = l.values[start : stop+1]
+	} else {
+		l.values = nil
+	}
+	s.cleanList(args[0], l)
+
+	return simpleString("OK")
+}
+
+// pop handles LPOP and RPOP without count.
+func pop(s *Server, args []string, left bool) reply {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	l, err := s.lookupList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return nil
+	}
+
+	var val string
+	if left {
+		val, l.values = l.values[0], l.values[1:]
+	} else {
+		val, l.values = l.values[len(l.values)-1], l.values[:len(l.values)-1]
+	}
+	s.cleanList(args[0], l)
+
+	return val
+}
+
+// push handles LPUSH and RPUSH.
+func push(s *Server, args []string, left bool) reply {
+	if len(args) < 2 {
+		return errSyntax
+	}
+
+	l, err := s.lookupList(args[0], true)
+	if err != nil {
+		return err
+	}
+
+	for _, val := range args[1:] {
+		if left {
+			l.values = append([]string{val}, l.values...)
+		} else {
+			l.values = append(l.values, val)
+		}
+	}
+
+	return len(l.values)
+}
+
+func rpop(s *Server, args []string) reply {
+	return pop(s, args, false)
+}
+
+func rpoplpush(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	src, err := s.lookupList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		return nil
+	}
+	if _, err := s.lookupList(args[1], false); err != nil {
+		return err
+	}
+
+	val := pop(s, args[:1], false)
+	push(s, []string{args[1], val.(string)}, true)
+
+	return val
+}
+
+func rpush(s *Server, args []string) reply {
+	return push(s, args, false)
+}
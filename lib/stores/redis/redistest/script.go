@@ -0,0 +1,269 @@
+package redistest
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+var errNoScript = errors.New("NOSCRIPT No matching script. Please use EVAL.")
+
+// registered on init, because the scripts call the other commands in the map.
+func init() {
+	commands["eval"] = eval
+	commands["evalsha"] = evalsha
+	commands["script"] = script
+}
+
+// FlushScripts removes the loaded scripts, used to simulate the restarts of redis,
+// the later EVALSHA calls are replied with NOSCRIPT.
+func (s *Server) FlushScripts() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.scripts = make(map[string]string)
+}
+
+// eval supports EVAL script numkeys [key ...] [arg ...]
+func eval(s *Server, args []string) reply {
+	if len(args) < 2 {
+		return errSyntax
+	}
+
+	s.scripts[scriptSha(args[0])] = args[0]
+	return runScript(s, args[0], args[1:])
+}
+
+// evalsha supports EVALSHA sha numkeys [key ...] [arg ...]
+func evalsha(s *Server, args []string) reply {
+	if len(args) < 2 {
+		return errSyntax
+	}
+
+	body, ok := s.scripts[strings.ToLower(args[0])]
+	if !ok {
+		return errNoScript
+	}
+
+	return runScript(s, body, args[1:])
+}
+
+// script supports SCRIPT LOAD script, SCRIPT EXISTS sha [sha ...] and SCRIPT FLUSH
+func script(s *Server, args []string) reply {
+	if len(args) == 0 {
+		return errSyntax
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "load":
+		if len(args) != 2 {
+			return errSyntax
+		}
+		sha := scriptSha(args[1])
+		s.scripts[sha] = args[1]
+		return sha
+	case "exists":
+		var replies []interface{}
+		for _, sha := range args[1:] {
+			if _, ok := s.scripts[strings.ToLower(sha)]; ok {
+				replies = append(replies, 1)
+			} else {
+				replies = append(replies, 0)
+			}
+		}
+		return replies
+	case "flush":
+		s.scripts = make(map[string]string)
+		return simpleString("OK")
+	default:
+		return errSyntax
+	}
+}
+
+// runScript runs the lua script with the lock held, so that the scripts are atomic like on redis,
+// the commands blocked in the scripts are replied with nil instead of waiting.
+func runScript(s *Server, body string, args []string) reply {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys < 0 {
+		return errNotInt
+	}
+	if numKeys > len(args)-1 {
+		return errors.New("ERR Number of keys can't be greater than number of args")
+	}
+
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	L.SetGlobal("KEYS", stringsTable(L, args[1:numKeys+1]))
+	L.SetGlobal("ARGV", stringsTable(L, args[numKeys+1:]))
+	redisTable := L.NewTable()
+	L.SetFuncs(redisTable, map[string]lua.LGFunction{
+		"call": func(L *lua.LState) int {
+			return callCommand(s, L, true)
+		},
+		"pcall": func(L *lua.LState) int {
+			return callCommand(s, L, false)
+		},
+		"error_reply": func(L *lua.LState) int {
+			t := L.NewTable()
+			t.RawSetString("err", lua.LString(L.CheckString(1)))
+			L.Push(t)
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			t := L.NewTable()
+			t.RawSetString("ok", lua.LString(L.CheckString(1)))
+			L.Push(t)
+			return 1
+		},
+	})
+	L.SetGlobal("redis", redisTable)
+
+	if err := L.DoString(body); err != nil {
+		// the error replies are single lines, without the stack tracebacks
+		msg := err.Error()
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			msg = apiErr.Object.String()
+		}
+		return fmt.Errorf("ERR Error running script: %s", strings.Replace(msg, "\n", " ", -1))
+	}
+	if L.GetTop() == 0 {
+		return nil
+	}
+
+	return toReply(L.Get(-1))
+}
+
+// callCommand executes the command of redis.call or redis.pcall, the errors are raised on redis.call,
+// and returned as the error replies on redis.pcall.
+func callCommand(s *Server, L *lua.LState, raise bool) int {
+	n := L.GetTop()
+	if n == 0 {
+		L.RaiseError("Please specify at least one argument for redis.call()")
+	}
+
+	args := make([]string, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			args[i-1] = string(v)
+		case lua.LNumber:
+			args[i-1] = v.String()
+		default:
+			L.RaiseError("Lua redis() command arguments must be strings or integers")
+		}
+	}
+
+	var r reply
+	if cmd, ok := commands[strings.ToLower(args[0])]; !ok {
+		r = errors.New("ERR Unknown Redis command called from Lua script")
+	} else if r = cmd(s, args[1:]); r != nil {
+		if _, ok := r.(blocked); ok {
+			r = nil
+		}
+	}
+
+	if err, ok := r.(error); ok && raise {
+		L.RaiseError("%s", err.Error())
+	}
+
+	L.Push(toLua(L, r))
+	return 1
+}
+
+// toLua converts the reply of the commands to the lua value like redis.
+func toLua(L *lua.LState, r reply) lua.LValue {
+	switch v := r.(type) {
+	case nil:
+		return lua.LFalse
+	case error:
+		t := L.NewTable()
+		t.RawSetString("err", lua.LString(v.Error()))
+		return t
+	case simpleString:
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(v))
+		return t
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []string:
+		return stringsTable(L, v)
+	case []interface{}:
+		t := L.NewTable()
+		for _, item := range v {
+			t.Append(toLua(L, item))
+		}
+		return t
+	default:
+		return lua.LFalse
+	}
+}
+
+// toReply converts the lua value returned by the scripts to the reply like redis, the numbers are
+// truncated to integers, true to 1, false to nil, and the arrays are truncated on the first nil.
+func toReply(value lua.LValue) reply {
+	switch v := value.(type) {
+	case lua.LNumber:
+		return int64(v)
+	case lua.LString:
+		return string(v)
+	case lua.LBool:
+		if v {
+			return 1
+		}
+		return nil
+	case *lua.LTable:
+		if err, ok := v.RawGetString("err").(lua.LString); ok {
+			return errors.New(string(err))
+		}
+		if status, ok := v.RawGetString("ok").(lua.LString); ok {
+			return simpleString(status)
+		}
+
+		replies := make([]interface{}, 0)
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			replies = append(replies, toReply(item))
+		}
+		return replies
+	default:
+		return nil
+	}
+}
+
+func stringsTable(L *lua.LState, values []string) *lua.LTable {
+	t := L.NewTable()
+	for _, value := range values {
+		t.Append(lua.LString(value))
+	}
+
+	return t
+}
+
+func scriptSha(body string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(body)))
+}
@@ -0,0 +1,999 @@
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vsaien/cuter/lib/stores/redis"
+)
+
+// the interval to execute the blocked commands again
+const blockInterval = 10 * time.Millisecond
+
+var (
+	errSyntax    = errors.New("ERR syntax error")
+	errNotInt    = errors.New("ERR value is not an integer or out of range")
+	errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+)
+
+type (
+	// Server is an in-memory redis server speaking RESP, used in the unit tests.
+	// Only a subset of the commands is supported, the unknown commands are replied with errors.
+	Server struct {
+		listener net.Listener
+		lock     sync.Mutex
+		data     map[string]*entry
+		conns    map[net.Conn]struct{}
+		// the subscribed clients of the channels and the patterns
+		channels map[string]map[*client]struct{}
+		patterns map[string]map[*client]struct{}
+		// the loaded scripts by their sha1 digests
+		scripts map[string]string
+		done    chan struct{}
+		once    sync.Once
+	}
+
+	client struct {
+		lock   sync.Mutex
+		writer *bufio.Writer
+		// the subscribed channels and patterns, guarded by the lock of the server
+		channels map[string]struct{}
+		patterns map[string]struct{}
+		// the state of MULTI, the queued commands are executed by EXEC
+		multi  bool
+		queued [][]string
+		// whether the transaction is aborted by the errors on queuing
+		aborted bool
+	}
+
+	entry struct {
+		value    interface{}
+		expireAt time.Time
+	}
+
+	// the reply written back to the clients, can be nil, error, int, int64, string,
+	// simpleString, []string and []interface{} of them.
+	reply interface{}
+
+	simpleString string
+
+	// the reply of the blocking commands without results, the commands are executed again until
+	// the results available or blocked longer than the duration, 0 means forever.
+	blocked time.Duration
+
+	command func(s *Server, args []string) reply
+
+	// the commands depending on the state of the connections, like SUBSCRIBE, which might reply
+	// multiple times.
+	clientCommand func(s *Server, c *client, args []string) []reply
+)
+
+var commands = map[string]command{
+	"bitcount":         bitcount,
+	"bitpos":           bitpos,
+	"del":              del,
+	"echo":             echo,
+	"exists":           exists,
+	"expire":           expire,
+	"flushall":         flushAll,
+	"flushdb":          flushAll,
+	"geoadd":           geoadd,
+	"geosearch":        geosearch,
+	"get":              get,
+	"getbit":           getbit,
+	"getset":           getset,
+	"hgetall":          hgetall,
+	"hset":             hset,
+	"incr":             incr,
+	"incrby":           incrBy,
+	"incrbyfloat":      incrByFloat,
+	"lindex":           lindex,
+	"llen":             llen,
+	"lpop":             lpop,
+	"lpush":            lpush,
+	"lrange":           lrange,
+	"lset":             lset,
+	"ltrim":            ltrim,
+	"mget":             mget,
+	"pfadd":            pfadd,
+	"pfcount":          pfcount,
+	"pfmerge":          pfmerge,
+	"pexpire":          pexpire,
+	"pttl":             pttl,
+	"publish":          publish,
+	"rpop":             rpop,
+	"rpoplpush":        rpoplpush,
+	"rpush":            rpush,
+	"set":              set,
+	"setbit":           setbit,
+	"setex":            setex,
+	"setnx":            setnx,
+	"ttl":              ttl,
+	"xack":             xack,
+	"xadd":             xadd,
+	"xautoclaim":       xautoclaim,
+	"xgroup":           xgroup,
+	"xlen":             xlen,
+	"xpending":         xpending,
+	"xrange":           xrange,
+	"xreadgroup":       xreadgroup,
+	"zadd":             zadd,
+	"zcard":            zcard,
+	"zcount":           zcount,
+	"zincrby":          zincrby,
+	"zinterstore":      zinterstore,
+	"zrange":           zrange,
+	"zrangebylex":      zrangebylex,
+	"zrangebyscore":    zrangebyscore,
+	"zrank":            zrank,
+	"zrem":             zrem,
+	"zremrangebyscore": zremrangebyscore,
+	"zrevrange":        zrevrange,
+	"zrevrangebyscore": zrevrangebyscore,
+	"zscore":           zscore,
+	"zunionstore":      zunionstore,
+}
+
+var clientCommands = map[string]clientCommand{
+	"discard":      discard,
+	"exec":         exec,
+	"multi":        multi,
+	"ping":         ping,
+	"psubscribe":   psubscribe,
+	"punsubscribe": punsubscribe,
+	"subscribe":    subscribe,
+	"unsubscribe":  unsubscribe,
+}
+
+// NewServer starts a server on a random port of localhost.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+		data:     make(map[string]*entry),
+		conns:    make(map[net.Conn]struct{}),
+		channels: make(map[string]map[*client]struct{}),
+		patterns: make(map[string]map[*client]struct{}),
+		scripts:  make(map[string]string),
+		done:     make(chan struct{}),
+	}
+	go s.serve()
+
+	return s, nil
+}
+
+// CreateRedis starts a server and returns the node type redis on it, the returned func closes the server.
+func CreateRedis() (*redis.Redis, func(), error) {
+	s, err := NewServer()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return redis.NewRedis(s.Addr(), redis.NodeType), s.Close, nil
+}
+
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close closes the server and the connections, it's safe to be called multiple times.
+func (s *Server) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.listener.Close()
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+	})
+}
+
+// DropConnections closes the connections of the clients, used to simulate the network failures,
+// the server keeps accepting the new connections.
+func (s *Server) DropConnections() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// FastForward moves the time of the expiries forward by duration.
+func (s *Server) FastForward(duration time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, e := range s.data {
+		if !e.expireAt.IsZero() {
+			e.expireAt = e.expireAt.Add(-duration)
+		}
+	}
+}
+
+// Get returns the string value of key, used to check the data in the tests.
+func (s *Server) Get(key string) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	val, ok := s.lookup(key).(string)
+	return val, ok
+}
+
+// Set sets the string value of key without expiry, used to prepare the data in the tests.
+func (s *Server) Set(key, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data[key] = &entry{value: value}
+}
+
+// TTL returns the time to live of key, 0 if the key has no expiry or doesn't exist.
+func (s *Server) TTL(key string) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.lookup(key) == nil || s.data[key].expireAt.IsZero() {
+		return 0
+	}
+
+	return time.Until(s.data[key].expireAt)
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.lock.Lock()
+		select {
+		case <-s.done:
+			s.lock.Unlock()
+			conn.Close()
+			return
+		default:
+			s.conns[conn] = struct{}{}
+		}
+		s.lock.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	c := &client{
+		writer:   bufio.NewWriter(conn),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, conn)
+		for channel := range c.channels {
+			s.leave(c, channel)
+		}
+		for pattern := range c.patterns {
+			s.pleave(c, pattern)
+		}
+		s.lock.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		var replies []reply
+		name := strings.ToLower(args[0])
+		if c.multi && name != "exec" && name != "discard" && name != "multi" {
+			replies = []reply{c.queue(args)}
+		} else if cmd, ok := commands[name]; ok {
+			replies = []reply{s.execute(cmd, args[1:])}
+		} else if cmd, ok := clientCommands[name]; ok {
+			s.lock.Lock()
+			replies = cmd(s, c, args[1:])
+			s.lock.Unlock()
+		} else {
+			replies = []reply{fmt.Errorf("ERR unknown command '%s'", args[0])}
+		}
+
+		// flush when the pipelined commands are all handled
+		if err := c.write(replies, reader.Buffered() == 0); err != nil {
+			return
+		}
+	}
+}
+
+// execute executes cmd with args, the blocked commands are executed again until the results
+// available or timeout.
+func (s *Server) execute(cmd command, args []string) reply {
+	var deadline time.Time
+	for {
+		s.lock.Lock()
+		r := cmd(s, args)
+		s.lock.Unlock()
+
+		timeout, ok := r.(blocked)
+		if !ok {
+			return r
+		}
+		if timeout > 0 {
+			if deadline.IsZero() {
+				deadline = time.Now().Add(time.Duration(timeout))
+			} else if !time.Now().Before(deadline) {
+				return nil
+			}
+		}
+
+		select {
+		case <-s.done:
+			return nil
+		case <-time.After(blockInterval):
+		}
+	}
+}
+
+// leave unsubscribes c from channel, must be called with the lock held.
+func (s *Server) leave(c *client, channel string) {
+	delete(c.channels, channel)
+	delete(s.channels[channel], c)
+	if len(s.channels[channel]) == 0 {
+		delete(s.channels, channel)
+	}
+}
+
+// pleave unsubscribes c from pattern, must be called with the lock held.
+func (s *Server) pleave(c *client, pattern string) {
+	delete(c.patterns, pattern)
+	delete(s.patterns[pattern], c)
+	if len(s.patterns[pattern]) == 0 {
+		delete(s.patterns, pattern)
+	}
+}
+
+// lookup returns the value of key, nil if not exists or expired, must be called with the lock held.
+func (s *Server) lookup(key string) interface{} {
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+
+	if !e.expireAt.IsZero() && !time.Now().Before(e.expireAt) {
+		delete(s.data, key)
+		return nil
+	}
+
+	return e.value
+}
+
+func (c *client) queue(args []string) reply {
+	if _, ok := commands[strings.ToLower(args[0])]; !ok {
+		c.aborted = true
+		return fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+
+	c.queued = append(c.queued, args)
+	return simpleString("QUEUED")
+}
+
+// subscriptions returns the number of the subscribed channels and patterns, must be called
+// with the lock of the server held.
+func (c *client) subscriptions() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+func (c *client) reset() {
+	c.multi = false
+	c.queued = nil
+	c.aborted = false
+}
+
+func (c *client) write(replies []reply, flush bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, r := range replies {
+		writeReply(c.writer, r)
+	}
+	if flush {
+		return c.writer.Flush()
+	}
+
+	return nil
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		// the inline commands, like PING
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("expect bulk string, got %q", line)
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeReply(writer *bufio.Writer, r reply) {
+	switch v := r.(type) {
+	case nil:
+		writer.WriteString("$-1\r\n")
+	case error:
+		writer.WriteString("-" + v.Error() + "\r\n")
+	case simpleString:
+		writer.WriteString("+" + string(v) + "\r\n")
+	case int:
+		writer.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case int64:
+		writer.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case string:
+		writer.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case []string:
+		writer.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(writer, item)
+		}
+	case []interface{}:
+		writer.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(writer, item)
+		}
+	default:
+		writer.WriteString(fmt.Sprintf("-ERR unknown reply type %T\r\n", r))
+	}
+}
+
+func del(s *Server, args []string) reply {
+	var n int
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			delete(s.data, key)
+			n++
+		}
+	}
+
+	return n
+}
+
+func discard(_ *Server, c *client, _ []string) []reply {
+	if !c.multi {
+		return []reply{errors.New("ERR DISCARD without MULTI")}
+	}
+
+	c.reset()
+	return []reply{simpleString("OK")}
+}
+
+func echo(_ *Server, args []string) reply {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	return args[0]
+}
+
+func exists(s *Server, args []string) reply {
+	var n int
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+func exec(s *Server, c *client, _ []string) []reply {
+	if !c.multi {
+		return []reply{errors.New("ERR EXEC without MULTI")}
+	}
+
+	defer c.reset()
+	if c.aborted {
+		return []reply{errors.New("EXECABORT Transaction discarded because of previous errors.")}
+	}
+
+	replies := make([]interface{}, len(c.queued))
+	for i, args := range c.queued {
+		r := commands[strings.ToLower(args[0])](s, args[1:])
+		// the blocking commands don't block in transactions
+		if _, ok := r.(blocked); ok {
+			r = nil
+		}
+		replies[i] = r
+	}
+
+	return []reply{replies}
+}
+
+func expire(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	seconds, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInt
+	}
+	if s.lookup(args[0]) == nil {
+		return 0
+	}
+
+	s.data[args[0]].expireAt = time.Now().Add(time.Duration(seconds) * time.Second)
+	return 1
+}
+
+func flushAll(s *Server, _ []string) reply {
+	s.data = make(map[string]*entry)
+	return simpleString("OK")
+}
+
+func get(s *Server, args []string) reply {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	switch val := s.lookup(args[0]).(type) {
+	case nil:
+		return nil
+	case string:
+		return val
+	default:
+		return errWrongType
+	}
+}
+
+func getset(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	val, found, err := s.lookupString(args[0])
+	if err != nil {
+		return err
+	}
+
+	s.data[args[0]] = &entry{value: args[1]}
+	if !found {
+		return nil
+	}
+
+	return val
+}
+
+func hgetall(s *Server, args []string) reply {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	switch val := s.lookup(args[0]).(type) {
+	case nil:
+		return []string{}
+	case map[string]string:
+		ret := make([]string, 0, 2*len(val))
+		for field, value := range val {
+			ret = append(ret, field, value)
+		}
+		return ret
+	default:
+		return errWrongType
+	}
+}
+
+// hset supports HSET key field value [field value ...]
+func hset(s *Server, args []string) reply {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return errSyntax
+	}
+
+	var hash map[string]string
+	switch val := s.lookup(args[0]).(type) {
+	case nil:
+		hash = make(map[string]string)
+		s.data[args[0]] = &entry{value: hash}
+	case map[string]string:
+		hash = val
+	default:
+		return errWrongType
+	}
+
+	var n int
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := hash[args[i]]; !ok {
+			n++
+		}
+		hash[args[i]] = args[i+1]
+	}
+
+	return n
+}
+
+func incr(s *Server, args []string) reply {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	return incrBy(s, []string{args[0], "1"})
+}
+
+func incrBy(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+
+	var current int64
+	switch val := s.lookup(args[0]).(type) {
+	case nil:
+	case string:
+		if current, err = strconv.ParseInt(val, 10, 64); err != nil {
+			return errNotInt
+		}
+	default:
+		return errWrongType
+	}
+
+	current += delta
+	value := strconv.FormatInt(current, 10)
+	if e, ok := s.data[args[0]]; ok {
+		e.value = value
+	} else {
+		s.data[args[0]] = &entry{value: value}
+	}
+
+	return current
+}
+
+func incrByFloat(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	delta, err := parseFloat(args[1])
+	if err != nil {
+		return err
+	}
+
+	val, found, err := s.lookupString(args[0])
+	if err != nil {
+		return err
+	}
+
+	var current float64
+	if found {
+		if current, err = parseFloat(val); err != nil {
+			return err
+		}
+	}
+
+	current += delta
+	if math.IsInf(current, 0) {
+		return errors.New("ERR increment would produce NaN or Infinity")
+	}
+
+	value := formatFloat(current)
+	if e, ok := s.data[args[0]]; ok {
+		e.value = value
+	} else {
+		s.data[args[0]] = &entry{value: value}
+	}
+
+	return value
+}
+
+func mget(s *Server, args []string) reply {
+	vals := make([]interface{}, len(args))
+	for i, key := range args {
+		if val, ok := s.lookup(key).(string); ok {
+			vals[i] = val
+		}
+	}
+
+	return vals
+}
+
+func multi(_ *Server, c *client, _ []string) []reply {
+	if c.multi {
+		return []reply{errors.New("ERR MULTI calls can not be nested")}
+	}
+
+	c.multi = true
+	return []reply{simpleString("OK")}
+}
+
+func pexpire(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	millis, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	if s.lookup(args[0]) == nil {
+		return 0
+	}
+
+	s.data[args[0]].expireAt = time.Now().Add(time.Duration(millis) * time.Millisecond)
+	return 1
+}
+
+func ping(_ *Server, c *client, args []string) []reply {
+	var payload string
+	if len(args) > 0 {
+		payload = args[0]
+	}
+
+	// the subscribed connections reply pings as messages
+	if c.subscriptions() > 0 {
+		return []reply{[]interface{}{"pong", payload}}
+	}
+	if len(args) > 0 {
+		return []reply{payload}
+	}
+
+	return []reply{simpleString("PONG")}
+}
+
+func psubscribe(s *Server, c *client, args []string) []reply {
+	if len(args) == 0 {
+		return []reply{errSyntax}
+	}
+
+	replies := make([]reply, len(args))
+	for i, pattern := range args {
+		c.patterns[pattern] = struct{}{}
+		if _, ok := s.patterns[pattern]; !ok {
+			s.patterns[pattern] = make(map[*client]struct{})
+		}
+		s.patterns[pattern][c] = struct{}{}
+		replies[i] = []interface{}{"psubscribe", pattern, c.subscriptions()}
+	}
+
+	return replies
+}
+
+func pttl(s *Server, args []string) reply {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	if s.lookup(args[0]) == nil {
+		return -2
+	}
+	if s.data[args[0]].expireAt.IsZero() {
+		return -1
+	}
+
+	return int64(time.Until(s.data[args[0]].expireAt) / time.Millisecond)
+}
+
+func publish(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	message := []reply{[]interface{}{"message", args[0], args[1]}}
+	for c := range s.channels[args[0]] {
+		// the messages are pushed to the subscribers immediately
+		c.write(message, true)
+	}
+
+	receivers := len(s.channels[args[0]])
+	for pattern, clients := range s.patterns {
+		if ok, _ := path.Match(pattern, args[0]); !ok {
+			continue
+		}
+
+		message := []reply{[]interface{}{"pmessage", pattern, args[0], args[1]}}
+		for c := range clients {
+			c.write(message, true)
+		}
+		receivers += len(clients)
+	}
+
+	return receivers
+}
+
+func punsubscribe(s *Server, c *client, args []string) []reply {
+	if len(args) == 0 {
+		for pattern := range c.patterns {
+			args = append(args, pattern)
+		}
+		if len(args) == 0 {
+			return []reply{[]interface{}{"punsubscribe", nil, c.subscriptions()}}
+		}
+	}
+
+	replies := make([]reply, len(args))
+	for i, pattern := range args {
+		s.pleave(c, pattern)
+		replies[i] = []interface{}{"punsubscribe", pattern, c.subscriptions()}
+	}
+
+	return replies
+}
+
+// set supports SET key value [EX seconds|PX milliseconds] [NX|XX]
+func set(s *Server, args []string) reply {
+	if len(args) < 2 {
+		return errSyntax
+	}
+
+	var expiry time.Duration
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "ex", "px":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return errNotInt
+			}
+			if strings.ToLower(args[i]) == "ex" {
+				expiry = time.Duration(n) * time.Second
+			} else {
+				expiry = time.Duration(n) * time.Millisecond
+			}
+			i++
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		default:
+			return errSyntax
+		}
+	}
+
+	found := s.lookup(args[0]) != nil
+	if (nx && found) || (xx && !found) {
+		return nil
+	}
+
+	e := &entry{value: args[1]}
+	if expiry > 0 {
+		e.expireAt = time.Now().Add(expiry)
+	}
+	s.data[args[0]] = e
+
+	return simpleString("OK")
+}
+
+func setex(s *Server, args []string) reply {
+	if len(args) != 3 {
+		return errSyntax
+	}
+
+	return set(s, []string{args[0], args[2], "ex", args[1]})
+}
+
+func setnx(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	if set(s, []string{args[0], args[1], "nx"}) == nil {
+		return 0
+	}
+
+	return 1
+}
+
+func subscribe(s *Server, c *client, args []string) []reply {
+	if len(args) == 0 {
+		return []reply{errSyntax}
+	}
+
+	replies := make([]reply, len(args))
+	for i, channel := range args {
+		c.channels[channel] = struct{}{}
+		if _, ok := s.channels[channel]; !ok {
+			s.channels[channel] = make(map[*client]struct{})
+		}
+		s.channels[channel][c] = struct{}{}
+		replies[i] = []interface{}{"subscribe", channel, c.subscriptions()}
+	}
+
+	return replies
+}
+
+func ttl(s *Server, args []string) reply {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	if s.lookup(args[0]) == nil {
+		return -2
+	}
+	if s.data[args[0]].expireAt.IsZero() {
+		return -1
+	}
+
+	return int64(time.Until(s.data[args[0]].expireAt) / time.Second)
+}
+
+func unsubscribe(s *Server, c *client, args []string) []reply {
+	if len(args) == 0 {
+		for channel := range c.channels {
+			args = append(args, channel)
+		}
+		if len(args) == 0 {
+			return []reply{[]interface{}{"unsubscribe", nil, c.subscriptions()}}
+		}
+	}
+
+	replies := make([]reply, len(args))
+	for i, channel := range args {
+		s.leave(c, channel)
+		replies[i] = []interface{}{"unsubscribe", channel, c.subscriptions()}
+	}
+
+	return replies
+}
@@ -0,0 +1,130 @@
+package redistest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vsaien/cuter/lib/stores/redis"
+)
+
+func TestServer(t *testing.T) {
+	s, err := NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	assert.True(t, rds.Ping())
+
+	assert.Nil(t, rds.Set("a", "1"))
+	assert.Nil(t, rds.Setex("b", "2", 10))
+	val, err := rds.Get("a")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", val)
+	vals, err := rds.Mget("a", "b", "c")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "2", ""}, vals)
+
+	ok, err := rds.Setnx("a", "3")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	n, err := rds.Incrby("a", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	ttl, err := rds.Ttl("b")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 8 && ttl <= 10)
+	s.FastForward(10 * time.Second)
+	_, ok = s.Get("b")
+	assert.False(t, ok)
+
+	count, err := rds.Del("a", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	exists, err := rds.Exists("a")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestServerUnknownCommand(t *testing.T) {
+	rds, clean, err := CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	_, err = rds.Hget("a", "b")
+	assert.NotNil(t, err)
+}
+
+func TestServerPubSub(t *testing.T) {
+	rds, clean, err := CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	messages := make(chan string, 1)
+	sub, err := rds.Subscribe(func(channel, message string) {
+		messages <- channel + ":" + message
+	}, "foo")
+	assert.Nil(t, err)
+	defer sub.Close()
+
+	// wait for the subscription to be registered
+	var n int64
+	for i := 0; i < 100 && n == 0; i++ {
+		n, err = rds.Publish("foo", "bar")
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int64(1), n)
+	n, err = rds.Publish("baz", "bar")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	select {
+	case msg := <-messages:
+		assert.Equal(t, "foo:bar", msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+}
+
+func TestServerScript(t *testing.T) {
+	s, err := NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	rds := redis.NewRedis(s.Addr(), redis.NodeType)
+	const script = `redis.call("SET", KEYS[1], ARGV[1])
+local val = redis.call("INCRBY", KEYS[1], 2)
+local ok = redis.pcall("HGETALL", KEYS[1])
+return {val, redis.call("GET", KEYS[2]), ok["err"] ~= nil, "done"}`
+	val, err := rds.Eval(script, []string{"a", "b"}, "1")
+	assert.Nil(t, err)
+	// false is converted to nil like redis
+	assert.Equal(t, []interface{}{int64(3), nil, int64(1), "done"}, val)
+
+	val, err = rds.Eval(`return {ARGV[1] + 1, true, "x"}`, nil, "1.5")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(2), int64(1), "x"}, val)
+	_, err = rds.Eval(`return redis.call("HGETALL", KEYS[1])`, []string{"a"})
+	assert.NotNil(t, err)
+	_, err = rds.Eval(`return redis.error_reply("MY error")`, nil)
+	assert.Equal(t, "MY error", err.Error())
+
+	sha := scriptSha(script)
+	_, err = rds.EvalSha(sha, []string{"c", "d"}, "5")
+	assert.Nil(t, err)
+	val, ok := s.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "7", val)
+
+	s.FlushScripts()
+	_, err = rds.EvalSha(sha, []string{"c", "d"}, "5")
+	assert.True(t, strings.HasPrefix(err.Error(), "NOSCRIPT"))
+	// EvalCached loads the script again on NOSCRIPT
+	_, err = rds.EvalCached(script, []string{"c", "d"}, "5")
+	assert.Nil(t, err)
+	_, err = rds.EvalSha(sha, []string{"c", "d"}, "5")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,530 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errBadStreamId   = errors.New("ERR Invalid stream ID specified as stream command argument")
+	errSmallStreamId = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	errNoGroup       = errors.New("NOGROUP No such key or consumer group")
+	errBusyGroup     = errors.New("BUSYGROUP Consumer Group name already exists")
+	maxStreamId      = streamId{ms: math.MaxUint64, seq: math.MaxUint64}
+)
+
+type (
+	stream struct {
+		entries []streamEntry
+		last    streamId
+		groups  map[string]*streamGroup
+	}
+
+	streamEntry struct {
+		id     streamId
+		fields []string
+	}
+
+	streamId struct {
+		ms  uint64
+		seq uint64
+	}
+
+	streamGroup struct {
+		lastDelivered streamId
+		pending       map[streamId]*pendingEntry
+	}
+
+	pendingEntry struct {
+		consumer  string
+		delivered time.Time
+		count     int64
+	}
+)
+
+func (id streamId) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+func (id streamId) less(other streamId) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+// parseStreamId parses the ids like 1-1, 1, - and +, seq is used if omitted.
+func parseStreamId(s string, seq uint64) (streamId, error) {
+	switch s {
+	case "-":
+		return streamId{}, nil
+	case "+":
+		return maxStreamId, nil
+	}
+
+	parts := strings.SplitN(s, "-", 2)
+	ms, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return streamId{}, errBadStreamId
+	}
+	if len(parts) == 2 {
+		if seq, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+			return streamId{}, errBadStreamId
+		}
+	}
+
+	return streamId{ms: ms, seq: seq}, nil
+}
+
+func (st *stream) find(id streamId) (streamEntry, bool) {
+	i := sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].id.less(id)
+	})
+	if i < len(st.entries) && st.entries[i].id == id {
+		return st.entries[i], true
+	}
+
+	return streamEntry{}, false
+}
+
+func (g *streamGroup) sortedPending() []streamId {
+	ids := make([]streamId, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].less(ids[j])
+	})
+
+	return ids
+}
+
+func (e streamEntry) reply() []interface{} {
+	return []interface{}{e.id.String(), e.fields}
+}
+
+// lookupStream returns the stream of key, nil if not exists, must be called with the lock held.
+func (s *Server) lookupStream(key string) (*stream, error) {
+	switch val := s.lookup(key).(type) {
+	case nil:
+		return nil, nil
+	case *stream:
+		return val, nil
+	default:
+		return nil, errWrongType
+	}
+}
+
+func (s *Server) lookupGroup(key, group string) (*stream, *streamGroup, error) {
+	st, err := s.lookupStream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st == nil {
+		return nil, nil, errNoGroup
+	}
+
+	g, ok := st.groups[group]
+	if !ok {
+		return nil, nil, errNoGroup
+	}
+
+	return st, g, nil
+}
+
+func xack(s *Server, args []string) reply {
+	if len(args) < 3 {
+		return errSyntax
+	}
+
+	_, g, err := s.lookupGroup(args[0], args[1])
+	if err == errNoGroup {
+		return 0
+	} else if err != nil {
+		return err
+	}
+
+	var n int
+	for _, arg := range args[2:] {
+		id, err := parseStreamId(arg, 0)
+		if err != nil {
+			return err
+		}
+		if _, ok := g.pending[id]; ok {
+			delete(g.pending, id)
+			n++
+		}
+	}
+
+	return n
+}
+
+// xadd supports XADD key [MAXLEN [~] count] id|* field value [field value ...]
+func xadd(s *Server, args []string) reply {
+	if len(args) < 4 {
+		return errSyntax
+	}
+
+	key := args[0]
+	args = args[1:]
+	maxLen := -1
+	if strings.ToLower(args[0]) == "maxlen" {
+		args = args[1:]
+		if len(args) > 0 && (args[0] == "~" || args[0] == "=") {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			return errSyntax
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return errNotInt
+		}
+		maxLen = n
+		args = args[1:]
+	}
+	if len(args) < 3 || len(args)%2 == 0 {
+		return errSyntax
+	}
+
+	st, err := s.lookupStream(key)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		st = &stream{groups: make(map[string]*streamGroup)}
+		s.data[key] = &entry{value: st}
+	}
+
+	var id streamId
+	if args[0] == "*" {
+		id = streamId{ms: uint64(time.Now().UnixNano() / int64(time.Millisecond))}
+		if !st.last.less(id) {
+			id = streamId{ms: st.last.ms, seq: st.last.seq + 1}
+		}
+	} else {
+		if id, err = parseStreamId(args[0], 0); err != nil {
+			return err
+		}
+		if !st.last.less(id) {
+			return errSmallStreamId
+		}
+	}
+
+	st.last = id
+	st.entries = append(st.entries, streamEntry{
+		id:     id,
+		fields: append([]string(nil), args[1:]...),
+	})
+	if maxLen >= 0 && len(st.entries) > maxLen {
+		st.entries = st.entries[len(st.entries)-maxLen:]
+	}
+
+	return id.String()
+}
+
+// xautoclaim supports XAUTOCLAIM key group consumer min-idle-time start [COUNT count]
+func xautoclaim(s *Server, args []string) reply {
+	if len(args) != 5 && len(args) != 7 {
+		return errSyntax
+	}
+
+	minIdle, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	start, err := parseStreamId(args[4], 0)
+	if err != nil {
+		return err
+	}
+	count := 100
+	if len(args) == 7 {
+		if strings.ToLower(args[5]) != "count" {
+			return errSyntax
+		}
+		if count, err = strconv.Atoi(args[6]); err != nil || count <= 0 {
+			return errNotInt
+		}
+	}
+
+	st, g, err := s.lookupGroup(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	claimed := []interface{}{}
+	deleted := []string{}
+	next := streamId{}
+	for _, id := range g.sortedPending() {
+		if id.less(start) {
+			continue
+		}
+		if len(claimed)+len(deleted) >= count {
+			next = id
+			break
+		}
+
+		pending := g.pending[id]
+		if now.Sub(pending.delivered) < time.Duration(minIdle)*time.Millisecond {
+			continue
+		}
+
+		e, ok := st.find(id)
+		if !ok {
+			// the deleted messages are removed from the pending list
+			delete(g.pending, id)
+			deleted = append(deleted, id.String())
+			continue
+		}
+
+		pending.consumer = args[2]
+		pending.delivered = now
+		pending.count++
+		claimed = append(claimed, e.reply())
+	}
+
+	return []interface{}{next.String(), claimed, deleted}
+}
+
+// xgroup supports XGROUP CREATE key group id|$ [MKSTREAM]
+func xgroup(s *Server, args []string) reply {
+	if len(args) < 4 || strings.ToLower(args[0]) != "create" {
+		return errSyntax
+	}
+
+	st, err := s.lookupStream(args[1])
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		if len(args) != 5 || strings.ToLower(args[4]) != "mkstream" {
+			return errors.New("ERR The XGROUP subcommand requires the key to exist")
+		}
+		st = &stream{groups: make(map[string]*streamGroup)}
+		s.data[args[1]] = &entry{value: st}
+	}
+	if _, ok := st.groups[args[2]]; ok {
+		return errBusyGroup
+	}
+
+	var start streamId
+	if args[3] == "$" {
+		start = st.last
+	} else if start, err = parseStreamId(args[3], 0); err != nil {
+		return err
+	}
+	st.groups[args[2]] = &streamGroup{
+		lastDelivered: start,
+		pending:       make(map[streamId]*pendingEntry),
+	}
+
+	return simpleString("OK")
+}
+
+func xlen(s *Server, args []string) reply {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	st, err := s.lookupStream(args[0])
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return 0
+	}
+
+	return len(st.entries)
+}
+
+// xpending supports XPENDING key group start end count [consumer]
+func xpending(s *Server, args []string) reply {
+	if len(args) != 5 && len(args) != 6 {
+		return errSyntax
+	}
+
+	start, err := parseStreamId(args[2], 0)
+	if err != nil {
+		return err
+	}
+	end, err := parseStreamId(args[3], math.MaxUint64)
+	if err != nil {
+		return err
+	}
+	count, err := strconv.Atoi(args[4])
+	if err != nil {
+		return errNotInt
+	}
+
+	_, g, err := s.lookupGroup(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ret := []interface{}{}
+	for _, id := range g.sortedPending() {
+		if len(ret) >= count {
+			break
+		}
+		if id.less(start) || end.less(id) {
+			continue
+		}
+
+		pending := g.pending[id]
+		if len(args) == 6 && pending.consumer != args[5] {
+			continue
+		}
+		ret = append(ret, []interface{}{
+			id.String(),
+			pending.consumer,
+			int64(now.Sub(pending.delivered) / time.Millisecond),
+			pending.count,
+		})
+	}
+
+	return ret
+}
+
+// xrange supports XRANGE key start end [COUNT count]
+func xrange(s *Server, args []string) reply {
+	if len(args) != 3 && len(args) != 5 {
+		return errSyntax
+	}
+
+	start, err := parseStreamId(args[1], 0)
+	if err != nil {
+		return err
+	}
+	end, err := parseStreamId(args[2], math.MaxUint64)
+	if err != nil {
+		return err
+	}
+	count := math.MaxInt32
+	if len(args) == 5 {
+		if count, err = strconv.Atoi(args[4]); err != nil {
+			return errNotInt
+		}
+	}
+
+	st, err := s.lookupStream(args[0])
+	if err != nil {
+		return err
+	}
+
+	ret := []interface{}{}
+	if st == nil {
+		return ret
+	}
+	for _, e := range st.entries {
+		if len(ret) >= count {
+			break
+		}
+		if e.id.less(start) || end.less(e.id) {
+			continue
+		}
+		ret = append(ret, e.reply())
+	}
+
+	return ret
+}
+
+// xreadgroup supports XREADGROUP GROUP group consumer [COUNT count] [BLOCK ms] [NOACK] STREAMS key id,
+// only one stream is supported.
+func xreadgroup(s *Server, args []string) reply {
+	if len(args) < 6 || strings.ToLower(args[0]) != "group" {
+		return errSyntax
+	}
+
+	group, consumer := args[1], args[2]
+	count := math.MaxInt32
+	block := time.Duration(-1)
+	var noAck bool
+	args = args[3:]
+	for len(args) > 0 && strings.ToLower(args[0]) != "streams" {
+		switch strings.ToLower(args[0]) {
+		case "count", "block":
+			if len(args) < 2 {
+				return errSyntax
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 0 {
+				return errNotInt
+			}
+			if strings.ToLower(args[0]) == "count" {
+				count = n
+			} else {
+				block = time.Duration(n) * time.Millisecond
+			}
+			args = args[2:]
+		case "noack":
+			noAck = true
+			args = args[1:]
+		default:
+			return errSyntax
+		}
+	}
+	if len(args) != 3 {
+		return errSyntax
+	}
+
+	key := args[1]
+	st, g, err := s.lookupGroup(key, group)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var msgs []interface{}
+	if args[2] == ">" {
+		for _, e := range st.entries {
+			if len(msgs) >= count {
+				break
+			}
+			if !g.lastDelivered.less(e.id) {
+				continue
+			}
+
+			g.lastDelivered = e.id
+			if !noAck {
+				g.pending[e.id] = &pendingEntry{
+					consumer:  consumer,
+					delivered: now,
+					count:     1,
+				}
+			}
+			msgs = append(msgs, e.reply())
+		}
+		if len(msgs) == 0 {
+			if block >= 0 {
+				return blocked(block)
+			}
+			return nil
+		}
+	} else {
+		// the history of the pending messages of consumer
+		start, err := parseStreamId(args[2], 0)
+		if err != nil {
+			return err
+		}
+		msgs = []interface{}{}
+		for _, id := range g.sortedPending() {
+			if len(msgs) >= count {
+				break
+			}
+			if !start.less(id) || g.pending[id].consumer != consumer {
+				continue
+			}
+			if e, ok := st.find(id); ok {
+				msgs = append(msgs, e.reply())
+			} else {
+				msgs = append(msgs, []interface{}{id.String(), nil})
+			}
+		}
+	}
+
+	return []interface{}{[]interface{}{key, msgs}}
+}
@@ -0,0 +1,706 @@
+package redistest
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	errNotFloat  = errors.New("ERR value is not a valid float")
+	errMinMax    = errors.New("ERR min or max is not a float")
+	errLexRange  = errors.New("ERR min or max not valid string range item")
+	errNoNumkeys = errors.New("ERR at least 1 input key is needed for ZUNIONSTORE/ZINTERSTORE")
+)
+
+type (
+	// zset maps the members to the scores.
+	zset map[string]float64
+
+	zmember struct {
+		member string
+		score  float64
+	}
+
+	scoreBound struct {
+		score     float64
+		exclusive bool
+	}
+
+	lexBound struct {
+		value     string
+		exclusive bool
+		// - or +
+		infinite int
+	}
+)
+
+// sorted returns the members ordered by the scores, then the members lexicographically.
+func (z zset) sorted() []zmember {
+	members := make([]zmember, 0, len(z))
+	for member, score := range z {
+		members = append(members, zmember{member: member, score: score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+
+	return members
+}
+
+func (b scoreBound) above(score float64) bool {
+	if b.exclusive {
+		return score > b.score
+	}
+	return score >= b.score
+}
+
+func (b scoreBound) below(score float64) bool {
+	if b.exclusive {
+		return score < b.score
+	}
+	return score <= b.score
+}
+
+func (b lexBound) above(value string) bool {
+	switch {
+	case b.infinite < 0:
+		return true
+	case b.infinite > 0:
+		return false
+	case b.exclusive:
+		return value > b.value
+	default:
+		return value >= b.value
+	}
+}
+
+func (b lexBound) below(value string) bool {
+	switch {
+	case b.infinite < 0:
+		return false
+	case b.infinite > 0:
+		return true
+	case b.exclusive:
+		return value < b.value
+	default:
+		return value <= b.value
+	}
+}
+
+// lookupZset returns the sorted set of key, creates it if create is true and not exists,
+// must be called with the lock held.
+func (s *Server) lookupZset(key string, create bool) (zset, error) {
+	switch val := s.lookup(key).(type) {
+	case nil:
+		if !create {
+			return nil, nil
+		}
+		z := make(zset)
+		s.data[key] = &entry{value: z}
+		return z, nil
+	case zset:
+		return val, nil
+	default:
+		return nil, errWrongType
+	}
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "inf"
+	} else if math.IsInf(f, -1) {
+		return "-inf"
+	}
+
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func parseFloat(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errNotFloat
+	}
+
+	return f, nil
+}
+
+// parseScoreBound parses the bounds like 1, (1, -inf and +inf.
+func parseScoreBound(s string) (scoreBound, error) {
+	var bound scoreBound
+	if strings.HasPrefix(s, "(") {
+		bound.exclusive = true
+		s = s[1:]
+	}
+
+	score, err := parseFloat(s)
+	if err != nil {
+		return bound, errMinMax
+	}
+	bound.score = score
+
+	return bound, nil
+}
+
+// parseLexBound parses the bounds like [a, (a, - and +.
+func parseLexBound(s string) (lexBound, error) {
+	switch {
+	case s == "-":
+		return lexBound{infinite: -1}, nil
+	case s == "+":
+		return lexBound{infinite: 1}, nil
+	case strings.HasPrefix(s, "["):
+		return lexBound{value: s[1:]}, nil
+	case strings.HasPrefix(s, "("):
+		return lexBound{value: s[1:], exclusive: true}, nil
+	default:
+		return lexBound{}, errLexRange
+	}
+}
+
+// parseLimit parses LIMIT offset count, the negative count means no limit.
+func parseLimit(args []string) (offset, count int, err error) {
+	if len(args) != 3 || strings.ToLower(args[0]) != "limit" {
+		return 0, 0, errSyntax
+	}
+
+	if offset, err = strconv.Atoi(args[1]); err != nil {
+		return 0, 0, errNotInt
+	}
+	if count, err = strconv.Atoi(args[2]); err != nil {
+		return 0, 0, errNotInt
+	}
+
+	return offset, count, nil
+}
+
+// limit applies offset and count on members, count < 0 means no limit.
+func limit(members []zmember, offset, count int) []zmember {
+	if offset < 0 || offset >= len(members) {
+		return nil
+	}
+
+	members = members[offset:]
+	if count >= 0 && count < len(members) {
+		members = members[:count]
+	}
+
+	return members
+}
+
+func zmemberReply(members []zmember, withScores bool) reply {
+	var vals []string
+	for _, m := range members {
+		vals = append(vals, m.member)
+		if withScores {
+			vals = append(vals, formatFloat(m.score))
+		}
+	}
+
+	if vals == nil {
+		return []string{}
+	}
+	return vals
+}
+
+// zadd supports ZADD key [NX|XX] [CH] score member [score member ...]
+func zadd(s *Server, args []string) reply {
+	if len(args) < 3 {
+		return errSyntax
+	}
+
+	var nx, xx, ch bool
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+			continue
+		case "xx":
+			xx = true
+			continue
+		case "ch":
+			ch = true
+			continue
+		}
+		break
+	}
+	if (nx && xx) || i >= len(args) || (len(args)-i)%2 != 0 {
+		return errSyntax
+	}
+
+	scores := make([]float64, 0, (len(args)-i)/2)
+	for j := i; j < len(args); j += 2 {
+		score, err := parseFloat(args[j])
+		if err != nil {
+			return err
+		}
+		scores = append(scores, score)
+	}
+
+	z, err := s.lookupZset(args[0], !xx)
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		return 0
+	}
+
+	var added, changed int
+	for j, score := range scores {
+		member := args[i+j*2+1]
+		old, ok := z[member]
+		if (ok && nx) || (!ok && xx) {
+			continue
+		}
+
+		if !ok {
+			added++
+		} else if old != score {
+			changed++
+		}
+		z[member] = score
+	}
+	if len(z) == 0 {
+		delete(s.data, args[0])
+	}
+
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func zcard(s *Server, args []string) reply {
+	if len(args) != 1 {
+		return errSyntax
+	}
+
+	z, err := s.lookupZset(args[0], false)
+	if err != nil {
+		return err
+	}
+
+	return len(z)
+}
+
+func zcount(s *Server, args []string) reply {
+	if len(args) != 3 {
+		return errSyntax
+	}
+
+	min, err := parseScoreBound(args[1])
+	if err != nil {
+		return err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+
+	z, err := s.lookupZset(args[0], false)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	for _, score := range z {
+		if min.above(score) && max.below(score) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func zincrby(s *Server, args []string) reply {
+	if len(args) != 3 {
+		return errSyntax
+	}
+
+	increment, err := parseFloat(args[1])
+	if err != nil {
+		return err
+	}
+
+	z, err := s.lookupZset(args[0], true)
+	if err != nil {
+		return err
+	}
+
+	z[args[2]] += increment
+	return formatFloat(z[args[2]])
+}
+
+func zinterstore(s *Server, args []string) reply {
+	return zstore(s, args, false)
+}
+
+// zrange supports ZRANGE key start stop [WITHSCORES]
+func zrange(s *Server, args []string) reply {
+	return zrangeByRank(s, args, false)
+}
+
+// zrangebylex supports ZRANGEBYLEX key min max [LIMIT offset count]
+func zrangebylex(s *Server, args []string) reply {
+	if len(args) != 3 && len(args) != 6 {
+		return errSyntax
+	}
+
+	min, err := parseLexBound(args[1])
+	if err != nil {
+		return err
+	}
+	max, err := parseLexBound(args[2])
+	if err != nil {
+		return err
+	}
+
+	offset, count := 0, -1
+	if len(args) == 6 {
+		if offset, count, err = parseLimit(args[3:]); err != nil {
+			return err
+		}
+	}
+
+	z, err := s.lookupZset(args[0], false)
+	if err != nil {
+		return err
+	}
+
+	var members []zmember
+	for _, m := range z.sorted() {
+		if min.above(m.member) && max.below(m.member) {
+			members = append(members, m)
+		}
+	}
+
+	return zmemberReply(limit(members, offset, count), false)
+}
+
+// zrangebyscore supports ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func zrangebyscore(s *Server, args []string) reply {
+	return zrangeByScore(s, args, false)
+}
+
+func zrangeByRank(s *Server, args []string, reverse bool) reply {
+	if len(args) != 3 && len(args) != 4 {
+		return errSyntax
+	}
+
+	withScores := len(args) == 4
+	if withScores && strings.ToLower(args[3]) != "withscores" {
+		return errSyntax
+	}
+
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInt
+	}
+	stop, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errNotInt
+	}
+
+	z, err := s.lookupZset(args[0], false)
+	if err != nil {
+		return err
+	}
+
+	members := z.sorted()
+	if reverse {
+		reverseMembers(members)
+	}
+	start, stop, ok := indexRange(start, stop, len(members))
+	if !ok {
+		return []string{}
+	}
+
+	return zmemberReply(members[start:stop+1], withScores)
+}
+
+// zrangeByScore handles ZRANGEBYSCORE and ZREVRANGEBYSCORE, the bounds of ZREVRANGEBYSCORE are max and min.
+func zrangeByScore(s *Server, args []string, reverse bool) reply {
+	if len(args) < 3 {
+		return errSyntax
+	}
+
+	var withScores bool
+	offset, count := 0, -1
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "withscores":
+			withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			var err error
+			if offset, count, err = parseLimit(args[i : i+3]); err != nil {
+				return err
+			}
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+
+	min, err := parseScoreBound(args[1])
+	if err != nil {
+		return err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+	if reverse {
+		min, max = max, min
+	}
+
+	z, err := s.lookupZset(args[0], false)
+	if err != nil {
+		return err
+	}
+
+	sorted := z.sorted()
+	if reverse {
+		reverseMembers(sorted)
+	}
+	var members []zmember
+	for _, m := range sorted {
+		if min.above(m.score) && max.below(m.score) {
+			members = append(members, m)
+		}
+	}
+
+	return zmemberReply(limit(members, offset, count), withScores)
+}
+
+func zrank(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	z, err := s.lookupZset(args[0], false)
+	if err != nil {
+		return err
+	}
+
+	for i, m := range z.sorted() {
+		if m.member == args[1] {
+			return i
+		}
+	}
+
+	return nil
+}
+
+func zrem(s *Server, args []string) reply {
+	if len(args) < 2 {
+		return errSyntax
+	}
+
+	z, err := s.lookupZset(args[0], false)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	for _, member := range args[1:] {
+		if _, ok := z[member]; ok {
+			delete(z, member)
+			n++
+		}
+	}
+	if z != nil && len(z) == 0 {
+		delete(s.data, args[0])
+	}
+
+	return n
+}
+
+func zremrangebyscore(s *Server, args []string) reply {
+	if len(args) != 3 {
+		return errSyntax
+	}
+
+	min, err := parseScoreBound(args[1])
+	if err != nil {
+		return err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+
+	z, err := s.lookupZset(args[0], false)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	for member, score := range z {
+		if min.above(score) && max.below(score) {
+			delete(z, member)
+			n++
+		}
+	}
+	if z != nil && len(z) == 0 {
+		delete(s.data, args[0])
+	}
+
+	return n
+}
+
+// zrevrange supports ZREVRANGE key start stop [WITHSCORES]
+func zrevrange(s *Server, args []string) reply {
+	return zrangeByRank(s, args, true)
+}
+
+// zrevrangebyscore supports ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func zrevrangebyscore(s *Server, args []string) reply {
+	return zrangeByScore(s, args, true)
+}
+
+func zscore(s *Server, args []string) reply {
+	if len(args) != 2 {
+		return errSyntax
+	}
+
+	z, err := s.lookupZset(args[0], false)
+	if err != nil {
+		return err
+	}
+
+	score, ok := z[args[1]]
+	if !ok {
+		return nil
+	}
+
+	return formatFloat(score)
+}
+
+// zstore handles ZUNIONSTORE and ZINTERSTORE, which are like
+// ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func zstore(s *Server, args []string, union bool) reply {
+	if len(args) < 3 {
+		return errSyntax
+	}
+
+	numKeys, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInt
+	}
+	if numKeys < 1 {
+		return errNoNumkeys
+	}
+	if len(args) < 2+numKeys {
+		return errSyntax
+	}
+
+	keys := args[2 : 2+numKeys]
+	weights := make([]float64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	aggregate := "sum"
+	for i := 2 + numKeys; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "weights":
+			if i+numKeys >= len(args) {
+				return errSyntax
+			}
+			for j := range weights {
+				if weights[j], err = parseFloat(args[i+1+j]); err != nil {
+					return errors.New("ERR weight value is not a float")
+				}
+			}
+			i += numKeys
+		case "aggregate":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			aggregate = strings.ToLower(args[i+1])
+			if aggregate != "sum" && aggregate != "min" && aggregate != "max" {
+				return errSyntax
+			}
+			i++
+		default:
+			return errSyntax
+		}
+	}
+
+	sets := make([]zset, numKeys)
+	for i, key := range keys {
+		if sets[i], err = s.lookupZset(key, false); err != nil {
+			return err
+		}
+	}
+
+	result := make(zset)
+	for i, z := range sets {
+		for member, score := range z {
+			if !union {
+				if _, ok := result[member]; !ok && i > 0 {
+					continue
+				}
+			}
+
+			score *= weights[i]
+			if old, ok := result[member]; ok {
+				result[member] = aggregateScore(aggregate, old, score)
+			} else {
+				result[member] = score
+			}
+		}
+
+		if !union {
+			// drop the members not in z
+			for member := range result {
+				if _, ok := z[member]; !ok {
+					delete(result, member)
+				}
+			}
+		}
+	}
+
+	delete(s.data, args[0])
+	if len(result) > 0 {
+		s.data[args[0]] = &entry{value: result}
+	}
+
+	return len(result)
+}
+
+func zunionstore(s *Server, args []string) reply {
+	return zstore(s, args, true)
+}
+
+func aggregateScore(aggregate string, a, b float64) float64 {
+	switch aggregate {
+	case "min":
+		return math.Min(a, b)
+	case "max":
+		return math.Max(a, b)
+	default:
+		return a + b
+	}
+}
+
+func reverseMembers(members []zmember) {
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+}
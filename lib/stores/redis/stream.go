@@ -0,0 +1,265 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	red "github.com/go-redis/redis"
+)
+
+type (
+	// StreamMessage is the message of the streams, the values of the deleted messages are nil.
+	StreamMessage struct {
+		Id     string
+		Values map[string]string
+	}
+
+	// PendingMessage is the message delivered to the consumers of the group but not acknowledged.
+	PendingMessage struct {
+		Id         string
+		Consumer   string
+		Idle       time.Duration
+		Deliveries int64
+	}
+
+	doer interface {
+		Do(args ...interface{}) *red.Cmd
+	}
+)
+
+// Xack acknowledges the messages of ids in group, returns the number of the acknowledged ones.
+func (s *Redis) Xack(stream, group string, ids ...string) (int64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.XAck(stream, group, ids...).Result()
+}
+
+// Xadd appends values to stream and returns the id, the stream is trimmed to about maxLen messages
+// if maxLen is positive.
+func (s *Redis) Xadd(stream string, maxLen int64, values map[string]interface{}) (string, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return "", err
+	}
+
+	return conn.XAdd(&red.XAddArgs{
+		Stream:       stream,
+		MaxLenApprox: maxLen,
+		Values:       values,
+	}).Result()
+}
+
+// Xautoclaim claims at most count messages of group idle longer than minIdle to consumer, from start,
+// returns the claimed messages and the start of the next call, which is 0-0 if all scanned.
+// Requires redis 6.2 or later.
+func (s *Redis) Xautoclaim(stream, group, consumer string, minIdle time.Duration, start string,
+	count int64) ([]StreamMessage, string, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client, ok := conn.(doer)
+	if !ok {
+		return nil, "", fmt.Errorf("redis type '%s' doesn't support XAUTOCLAIM", s.RedisType)
+	}
+
+	val, err := client.Do("xautoclaim", stream, group, consumer, int64(minIdle/time.Millisecond),
+		start, "count", count).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	reply, ok := val.([]interface{})
+	if !ok || len(reply) < 2 {
+		return nil, "", fmt.Errorf("unexpected reply of XAUTOCLAIM: %v", val)
+	}
+	next, ok := reply[0].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("unexpected reply of XAUTOCLAIM: %v", val)
+	}
+	entries, ok := reply[1].([]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("unexpected reply of XAUTOCLAIM: %v", val)
+	}
+
+	msgs := make([]StreamMessage, 0, len(entries))
+	for _, entry := range entries {
+		msg, err := toStreamMessage(entry)
+		if err != nil {
+			return nil, "", err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, next, nil
+}
+
+// XgroupCreate creates group on stream starting from start, like $ for the new messages and 0 for
+// all of them, the stream is created if absent. It's not an error if group already exists.
+func (s *Redis) XgroupCreate(stream, group, start string) error {
+	conn, err := getRedis(s)
+	if err != nil {
+		return err
+	}
+
+	err = conn.XGroupCreateMkStream(stream, group, start).Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+
+	return err
+}
+
+func (s *Redis) Xlen(stream string) (int64, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return conn.XLen(stream).Result()
+}
+
+// Xpending returns at most count pending messages of group between start and end,
+// like - and +, only the ones of consumer if not empty.
+func (s *Redis) Xpending(stream, group, start, end string, count int64, consumer string) (
+	[]PendingMessage, error) {
+	conn, err := getRedis(s)
+	if err != nil {
+		return nil, err
+	}
+
+	vals, err := conn.XPendingExt(&red.XPendingExtArgs{
+		Stream:   stream,
+		Group:    group,
+		Start:    start,
+		End:      end,
+		Count:    count,
+		Consumer: consumer,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return toPendingMessages(vals), nil
+}
+
+// XpendingOf returns the pending messages of group with ids in one round trip,
+// the ones not pending are skipped.
+func (s *Redis) XpendingOf(stream, group string, ids ...string) ([]PendingMessage, error) {
+	results, err := s.Pipelined(func(pipe Pipeliner) error {
+		for _, id := range ids {
+			pipe.XPendingExt(&red.XPendingExtArgs{
+				Stream: stream,
+				Group:  group,
+				Start:  id,
+				End:    id,
+				Count:  1,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []PendingMessage
+	for _, result := range results {
+		vals, err := result.(*red.XPendingExtCmd).Result()
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, toPendingMessages(vals)...)
+	}
+
+	return msgs, nil
+}
+
+// XreadGroup reads at most count new messages of stream as consumer of group, blocks at most block
+// if no messages, returns empty messages on timeout. The same as Blpop, redisNode is used to execute
+// the blocking queries, which should be created by CreateRedisBlockingNode.
+func (s *Redis) XreadGroup(redisNode RedisNode, group, consumer, stream string, count int64,
+	block time.Duration) ([]StreamMessage, error) {
+	if redisNode == nil {
+		return nil, ErrNilNode
+	}
+
+	streams, err := redisNode.XReadGroup(&red.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == red.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var msgs []StreamMessage
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			values := make(map[string]string, len(msg.Values))
+			for k, v := range msg.Values {
+				values[k] = fmt.Sprint(v)
+			}
+			msgs = append(msgs, StreamMessage{
+				Id:     msg.ID,
+				Values: values,
+			})
+		}
+	}
+
+	return msgs, nil
+}
+
+func toStreamMessage(entry interface{}) (StreamMessage, error) {
+	vals, ok := entry.([]interface{})
+	if !ok || len(vals) < 2 {
+		return StreamMessage{}, fmt.Errorf("unexpected stream message: %v", entry)
+	}
+
+	id, ok := vals[0].(string)
+	if !ok {
+		return StreamMessage{}, fmt.Errorf("unexpected stream message id: %v", vals[0])
+	}
+
+	msg := StreamMessage{
+		Id: id,
+	}
+	// the deleted messages have no values
+	if vals[1] == nil {
+		return msg, nil
+	}
+
+	fields, ok := vals[1].([]interface{})
+	if !ok || len(fields)%2 != 0 {
+		return StreamMessage{}, fmt.Errorf("unexpected stream message values: %v", vals[1])
+	}
+
+	msg.Values = make(map[string]string, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		msg.Values[fmt.Sprint(fields[i])] = fmt.Sprint(fields[i+1])
+	}
+
+	return msg, nil
+}
+
+func toPendingMessages(vals []red.XPendingExt) []PendingMessage {
+	msgs := make([]PendingMessage, len(vals))
+	for i, val := range vals {
+		msgs[i] = PendingMessage{
+			Id:         val.Id,
+			Consumer:   val.Consumer,
+			Idle:       val.Idle,
+			Deliveries: val.RetryCount,
+		}
+	}
+
+	return msgs
+}
@@ -0,0 +1,88 @@
+package redis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vsaien/cuter/lib/stores/redis"
+	"github.com/vsaien/cuter/lib/stores/redis/redistest"
+)
+
+func TestRedisStream(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	assert.Nil(t, rds.XgroupCreate("s", "g", "0"))
+	// creating an existing group is ignored
+	assert.Nil(t, rds.XgroupCreate("s", "g", "0"))
+
+	first, err := rds.Xadd("s", 0, map[string]interface{}{"k": "v1"})
+	assert.Nil(t, err)
+	second, err := rds.Xadd("s", 0, map[string]interface{}{"k": "v2"})
+	assert.Nil(t, err)
+	n, err := rds.Xlen("s")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	node, err := redis.CreateRedisBlockingNode(rds)
+	assert.Nil(t, err)
+	defer node.Close()
+
+	msgs, err := rds.XreadGroup(node, "g", "c1", "s", 10, time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.StreamMessage{
+		{Id: first, Values: map[string]string{"k": "v1"}},
+		{Id: second, Values: map[string]string{"k": "v2"}},
+	}, msgs)
+	msgs, err = rds.XreadGroup(node, "g", "c1", "s", 10, time.Millisecond)
+	assert.Nil(t, err)
+	assert.Empty(t, msgs)
+
+	n, err = rds.Xack("s", "g", first)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	pendings, err := rds.Xpending("s", "g", "-", "+", 10, "c1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pendings))
+	assert.Equal(t, second, pendings[0].Id)
+	assert.Equal(t, "c1", pendings[0].Consumer)
+	assert.Equal(t, int64(1), pendings[0].Deliveries)
+
+	msgs, next, err := rds.Xautoclaim("s", "g", "c2", 0, "0-0", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "0-0", next)
+	assert.Equal(t, []redis.StreamMessage{
+		{Id: second, Values: map[string]string{"k": "v2"}},
+	}, msgs)
+	pendings, err = rds.Xpending("s", "g", "-", "+", 10, "c2")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pendings))
+	assert.Equal(t, int64(2), pendings[0].Deliveries)
+	msgs, _, err = rds.Xautoclaim("s", "g", "c2", time.Hour, "0-0", 10)
+	assert.Nil(t, err)
+	assert.Empty(t, msgs)
+
+	// the acked ones are skipped
+	pendings, err = rds.XpendingOf("s", "g", first, second)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pendings))
+	assert.Equal(t, second, pendings[0].Id)
+	assert.Equal(t, "c2", pendings[0].Consumer)
+	assert.Equal(t, int64(2), pendings[0].Deliveries)
+}
+
+func TestRedisStreamMaxLen(t *testing.T) {
+	rds, clean, err := redistest.CreateRedis()
+	assert.Nil(t, err)
+	defer clean()
+
+	for i := 0; i < 10; i++ {
+		_, err := rds.Xadd("s", 5, map[string]interface{}{"k": i})
+		assert.Nil(t, err)
+	}
+	n, err := rds.Xlen("s")
+	assert.Nil(t, err)
+	assert.True(t, n >= 5 && n < 10)
+}
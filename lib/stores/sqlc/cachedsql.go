@@ -1,14 +1,20 @@
 package sqlc
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
+	"github.com/vsaien/cuter/lib/logx"
 	"github.com/vsaien/cuter/lib/stores/internal"
 	"github.com/vsaien/cuter/lib/stores/redis"
 	"github.com/vsaien/cuter/lib/stores/sqlx"
 	"github.com/vsaien/cuter/lib/syncx"
 )
 
+// the channel to broadcast the deletions of the local caches
+const localCacheChannel = "sqlc#cache#deletion"
+
 var (
 	ErrNotFound = internal.ErrNotFound
 
@@ -17,41 +23,108 @@ var (
 )
 
 type (
-	ExecFn  func(conn sqlx.Session) (sql.Result, error)
-	QueryFn func(conn sqlx.Session, v interface{}) error
+	ExecFn     func(conn sqlx.Session) (sql.Result, error)
+	ExecCtxFn  func(ctx context.Context, conn sqlx.Session) (sql.Result, error)
+	QueryFn    func(conn sqlx.Session, v interface{}) error
+	QueryCtxFn func(ctx context.Context, conn sqlx.Session, v interface{}) error
+	// queries the rows of keys into v, a pointer to a slice of the row type
+	QueryManyFn    func(conn sqlx.Session, v interface{}, keys []string) error
+	QueryManyCtxFn func(ctx context.Context, conn sqlx.Session, v interface{}, keys []string) error
+	// returns the cache key of the row
+	KeyFn func(row interface{}) string
+
+	CachedConnOption func(options *cachedConnOptions)
+
+	cachedConnOptions struct {
+		localExpire time.Duration
+		localLimit  int
+		cacheOpts   []internal.CacheOption
+	}
 
 	CachedConn struct {
 		db    sqlx.SqlConn
 		cache internal.Cache
+		local *internal.LocalCache
 	}
 )
 
-func NewCachedConn(db sqlx.SqlConn, rds *redis.Redis) CachedConn {
+// NewCachedConn returns a CachedConn on db with the rows cached in rds, the local caches share
+// one subscription on rds. If subscribing fails, the local cache is bypassed until subscribed
+// by the retries in background. Close the CachedConn with the local cache if it's not used anymore.
+func NewCachedConn(db sqlx.SqlConn, rds *redis.Redis, opts ...CachedConnOption) CachedConn {
+	var options cachedConnOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var local *internal.LocalCache
+	cacheOpts := options.cacheOpts
+	if options.localExpire > 0 {
+		var err error
+		local, err = internal.NewLocalCache(rds, localCacheChannel, options.localExpire, options.localLimit)
+		if err != nil {
+			logx.Errorf("local cache on redis %s disabled: %s", rds.RedisAddr, err.Error())
+		} else {
+			cacheOpts = append(cacheOpts, internal.WithLocalCache(local))
+		}
+	}
+
 	return CachedConn{
 		db:    db,
-		cache: internal.NewCache(rds, exclusiveCalls, &stat),
+		cache: internal.NewCache(rds, exclusiveCalls, &stat, cacheOpts...),
+		local: local,
 	}
 }
 
+// Close releases the local cache, the underlying db is not closed.
+func (cc CachedConn) Close() error {
+	if cc.local == nil {
+		return nil
+	}
+
+	return cc.local.Close()
+}
+
 func (cc CachedConn) DelCache(key string) error {
 	return cc.cache.DelCache(key)
 }
 
 func (cc CachedConn) Exec(q string, args ...interface{}) (sql.Result, error) {
-	return cc.db.Exec(q, args...)
+	return cc.ExecCtx(context.Background(), q, args...)
+}
+
+func (cc CachedConn) ExecCtx(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	return cc.db.ExecCtx(ctx, q, args...)
 }
 
 func (cc CachedConn) ExecDropCache(exec ExecFn, key string) (sql.Result, error) {
+	execCtx := func(_ context.Context, conn sqlx.Session) (sql.Result, error) {
+		return exec(conn)
+	}
+
+	return cc.ExecDropCacheCtx(context.Background(), execCtx, key)
+}
+
+func (cc CachedConn) ExecDropCacheCtx(ctx context.Context, exec ExecCtxFn, key string) (sql.Result, error) {
 	if err := cc.DelCache(key); err != nil {
 		return nil, err
 	}
 
-	return exec(cc.db)
+	return exec(ctx, cc.db)
 }
 
 func (cc CachedConn) QueryRow(v interface{}, key string, seconds int, query QueryFn) error {
-	return cc.cache.Take(v, key, seconds, func(v interface{}) error {
-		if err := query(cc.db, v); err == sql.ErrNoRows {
+	return cc.QueryRowCtx(context.Background(), v, key, seconds,
+		func(_ context.Context, conn sqlx.Session, v interface{}) error {
+			return query(conn, v)
+		})
+}
+
+// QueryRowCtx queries the row by query with ctx on cache misses, the result is cached by key.
+func (cc CachedConn) QueryRowCtx(ctx context.Context, v interface{}, key string, seconds int,
+	query QueryCtxFn) error {
+	return cc.cache.TakeCtx(ctx, v, key, seconds, func(ctx context.Context, v interface{}) error {
+		if err := query(ctx, cc.db, v); err == sql.ErrNoRows {
 			return internal.ErrNotFound
 		} else {
 			return err
@@ -59,8 +132,35 @@ func (cc CachedConn) QueryRow(v interface{}, key string, seconds int, query Quer
 	})
 }
 
+// QueryRowsByKeys queries the rows of keys into v, a pointer to a map of the keys to the row type,
+// like *map[string]User. The cached rows are fetched from redis in one round trip, the missing ones
+// are queried by query in one call and cached with seconds, keyOf returns the cache keys of them.
+func (cc CachedConn) QueryRowsByKeys(v interface{}, keys []string, seconds int, query QueryManyFn,
+	keyOf KeyFn) error {
+	return cc.QueryRowsByKeysCtx(context.Background(), v, keys, seconds,
+		func(_ context.Context, conn sqlx.Session, v interface{}, keys []string) error {
+			return query(conn, v, keys)
+		}, keyOf)
+}
+
+// QueryRowsByKeysCtx is the same as QueryRowsByKeys, but queries the missing rows with ctx.
+func (cc CachedConn) QueryRowsByKeysCtx(ctx context.Context, v interface{}, keys []string, seconds int,
+	query QueryManyCtxFn, keyOf KeyFn) error {
+	return cc.cache.TakeMany(v, keys, seconds, func(v interface{}, keys []string) error {
+		if err := query(ctx, cc.db, v, keys); err != sql.ErrNoRows {
+			return err
+		}
+
+		return nil
+	}, keyOf)
+}
+
 func (cc CachedConn) QueryRows(v interface{}, q string, args ...interface{}) error {
-	return cc.db.QueryRows(v, q, args...)
+	return cc.QueryRowsCtx(context.Background(), v, q, args...)
+}
+
+func (cc CachedConn) QueryRowsCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	return cc.db.QueryRowsCtx(ctx, v, q, args...)
 }
 
 func (cc CachedConn) SetCache(key string, v interface{}, seconds int) error {
@@ -70,3 +170,36 @@ func (cc CachedConn) SetCache(key string, v interface{}, seconds int) error {
 func (cc CachedConn) Transact(fn func(sqlx.Session) error) error {
 	return cc.db.Transact(fn)
 }
+
+func (cc CachedConn) TransactCtx(ctx context.Context, fn func(context.Context, sqlx.Session) error) error {
+	return cc.db.TransactCtx(ctx, fn)
+}
+
+// WithExpiryDeviation randomizes the expiries of the cached rows in [(1-deviation)*seconds,
+// (1+deviation)*seconds], to avoid the rows loaded at the same time expiring together.
+// Defaults to 0.05, 0 to disable it.
+func WithExpiryDeviation(deviation float64) CachedConnOption {
+	return func(options *cachedConnOptions) {
+		options.cacheOpts = append(options.cacheOpts, internal.WithExpiryDeviation(deviation))
+	}
+}
+
+// WithLocalCache caches at most limit rows in process for expire in front of redis. The rows deleted
+// by DelCache, ExecDropCache and SetCache are dropped on all the instances, but the ones changed
+// without them are stale until expired, so keep expire short, like seconds.
+func WithLocalCache(expire time.Duration, limit int) CachedConnOption {
+	return func(options *cachedConnOptions) {
+		options.localExpire = expire
+		options.localLimit = limit
+	}
+}
+
+// WithStaleWhileRevalidate keeps the cached rows stale longer than their seconds, the stale rows taken
+// by QueryRow are served while refreshed by a single background query, which carries the values of
+// the ctx of the taking call, but not its cancellation, and times out in 5 seconds.
+// The rows taken by QueryRowsByKeys are served until expired without refreshing.
+func WithStaleWhileRevalidate(stale time.Duration) CachedConnOption {
+	return func(options *cachedConnOptions) {
+		options.cacheOpts = append(options.cacheOpts, internal.WithStaleWhileRevalidate(stale))
+	}
+}
@@ -0,0 +1,276 @@
+package sqlx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/vsaien/cuter/lib/mapping"
+)
+
+const (
+	MysqlDialect Dialect = iota
+	PostgreDialect
+)
+
+const (
+	// the key columns, used in the where clause of the updates, and the conflict target of the upserts
+	keyOption = "key"
+	// the columns generated by the database, like auto increment ids, which are not written
+	autoOption = "auto"
+)
+
+var (
+	ErrNoColumns       = errors.New("no db tagged fields")
+	ErrNoKeyColumns    = errors.New("no key columns tagged by db:\",key\"")
+	ErrNotStruct       = errors.New("not a struct or a pointer to struct")
+	ErrUnknownDialect  = errors.New("unknown sql dialect")
+	ErrNoUpdateColumns = errors.New("no columns to update")
+)
+
+type (
+	Dialect int
+
+	// StmtBuilder builds the parameterized statements from the structs tagged by db, like:
+	//	type User struct {
+	//		Id   int64  `db:"id,key,auto"`
+	//		Name string `db:"name"`
+	//	}
+	StmtBuilder struct {
+		table   string
+		dialect Dialect
+	}
+
+	column struct {
+		name  string
+		key   bool
+		auto  bool
+		value interface{}
+	}
+)
+
+func NewStmtBuilder(table string, dialect Dialect) StmtBuilder {
+	return StmtBuilder{
+		table:   table,
+		dialect: dialect,
+	}
+}
+
+// InsertWithoutValues returns the insert statement of v without the values clause,
+// like insert into `user` (`name`), which is used by BulkInserter.
+func (b StmtBuilder) InsertWithoutValues(v interface{}) (string, error) {
+	columns, err := parseColumns(v)
+	if err != nil {
+		return "", err
+	}
+
+	names, _ := b.writableColumns(columns)
+	return fmt.Sprintf("insert into %s (%s) values", b.quote(b.table), strings.Join(names, ", ")), nil
+}
+
+// Insert returns the insert statement and the arguments of v, the auto columns are skipped.
+func (b StmtBuilder) Insert(v interface{}) (string, []interface{}, error) {
+	columns, err := parseColumns(v)
+	if err != nil {
+		return "", nil, err
+	}
+
+	names, args := b.writableColumns(columns)
+	return fmt.Sprintf("insert into %s (%s) values (%s)", b.quote(b.table), strings.Join(names, ", "),
+		b.placeholders(1, len(args))), args, nil
+}
+
+// Upsert returns the insert statement of v that updates the non-key columns on key conflicts,
+// with ON DUPLICATE KEY UPDATE for mysql, and ON CONFLICT DO UPDATE for postgres.
+func (b StmtBuilder) Upsert(v interface{}) (string, []interface{}, error) {
+	columns, err := parseColumns(v)
+	if err != nil {
+		return "", nil, err
+	}
+
+	names, args := b.writableColumns(columns)
+	var keys, updates []string
+	for _, col := range columns {
+		if col.key {
+			keys = append(keys, b.quote(col.name))
+		} else if !col.auto {
+			updates = append(updates, b.quote(col.name))
+		}
+	}
+	if len(keys) == 0 {
+		return "", nil, ErrNoKeyColumns
+	}
+	if len(updates) == 0 {
+		return "", nil, ErrNoUpdateColumns
+	}
+
+	insert := fmt.Sprintf("insert into %s (%s) values (%s)", b.quote(b.table), strings.Join(names, ", "),
+		b.placeholders(1, len(args)))
+	sets := make([]string, len(updates))
+	switch b.dialect {
+	case MysqlDialect:
+		for i, name := range updates {
+			sets[i] = fmt.Sprintf("%s = values(%s)", name, name)
+		}
+		return fmt.Sprintf("%s on duplicate key update %s", insert, strings.Join(sets, ", ")), args, nil
+	case PostgreDialect:
+		for i, name := range updates {
+			sets[i] = fmt.Sprintf("%s = excluded.%s", name, name)
+		}
+		return fmt.Sprintf("%s on conflict (%s) do update set %s", insert, strings.Join(keys, ", "),
+			strings.Join(sets, ", ")), args, nil
+	default:
+		return "", nil, ErrUnknownDialect
+	}
+}
+
+// Values returns the values clause of v, like (?, ?), with the arguments, the auto columns are skipped.
+func (b StmtBuilder) Values(v interface{}) (string, []interface{}, error) {
+	columns, err := parseColumns(v)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, args := b.writableColumns(columns)
+	return fmt.Sprintf("(%s)", b.placeholders(1, len(args))), args, nil
+}
+
+// Update returns the statement that updates the non-key columns of v by the key columns.
+func (b StmtBuilder) Update(v interface{}) (string, []interface{}, error) {
+	columns, err := parseColumns(v)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sets, conds []string
+	var args, keyArgs []interface{}
+	for _, col := range columns {
+		if col.key {
+			keyArgs = append(keyArgs, col.value)
+		} else if !col.auto {
+			args = append(args, col.value)
+			sets = append(sets, fmt.Sprintf("%s = %s", b.quote(col.name), b.placeholder(len(args))))
+		}
+	}
+	if len(keyArgs) == 0 {
+		return "", nil, ErrNoKeyColumns
+	}
+	if len(sets) == 0 {
+		return "", nil, ErrNoUpdateColumns
+	}
+
+	for _, col := range columns {
+		if col.key {
+			holder := b.placeholder(len(args) + len(conds) + 1)
+			conds = append(conds, fmt.Sprintf("%s = %s", b.quote(col.name), holder))
+		}
+	}
+
+	return fmt.Sprintf("update %s set %s where %s", b.quote(b.table), strings.Join(sets, ", "),
+		strings.Join(conds, " and ")), append(args, keyArgs...), nil
+}
+
+func (b StmtBuilder) placeholder(index int) string {
+	if b.dialect == PostgreDialect {
+		return fmt.Sprintf("$%d", index)
+	}
+
+	return "?"
+}
+
+func (b StmtBuilder) placeholders(start, count int) string {
+	holders := make([]string, count)
+	for i := range holders {
+		holders[i] = b.placeholder(start + i)
+	}
+
+	return strings.Join(holders, ", ")
+}
+
+// quote quotes each part of the qualified name, like db.user.
+func (b StmtBuilder) quote(name string) string {
+	quote := "`"
+	if b.dialect == PostgreDialect {
+		quote = `"`
+	}
+
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quote + part + quote
+	}
+
+	return strings.Join(parts, ".")
+}
+
+func (b StmtBuilder) writableColumns(columns []column) ([]string, []interface{}) {
+	var names []string
+	var args []interface{}
+	for _, col := range columns {
+		if !col.auto {
+			names = append(names, b.quote(col.name))
+			args = append(args, col.value)
+		}
+	}
+
+	return names, args
+}
+
+// parseColumns returns the db tagged columns of v, including the ones of the embedded structs.
+func parseColumns(v interface{}) ([]column, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, ErrNotStruct
+	}
+
+	columns := appendColumns(nil, rv)
+	if len(columns) == 0 {
+		return nil, ErrNoColumns
+	}
+
+	return columns, nil
+}
+
+func appendColumns(columns []column, v reflect.Value) []column {
+	rt := v.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		value := v.Field(i)
+		name, options := parseTag(field)
+		if len(name) > 0 && !value.CanInterface() {
+			continue
+		}
+		if len(name) == 0 {
+			if field.Anonymous && mapping.Deref(field.Type).Kind() == reflect.Struct {
+				if value.Kind() == reflect.Ptr {
+					if value.IsNil() {
+						continue
+					}
+					value = value.Elem()
+				}
+				columns = appendColumns(columns, value)
+			}
+			continue
+		}
+
+		col := column{
+			name: name,
+		}
+		for _, option := range options {
+			switch strings.TrimSpace(option) {
+			case keyOption:
+				col.key = true
+			case autoOption:
+				col.auto = true
+			}
+		}
+		if value.Kind() == reflect.Ptr && value.IsNil() {
+			col.value = nil
+		} else {
+			col.value = reflect.Indirect(value).Interface()
+		}
+		columns = append(columns, col)
+	}
+
+	return columns
+}
@@ -0,0 +1,161 @@
+package sqlx
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	builderBase struct {
+		CreateTime string `db:"create_time"`
+	}
+
+	builderUser struct {
+		builderBase
+		Id       int64   `db:"id,key,auto"`
+		Name     string  `db:"name"`
+		Nickname *string `db:"nickname"`
+		Ignored  string
+	}
+
+	builderScore struct {
+		UserId int64 `db:"user_id,key"`
+		Game   int   `db:"game,key"`
+		Score  int   `db:"score"`
+	}
+)
+
+func TestStmtBuilderInsert(t *testing.T) {
+	nickname := "bar"
+	user := builderUser{
+		builderBase: builderBase{
+			CreateTime: "2019-01-01",
+		},
+		Id:       1,
+		Name:     "foo",
+		Nickname: &nickname,
+	}
+
+	stmt, args, err := NewStmtBuilder("user", MysqlDialect).Insert(&user)
+	assert.Nil(t, err)
+	assert.Equal(t, "insert into `user` (`create_time`, `name`, `nickname`) values (?, ?, ?)", stmt)
+	assert.Equal(t, []interface{}{"2019-01-01", "foo", "bar"}, args)
+
+	user.Nickname = nil
+	stmt, args, err = NewStmtBuilder("user", PostgreDialect).Insert(user)
+	assert.Nil(t, err)
+	assert.Equal(t, `insert into "user" ("create_time", "name", "nickname") values ($1, $2, $3)`, stmt)
+	assert.Equal(t, []interface{}{"2019-01-01", "foo", nil}, args)
+}
+
+func TestStmtBuilderUpsert(t *testing.T) {
+	score := builderScore{
+		UserId: 1,
+		Game:   2,
+		Score:  100,
+	}
+
+	stmt, args, err := NewStmtBuilder("score", MysqlDialect).Upsert(score)
+	assert.Nil(t, err)
+	assert.Equal(t, "insert into `score` (`user_id`, `game`, `score`) values (?, ?, ?) "+
+		"on duplicate key update `score` = values(`score`)", stmt)
+	assert.Equal(t, []interface{}{int64(1), 2, 100}, args)
+
+	stmt, args, err = NewStmtBuilder("score", PostgreDialect).Upsert(score)
+	assert.Nil(t, err)
+	assert.Equal(t, `insert into "score" ("user_id", "game", "score") values ($1, $2, $3) `+
+		`on conflict ("user_id", "game") do update set "score" = excluded."score"`, stmt)
+	assert.Equal(t, []interface{}{int64(1), 2, 100}, args)
+
+	_, _, err = NewStmtBuilder("score", Dialect(-1)).Upsert(score)
+	assert.Equal(t, ErrUnknownDialect, err)
+}
+
+func TestStmtBuilderUpdate(t *testing.T) {
+	stmt, args, err := NewStmtBuilder("score", MysqlDialect).Update(builderScore{
+		UserId: 1,
+		Game:   2,
+		Score:  100,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "update `score` set `score` = ? where `user_id` = ? and `game` = ?", stmt)
+	assert.Equal(t, []interface{}{100, int64(1), 2}, args)
+
+	stmt, args, err = NewStmtBuilder("user", PostgreDialect).Update(builderUser{
+		Id:   1,
+		Name: "foo",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `update "user" set "create_time" = $1, "name" = $2, "nickname" = $3 where "id" = $4`, stmt)
+	assert.Equal(t, []interface{}{"", "foo", nil, int64(1)}, args)
+}
+
+func TestStmtBuilderErrors(t *testing.T) {
+	builder := NewStmtBuilder("any", MysqlDialect)
+
+	_, _, err := builder.Insert(1)
+	assert.Equal(t, ErrNotStruct, err)
+
+	_, _, err = builder.Insert(struct{ Name string }{})
+	assert.Equal(t, ErrNoColumns, err)
+
+	_, _, err = builder.Update(struct {
+		Name string `db:"name"`
+	}{})
+	assert.Equal(t, ErrNoKeyColumns, err)
+
+	_, _, err = builder.Upsert(struct {
+		Id int64 `db:"id,key"`
+	}{})
+	assert.Equal(t, ErrNoUpdateColumns, err)
+}
+
+func TestStmtBuilderBulkValues(t *testing.T) {
+	builder := NewStmtBuilder("score", MysqlDialect)
+	stmt, err := builder.InsertWithoutValues(builderScore{})
+	assert.Nil(t, err)
+	assert.Equal(t, "insert into `score` (`user_id`, `game`, `score`) values", stmt)
+
+	valueFormat, args, err := builder.Values(builderScore{
+		UserId: 1,
+		Game:   2,
+		Score:  100,
+	})
+	assert.Nil(t, err)
+	value, err := format(valueFormat, args...)
+	assert.Nil(t, err)
+	assert.Equal(t, "(1, 2, 100)", value)
+}
+
+func TestStmtBuilderBulkValuesWithTime(t *testing.T) {
+	type event struct {
+		Id       int64          `db:"id,key,auto"`
+		Name     string         `db:"name"`
+		Payload  []byte         `db:"payload"`
+		Remark   sql.NullString `db:"remark"`
+		CreateAt time.Time      `db:"create_at"`
+	}
+
+	valueFormat, args, err := NewStmtBuilder("event", MysqlDialect).Values(event{
+		Name:     "login",
+		Payload:  []byte(`{"a":"b"}`),
+		CreateAt: time.Date(2026, 10, 17, 18, 0, 0, 0, time.UTC),
+	})
+	assert.Nil(t, err)
+	value, err := format(valueFormat, args...)
+	assert.Nil(t, err)
+	assert.Equal(t, `('login', '{\"a\":\"b\"}', NULL, '2026-10-17 18:00:00')`, value)
+}
+
+func TestStmtBuilderQualifiedTable(t *testing.T) {
+	stmt, err := NewStmtBuilder("db.score", MysqlDialect).InsertWithoutValues(builderScore{})
+	assert.Nil(t, err)
+	assert.Equal(t, "insert into `db`.`score` (`user_id`, `game`, `score`) values", stmt)
+
+	stmt, _, err = NewStmtBuilder("public.score", PostgreDialect).Insert(builderScore{})
+	assert.Nil(t, err)
+	assert.Equal(t, `insert into "public"."score" ("user_id", "game", "score") values ($1, $2, $3)`, stmt)
+}
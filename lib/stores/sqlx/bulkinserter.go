@@ -35,6 +35,17 @@ func NewBulkInserter(sqlConn SqlConn, stmt string) *BulkInserter {
 	}
 }
 
+// NewStructBulkInserter returns a BulkInserter that inserts the structs like v into table of mysql,
+// the columns are the db tagged fields of v, except the auto ones.
+func NewStructBulkInserter(sqlConn SqlConn, table string, v interface{}) (*BulkInserter, error) {
+	stmt, err := NewStmtBuilder(table, MysqlDialect).InsertWithoutValues(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBulkInserter(sqlConn, stmt), nil
+}
+
 func (bi *BulkInserter) Flush() {
 	bi.executor.ForceFlush()
 }
@@ -50,6 +61,17 @@ func (bi *BulkInserter) Insert(valueFormat string, args ...interface{}) error {
 	return nil
 }
 
+// InsertStruct inserts the db tagged fields of v, the columns need to match the statement,
+// like the one of NewStructBulkInserter.
+func (bi *BulkInserter) InsertStruct(v interface{}) error {
+	valueFormat, args, err := NewStmtBuilder("", MysqlDialect).Values(v)
+	if err != nil {
+		return err
+	}
+
+	return bi.Insert(valueFormat, args...)
+}
+
 func (bi *BulkInserter) SetResultHandler(handler ResultHandler) {
 	bi.executor.Sync(func() {
 		bi.inserter.resultHandler = handler
@@ -0,0 +1,34 @@
+package sqlx
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNotPingable = errors.New("sql connection can't be pinged")
+
+type pinger interface {
+	ping(ctx context.Context) error
+}
+
+// NewHealthCheck returns a health check that pings the database of conn,
+// it can be registered by service.RegisterHealthCheck.
+func NewHealthCheck(conn SqlConn) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if p, ok := conn.(pinger); ok {
+			return p.ping(ctx)
+		}
+
+		return ErrNotPingable
+	}
+}
+
+func (db *commonSqlConn) ping(ctx context.Context) error {
+	conn, err := getSqlConn(db.driverName, db.datasource)
+	if err != nil {
+		logInstanceError(db.datasource, err)
+		return err
+	}
+
+	return conn.PingContext(ctx)
+}
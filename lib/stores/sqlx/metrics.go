@@ -0,0 +1,91 @@
+package sqlx
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	maxTemplateLen = 256
+	// the max distinct templates to label the metrics, the others are labeled as otherTemplate
+	maxTemplates  = 500
+	otherTemplate = "other"
+	valuesKeyword = " values"
+)
+
+var (
+	statementDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "sql",
+		Subsystem: "client",
+		Name:      "duration_ms",
+		Help:      "sql statement durations in milliseconds.",
+		Buckets:   []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500},
+	}, []string{"command", "statement"})
+	statementErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sql",
+		Subsystem: "client",
+		Name:      "error_total",
+		Help:      "sql statement error count.",
+	}, []string{"command", "statement"})
+
+	// the literals are replaced by ?, and the lists of ?, like the ones of IN, are collapsed,
+	// so that the statements of different values share the same template.
+	stringLiteral   = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	numberLiteral   = regexp.MustCompile(`\b[0-9]+(?:\.[0-9]+)?\b`)
+	placeholderList = regexp.MustCompile(`\?(?:\s*,\s*\?)+`)
+
+	templates     = make(map[string]struct{})
+	templatesLock sync.Mutex
+)
+
+func init() {
+	// exported by the agent started with prometheus.StartAgent
+	prometheus.MustRegister(statementDuration, statementErrors)
+}
+
+func reportStatement(command, q string, duration time.Duration, err error) {
+	template := boundTemplate(statementTemplate(q))
+	statementDuration.WithLabelValues(command, template).Observe(float64(duration) / float64(time.Millisecond))
+	if err != nil {
+		statementErrors.WithLabelValues(command, template).Inc()
+	}
+}
+
+// boundTemplate bounds the cardinality of the statement label, the templates beyond the first
+// maxTemplates ones are labeled as otherTemplate.
+func boundTemplate(template string) string {
+	templatesLock.Lock()
+	defer templatesLock.Unlock()
+
+	if _, ok := templates[template]; ok {
+		return template
+	}
+	if len(templates) >= maxTemplates {
+		return otherTemplate
+	}
+
+	templates[template] = struct{}{}
+	return template
+}
+
+// statementTemplate returns the template of q to label the metrics, the values of the insert
+// statements are trimmed, because the bulk inserts put the values in the statements,
+// the literals are replaced by ?, and the lists of ? are collapsed into one.
+func statementTemplate(q string) string {
+	template := strings.Join(strings.Fields(q), " ")
+	if pos := strings.Index(strings.ToLower(template), valuesKeyword); pos >= 0 {
+		template = template[:pos+len(valuesKeyword)]
+	}
+	template = stringLiteral.ReplaceAllString(template, "?")
+	template = numberLiteral.ReplaceAllString(template, "?")
+	template = placeholderList.ReplaceAllString(template, "?")
+	if len(template) > maxTemplateLen {
+		template = template[:maxTemplateLen]
+	}
+
+	return template
+}
@@ -0,0 +1,83 @@
+package sqlx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatementTemplate(t *testing.T) {
+	tests := []struct {
+		query  string
+		expect string
+	}{
+		{
+			query:  "select name from users where id = ?",
+			expect: "select name from users where id = ?",
+		},
+		{
+			query:  "select name\n\tfrom users  where id = ?",
+			expect: "select name from users where id = ?",
+		},
+		{
+			query:  "insert into users (id, name) VALUES (1, 'a'), (2, 'b')",
+			expect: "insert into users (id, name) VALUES",
+		},
+		{
+			query:  "select name from users where id in (?, ?,?) and age > 18 and name != 'o''neil' and t2.id = 1.5",
+			expect: "select name from users where id in (?) and age > ? and name != ? and t2.id = ?",
+		},
+		{
+			query:  "select " + strings.Repeat("a", maxTemplateLen),
+			expect: ("select " + strings.Repeat("a", maxTemplateLen))[:maxTemplateLen],
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			assert.Equal(t, test.expect, statementTemplate(test.query))
+		})
+	}
+}
+
+func TestBoundTemplate(t *testing.T) {
+	templatesLock.Lock()
+	saved := templates
+	templates = make(map[string]struct{})
+	templatesLock.Unlock()
+	defer func() {
+		templatesLock.Lock()
+		templates = saved
+		templatesLock.Unlock()
+	}()
+
+	for i := 0; i < maxTemplates; i++ {
+		template := fmt.Sprintf("select * from t%d", i)
+		assert.Equal(t, template, boundTemplate(template))
+	}
+	assert.Equal(t, otherTemplate, boundTemplate("select * from other"))
+	assert.Equal(t, "select * from t0", boundTemplate("select * from t0"))
+}
+
+func TestReportStatementSubMillisecond(t *testing.T) {
+	const q = "select * from sub_millisecond"
+	reportStatement("query", q, 500*time.Microsecond, nil)
+
+	var m dto.Metric
+	observer := statementDuration.WithLabelValues("query", boundTemplate(statementTemplate(q)))
+	assert.Nil(t, observer.(prometheus.Metric).Write(&m))
+	assert.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+	assert.InDelta(t, 0.5, m.GetHistogram().GetSampleSum(), 1e-9)
+}
+
+func TestFormatStmt(t *testing.T) {
+	assert.Equal(t, "select name from users where id = 1",
+		formatStmt("select name from users where id = ?", 1))
+	assert.Equal(t, "select name from users where id = $1 - 1",
+		formatStmt("select name from users where id = $1", 1))
+}
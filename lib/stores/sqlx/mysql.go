@@ -1,6 +1,10 @@
 package sqlx
 
-import _ "github.com/go-sql-driver/mysql"
+import (
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
 
 const (
 	mysqlDriverName = "mysql"
@@ -30,3 +34,11 @@ func WithAliyun() SqlOption {
 		conn.beginTx = beginAliyun
 	}
 }
+
+// WithSlowThreshold logs the statements slower than threshold on the connection as slow,
+// instead of the threshold of SetSlowThreshold.
+func WithSlowThreshold(threshold time.Duration) SqlOption {
+	return func(conn *commonSqlConn) {
+		conn.slowThreshold = threshold
+	}
+}
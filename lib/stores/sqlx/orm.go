@@ -222,12 +222,18 @@ func mapStructFieldsIntoSlice(v reflect.Value, columns []string) ([]interface{},
 }
 
 func parseTagName(field reflect.StructField) string {
+	name, _ := parseTag(field)
+	return name
+}
+
+// parseTag returns the column name and the options of the db tag, like `db:"id,key,auto"`.
+func parseTag(field reflect.StructField) (string, []string) {
 	key := field.Tag.Get(tagName)
 	if len(key) == 0 {
-		return ""
+		return "", nil
 	} else {
 		options := strings.Split(key, ",")
-		return options[0]
+		return options[0], options[1:]
 	}
 }
 
@@ -0,0 +1,182 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/vsaien/cuter/lib/logx"
+	"github.com/vsaien/cuter/lib/syncx"
+	"github.com/vsaien/cuter/lib/threading"
+)
+
+const (
+	replicaCheckInterval = time.Second * 5
+	replicaPingTimeout   = time.Second
+)
+
+type (
+	readPrimaryKey struct{}
+
+	replicaConn interface {
+		Session
+		pinger
+	}
+
+	replica struct {
+		conn    replicaConn
+		name    string
+		healthy int32
+	}
+
+	// rwSqlConn sends the queries to the healthy replicas in round robin,
+	// the others, including everything in transactions, are sent to the primary.
+	rwSqlConn struct {
+		primary  SqlConn
+		replicas []*replica
+		index    uint32
+		done     *syncx.DoneChan
+	}
+)
+
+// NewMysqlWithReplicas returns a SqlConn that reads from the replicas and writes to the primary,
+// the reads are sent to the primary if no replica is healthy, or ReadPrimary is used on the context.
+// The replicas are checked on the background until the returned SqlConn is closed by io.Closer.
+func NewMysqlWithReplicas(primary string, replicas []string, opts ...SqlOption) SqlConn {
+	conn := &rwSqlConn{
+		primary: NewMysql(primary, opts...),
+		done:    syncx.NewDoneChan(),
+	}
+	for _, datasource := range replicas {
+		rc, ok := NewMysql(datasource, opts...).(replicaConn)
+		if !ok {
+			logx.Errorf("replica %s can't be health checked, ignored", datasource)
+			continue
+		}
+
+		conn.replicas = append(conn.replicas, &replica{
+			conn:    rc,
+			name:    datasource,
+			healthy: 1,
+		})
+	}
+
+	if len(conn.replicas) > 0 {
+		threading.GoSafe(conn.checkReplicas)
+	}
+
+	return conn
+}
+
+// ReadPrimary returns a context that makes the queries with it read from the primary,
+// it's used to read the writes just done, which might not be replicated yet.
+func ReadPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readPrimaryKey{}, true)
+}
+
+func (db *rwSqlConn) Exec(q string, args ...interface{}) (sql.Result, error) {
+	return db.primary.Exec(q, args...)
+}
+
+func (db *rwSqlConn) ExecCtx(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	return db.primary.ExecCtx(ctx, q, args...)
+}
+
+// Prepare prepares the statement on the primary, because it might be used to write.
+func (db *rwSqlConn) Prepare(query string) (StmtSession, error) {
+	return db.primary.Prepare(query)
+}
+
+func (db *rwSqlConn) PrepareCtx(ctx context.Context, query string) (StmtSession, error) {
+	return db.primary.PrepareCtx(ctx, query)
+}
+
+func (db *rwSqlConn) QueryRow(v interface{}, q string, args ...interface{}) error {
+	return db.QueryRowCtx(context.Background(), v, q, args...)
+}
+
+func (db *rwSqlConn) QueryRowCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	return db.reader(ctx).QueryRowCtx(ctx, v, q, args...)
+}
+
+func (db *rwSqlConn) QueryRows(v interface{}, q string, args ...interface{}) error {
+	return db.QueryRowsCtx(context.Background(), v, q, args...)
+}
+
+func (db *rwSqlConn) QueryRowsCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	return db.reader(ctx).QueryRowsCtx(ctx, v, q, args...)
+}
+
+func (db *rwSqlConn) Transact(fn func(Session) error) error {
+	return db.primary.Transact(fn)
+}
+
+func (db *rwSqlConn) TransactCtx(ctx context.Context, fn func(context.Context, Session) error) error {
+	return db.primary.TransactCtx(ctx, fn)
+}
+
+// Close stops checking the replicas, the connections are kept, because they are shared.
+func (db *rwSqlConn) Close() error {
+	db.done.Close()
+	return nil
+}
+
+func (db *rwSqlConn) checkReplicas() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			db.pingReplicas()
+		case <-db.done.Done():
+			return
+		}
+	}
+}
+
+func (db *rwSqlConn) ping(ctx context.Context) error {
+	if p, ok := db.primary.(pinger); ok {
+		return p.ping(ctx)
+	}
+
+	return ErrNotPingable
+}
+
+func (db *rwSqlConn) pingReplicas() {
+	for _, r := range db.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaPingTimeout)
+		err := r.conn.ping(ctx)
+		cancel()
+
+		if err != nil {
+			if atomic.SwapInt32(&r.healthy, 0) == 1 {
+				logx.Errorf("replica %s is down: %v", r.name, err)
+			}
+		} else if atomic.SwapInt32(&r.healthy, 1) == 0 {
+			logx.Infof("replica %s is recovered", r.name)
+		}
+	}
+}
+
+func (db *rwSqlConn) reader(ctx context.Context) Session {
+	if primary, ok := ctx.Value(readPrimaryKey{}).(bool); ok && primary {
+		return db.primary
+	}
+
+	size := uint32(len(db.replicas))
+	if size == 0 {
+		return db.primary
+	}
+
+	start := atomic.AddUint32(&db.index, 1)
+	for i := uint32(0); i < size; i++ {
+		r := db.replicas[(start+i)%size]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r.conn
+		}
+	}
+
+	return db.primary
+}
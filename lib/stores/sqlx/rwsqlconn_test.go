@@ -0,0 +1,171 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/vsaien/cuter/lib/syncx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockedSession struct {
+	name    string
+	pingErr error
+	reads   int
+	writes  int
+}
+
+func (s *mockedSession) Exec(q string, args ...interface{}) (sql.Result, error) {
+	return s.ExecCtx(context.Background(), q, args...)
+}
+
+func (s *mockedSession) ExecCtx(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	s.writes++
+	return nil, nil
+}
+
+func (s *mockedSession) Prepare(query string) (StmtSession, error) {
+	return nil, nil
+}
+
+func (s *mockedSession) PrepareCtx(ctx context.Context, query string) (StmtSession, error) {
+	return nil, nil
+}
+
+func (s *mockedSession) QueryRow(v interface{}, q string, args ...interface{}) error {
+	return s.QueryRowCtx(context.Background(), v, q, args...)
+}
+
+func (s *mockedSession) QueryRowCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	s.reads++
+	return nil
+}
+
+func (s *mockedSession) QueryRows(v interface{}, q string, args ...interface{}) error {
+	return s.QueryRowsCtx(context.Background(), v, q, args...)
+}
+
+func (s *mockedSession) QueryRowsCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	s.reads++
+	return nil
+}
+
+func (s *mockedSession) Transact(fn func(Session) error) error {
+	return fn(s)
+}
+
+func (s *mockedSession) TransactCtx(ctx context.Context, fn func(context.Context, Session) error) error {
+	return fn(ctx, s)
+}
+
+func (s *mockedSession) ping(ctx context.Context) error {
+	return s.pingErr
+}
+
+func newMockedRwConn(replicas ...*mockedSession) (*rwSqlConn, *mockedSession) {
+	primary := &mockedSession{name: "primary"}
+	conn := &rwSqlConn{
+		primary: primary,
+		done:    syncx.NewDoneChan(),
+	}
+	for _, r := range replicas {
+		conn.replicas = append(conn.replicas, &replica{
+			conn:    r,
+			name:    r.name,
+			healthy: 1,
+		})
+	}
+
+	return conn, primary
+}
+
+func TestRwSqlConnRoundRobin(t *testing.T) {
+	first := &mockedSession{name: "first"}
+	second := &mockedSession{name: "second"}
+	conn, primary := newMockedRwConn(first, second)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, conn.QueryRow(nil, "select 1"))
+	}
+	assert.Equal(t, 5, first.reads)
+	assert.Equal(t, 5, second.reads)
+	assert.Equal(t, 0, primary.reads)
+
+	_, err := conn.Exec("update users set name=?", "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, primary.writes)
+	assert.Equal(t, 0, first.writes+second.writes)
+}
+
+func TestRwSqlConnSkipsUnhealthyReplicas(t *testing.T) {
+	first := &mockedSession{name: "first", pingErr: errors.New("down")}
+	second := &mockedSession{name: "second"}
+	conn, primary := newMockedRwConn(first, second)
+	conn.pingReplicas()
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, conn.QueryRows(nil, "select 1"))
+	}
+	assert.Equal(t, 0, first.reads)
+	assert.Equal(t, 10, second.reads)
+
+	second.pingErr = errors.New("down")
+	conn.pingReplicas()
+	assert.Nil(t, conn.QueryRows(nil, "select 1"))
+	assert.Equal(t, 1, primary.reads)
+
+	first.pingErr = nil
+	conn.pingReplicas()
+	assert.Nil(t, conn.QueryRows(nil, "select 1"))
+	assert.Equal(t, 1, first.reads)
+}
+
+func TestRwSqlConnReadPrimary(t *testing.T) {
+	replica := &mockedSession{name: "replica"}
+	conn, primary := newMockedRwConn(replica)
+
+	assert.Nil(t, conn.QueryRowCtx(ReadPrimary(context.Background()), nil, "select 1"))
+	assert.Equal(t, 1, primary.reads)
+	assert.Equal(t, 0, replica.reads)
+}
+
+func TestRwSqlConnTransactOnPrimary(t *testing.T) {
+	replica := &mockedSession{name: "replica"}
+	conn, primary := newMockedRwConn(replica)
+
+	assert.Nil(t, conn.Transact(func(session Session) error {
+		return session.QueryRow(nil, "select 1 for update")
+	}))
+	assert.Equal(t, 1, primary.reads)
+	assert.Equal(t, 0, replica.reads)
+}
+
+func TestRwSqlConnClose(t *testing.T) {
+	conn, _ := newMockedRwConn(&mockedSession{name: "replica"})
+	finished := make(chan struct{})
+	go func() {
+		conn.checkReplicas()
+		close(finished)
+	}()
+
+	assert.Nil(t, conn.Close())
+	assert.Nil(t, conn.Close())
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("replicas still checked after closed")
+	}
+}
+
+func TestNewMysqlWithReplicas(t *testing.T) {
+	conn := NewMysqlWithReplicas("primary", []string{"first", "second"})
+	assert.Equal(t, 2, len(conn.(*rwSqlConn).replicas))
+	closer, ok := conn.(io.Closer)
+	assert.True(t, ok)
+	assert.Nil(t, closer.Close())
+}
@@ -1,27 +1,42 @@
 package sqlx
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"time"
+)
 
 type (
-	// Session stands for raw connections or transaction sessions
+	// Session stands for raw connections or transaction sessions.
+	// Note that the Ctx methods are required by Session, SqlConn and StmtSession, so the implementations
+	// outside this package must add them, like calling the methods without ctx if not cancellable.
 	Session interface {
 		Exec(query string, args ...interface{}) (sql.Result, error)
+		ExecCtx(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 		Prepare(query string) (StmtSession, error)
+		PrepareCtx(ctx context.Context, query string) (StmtSession, error)
 		QueryRow(v interface{}, query string, args ...interface{}) error
+		QueryRowCtx(ctx context.Context, v interface{}, query string, args ...interface{}) error
 		QueryRows(v interface{}, query string, args ...interface{}) error
+		QueryRowsCtx(ctx context.Context, v interface{}, query string, args ...interface{}) error
 	}
 
 	// SqlConn only stands for raw connections, so Transact method can be called.
 	SqlConn interface {
 		Session
 		Transact(func(session Session) error) error
+		// TransactCtx rolls back the transaction if ctx is done before committing.
+		TransactCtx(ctx context.Context, fn func(ctx context.Context, session Session) error) error
 	}
 
 	StmtSession interface {
 		Close() error
 		Exec(args ...interface{}) (sql.Result, error)
+		ExecCtx(ctx context.Context, args ...interface{}) (sql.Result, error)
 		QueryRow(v interface{}, args ...interface{}) error
+		QueryRowCtx(ctx context.Context, v interface{}, args ...interface{}) error
 		QueryRows(v interface{}, args ...interface{}) error
+		QueryRowsCtx(ctx context.Context, v interface{}, args ...interface{}) error
 	}
 
 	// thread-safe
@@ -31,73 +46,102 @@ type (
 		driverName string
 		datasource string
 		beginTx    beginnable
+		// 0 to use the one of SetSlowThreshold
+		slowThreshold time.Duration
 	}
 
 	sessionConn interface {
-		Exec(query string, args ...interface{}) (sql.Result, error)
-		Query(query string, args ...interface{}) (*sql.Rows, error)
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 	}
 
 	statement struct {
-		stmt *sql.Stmt
+		query         string
+		stmt          *sql.Stmt
+		slowThreshold time.Duration
 	}
 
 	stmtConn interface {
-		Exec(args ...interface{}) (sql.Result, error)
-		Query(args ...interface{}) (*sql.Rows, error)
+		ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error)
+		QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error)
 	}
 )
 
 func (db *commonSqlConn) Exec(q string, args ...interface{}) (sql.Result, error) {
+	return db.ExecCtx(context.Background(), q, args...)
+}
+
+func (db *commonSqlConn) ExecCtx(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
 	conn, err := getSqlConn(db.driverName, db.datasource)
 	if err != nil {
 		logInstanceError(db.datasource, err)
 		return nil, err
 	}
 
-	return exec(conn, q, args...)
+	return exec(ctx, conn, db.slowThreshold, q, args...)
 }
 
 func (db *commonSqlConn) Prepare(query string) (StmtSession, error) {
+	return db.PrepareCtx(context.Background(), query)
+}
+
+func (db *commonSqlConn) PrepareCtx(ctx context.Context, query string) (StmtSession, error) {
 	conn, err := getSqlConn(db.driverName, db.datasource)
 	if err != nil {
 		logInstanceError(db.datasource, err)
 		return nil, err
 	}
 
-	if stmt, err := conn.Prepare(query); err != nil {
+	if stmt, err := conn.PrepareContext(ctx, query); err != nil {
 		return nil, err
 	} else {
 		return statement{
-			stmt: stmt,
+			query:         query,
+			stmt:          stmt,
+			slowThreshold: db.slowThreshold,
 		}, nil
 	}
 }
 
 func (db *commonSqlConn) QueryRow(v interface{}, q string, args ...interface{}) error {
-	return db.queryRows(func(rows *sql.Rows) error {
+	return db.QueryRowCtx(context.Background(), v, q, args...)
+}
+
+func (db *commonSqlConn) QueryRowCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	return db.queryRows(ctx, func(rows *sql.Rows) error {
 		return UnmarshalRow(v, rows)
 	}, q, args...)
 }
 
 func (db *commonSqlConn) QueryRows(v interface{}, q string, args ...interface{}) error {
-	return db.queryRows(func(rows *sql.Rows) error {
+	return db.QueryRowsCtx(context.Background(), v, q, args...)
+}
+
+func (db *commonSqlConn) QueryRowsCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	return db.queryRows(ctx, func(rows *sql.Rows) error {
 		return UnmarshalRows(v, rows)
 	}, q, args...)
 }
 
-func (db *commonSqlConn) Transact(fn func(Session) error) (err error) {
-	return transact(db, db.beginTx, fn)
+func (db *commonSqlConn) Transact(fn func(Session) error) error {
+	return db.TransactCtx(context.Background(), func(_ context.Context, session Session) error {
+		return fn(session)
+	})
+}
+
+func (db *commonSqlConn) TransactCtx(ctx context.Context, fn func(context.Context, Session) error) error {
+	return transact(ctx, db, db.beginTx, fn)
 }
 
-func (db *commonSqlConn) queryRows(scanner func(*sql.Rows) error, q string, args ...interface{}) error {
+func (db *commonSqlConn) queryRows(ctx context.Context, scanner func(*sql.Rows) error,
+	q string, args ...interface{}) error {
 	conn, err := getSqlConn(db.driverName, db.datasource)
 	if err != nil {
 		logInstanceError(db.datasource, err)
 		return err
 	}
 
-	return query(conn, scanner, q, args...)
+	return query(ctx, conn, db.slowThreshold, scanner, q, args...)
 }
 
 func (s statement) Close() error {
@@ -105,17 +149,29 @@ func (s statement) Close() error {
 }
 
 func (s statement) Exec(args ...interface{}) (sql.Result, error) {
-	return execStmt(s.stmt, args...)
+	return s.ExecCtx(context.Background(), args...)
+}
+
+func (s statement) ExecCtx(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	return execStmt(ctx, s.stmt, s.slowThreshold, s.query, args...)
 }
 
 func (s statement) QueryRow(v interface{}, args ...interface{}) error {
-	return queryStmt(s.stmt, func(rows *sql.Rows) error {
+	return s.QueryRowCtx(context.Background(), v, args...)
+}
+
+func (s statement) QueryRowCtx(ctx context.Context, v interface{}, args ...interface{}) error {
+	return queryStmt(ctx, s.stmt, s.slowThreshold, func(rows *sql.Rows) error {
 		return UnmarshalRow(v, rows)
-	}, args...)
+	}, s.query, args...)
 }
 
 func (s statement) QueryRows(v interface{}, args ...interface{}) error {
-	return queryStmt(s.stmt, func(rows *sql.Rows) error {
+	return s.QueryRowsCtx(context.Background(), v, args...)
+}
+
+func (s statement) QueryRowsCtx(ctx context.Context, v interface{}, args ...interface{}) error {
+	return queryStmt(ctx, s.stmt, s.slowThreshold, func(rows *sql.Rows) error {
 		return UnmarshalRows(v, rows)
-	}, args...)
+	}, s.query, args...)
 }
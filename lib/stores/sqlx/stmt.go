@@ -1,69 +1,60 @@
 package sqlx
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/vsaien/cuter/lib/logx"
 )
 
-const slowThreshold = time.Millisecond * 500
+const defaultSlowThreshold = time.Millisecond * 500
 
-func exec(conn sessionConn, q string, args ...interface{}) (sql.Result, error) {
-	stmt, err := format(q, args...)
+var slowThreshold = int64(defaultSlowThreshold)
+
+// SetSlowThreshold sets the threshold of the slow statements, which are logged by logx.Slow,
+// the connections created with WithSlowThreshold use their own thresholds.
+func SetSlowThreshold(threshold time.Duration) {
+	atomic.StoreInt64(&slowThreshold, int64(threshold))
+}
+
+func exec(ctx context.Context, conn sessionConn, threshold time.Duration, q string,
+	args ...interface{}) (sql.Result, error) {
+	stmt, err := formatQuery(q, args...)
 	if err != nil {
 		return nil, err
 	}
 
 	startTime := time.Now()
-	result, err := conn.Exec(q, args...)
-	duration := time.Since(startTime)
-	if duration > slowThreshold {
-		logx.Slowf("[SQL] exec: slowcall(%s) - %s", duration, stmt)
-	} else {
-		logx.Infof("sql exec: %s - %s", duration, stmt)
-	}
-	if err != nil {
-		logSqlError(stmt, err)
-	}
+	result, err := conn.ExecContext(ctx, q, args...)
+	logStatement("exec", q, stmt, threshold, time.Since(startTime), err)
 
 	return result, err
 }
 
-func execStmt(conn stmtConn, args ...interface{}) (sql.Result, error) {
-	stmt := fmt.Sprint(args...)
+func execStmt(ctx context.Context, conn stmtConn, threshold time.Duration, q string,
+	args ...interface{}) (sql.Result, error) {
+	stmt := formatStmt(q, args...)
 	startTime := time.Now()
-	result, err := conn.Exec(args...)
-	duration := time.Since(startTime)
-	if duration > slowThreshold {
-		logx.Slowf("[SQL] execStmt: slowcall(%s) - %s", duration, stmt)
-	} else {
-		logx.Infof("sql execStmt: %s - %s", duration, stmt)
-	}
-	if err != nil {
-		logSqlError(stmt, err)
-	}
+	result, err := conn.ExecContext(ctx, args...)
+	logStatement("execStmt", q, stmt, threshold, time.Since(startTime), err)
 
 	return result, err
 }
 
-func query(conn sessionConn, scanner func(*sql.Rows) error, q string, args ...interface{}) error {
-	stmt, err := format(q, args...)
+func query(ctx context.Context, conn sessionConn, threshold time.Duration, scanner func(*sql.Rows) error,
+	q string, args ...interface{}) error {
+	stmt, err := formatQuery(q, args...)
 	if err != nil {
 		return err
 	}
 
 	startTime := time.Now()
-	rows, err := conn.Query(q, args...)
-	duration := time.Since(startTime)
-	if duration > slowThreshold {
-		logx.Slowf("[SQL] query: slowcall(%s) - %s", duration, stmt)
-	} else {
-		logx.Infof("sql query: %s - %s", duration, stmt)
-	}
+	rows, err := conn.QueryContext(ctx, q, args...)
+	logStatement("query", q, stmt, threshold, time.Since(startTime), err)
 	if err != nil {
-		logSqlError(stmt, err)
 		return err
 	}
 	defer rows.Close()
@@ -71,21 +62,69 @@ func query(conn sessionConn, scanner func(*sql.Rows) error, q string, args ...in
 	return scanner(rows)
 }
 
-func queryStmt(conn stmtConn, scanner func(*sql.Rows) error, args ...interface{}) error {
-	stmt := fmt.Sprint(args...)
+func queryStmt(ctx context.Context, conn stmtConn, threshold time.Duration, scanner func(*sql.Rows) error,
+	q string, args ...interface{}) error {
+	stmt := formatStmt(q, args...)
 	startTime := time.Now()
-	rows, err := conn.Query(args...)
-	duration := time.Since(startTime)
-	if duration > slowThreshold {
-		logx.Slowf("[SQL] queryStmt: slowcall(%s) - %s", duration, stmt)
-	} else {
-		logx.Infof("sql queryStmt: %s - %s", duration, stmt)
-	}
+	rows, err := conn.QueryContext(ctx, args...)
+	logStatement("queryStmt", q, stmt, threshold, time.Since(startTime), err)
 	if err != nil {
-		logSqlError(stmt, err)
 		return err
 	}
 	defer rows.Close()
 
 	return scanner(rows)
 }
+
+// formatQuery formats the statement for logging, the mismatched arguments of the question mark
+// placeholders are rejected, the numbered placeholders, like $1 of postgres, are formatted by formatStmt.
+func formatQuery(q string, args ...interface{}) (string, error) {
+	stmt, err := format(q, args...)
+	if err == nil {
+		return stmt, nil
+	}
+
+	if hasNumberedPlaceholders(q) {
+		return formatStmt(q, args...), nil
+	}
+
+	return "", err
+}
+
+// formatStmt formats the statement for logging, the placeholders might not be question marks,
+// like the ones of postgres, so the arguments are appended if failed.
+func formatStmt(q string, args ...interface{}) string {
+	if stmt, err := format(q, args...); err == nil {
+		return stmt
+	}
+
+	return fmt.Sprint(q, " - ", fmt.Sprint(args...))
+}
+
+func hasNumberedPlaceholders(q string) bool {
+	for i := 0; i+1 < len(q); i++ {
+		if q[i] == '$' && q[i+1] >= '0' && q[i+1] <= '9' {
+			return true
+		}
+	}
+
+	return false
+}
+
+// logStatement logs the formatted stmt, and reports the metrics by the template q,
+// the statements slower than threshold are logged as slow, 0 to use the one of SetSlowThreshold.
+func logStatement(command, q, stmt string, threshold, duration time.Duration, err error) {
+	if threshold <= 0 {
+		threshold = time.Duration(atomic.LoadInt64(&slowThreshold))
+	}
+	if duration > threshold {
+		logx.Slowf("[SQL] %s: slowcall(%s) - %s", command, duration, stmt)
+	} else {
+		logx.Infof("sql %s: %s - %s", command, duration, stmt)
+	}
+	if err != nil {
+		logSqlError(stmt, err)
+	}
+
+	reportStatement(command, q, duration, err)
+}
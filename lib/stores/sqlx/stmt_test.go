@@ -0,0 +1,66 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockedConn struct {
+	ctx context.Context
+}
+
+func (c *mockedConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	c.ctx = ctx
+	return nil, ctx.Err()
+}
+
+func (c *mockedConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	c.ctx = ctx
+	return nil, ctx.Err()
+}
+
+func TestExecCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	conn := new(mockedConn)
+	_, err := exec(ctx, conn, 0, "delete from users where id=?", 1)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, ctx, conn.ctx)
+}
+
+func TestQueryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	conn := new(mockedConn)
+	err := query(ctx, conn, 0, func(rows *sql.Rows) error {
+		t.Fatal("should not scan")
+		return nil
+	}, "select name from users where id=?", 1)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, ctx, conn.ctx)
+}
+
+func TestExecMismatchedArgs(t *testing.T) {
+	conn := new(mockedConn)
+	_, err := exec(context.Background(), conn, 0, "delete from users where id=?", 1, 2)
+	assert.NotNil(t, err)
+	assert.Nil(t, conn.ctx)
+
+	err = query(context.Background(), conn, 0, func(rows *sql.Rows) error {
+		return nil
+	}, "select name from users where id=? and name=?", 1)
+	assert.NotNil(t, err)
+	assert.Nil(t, conn.ctx)
+}
+
+func TestExecNumberedPlaceholders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	conn := new(mockedConn)
+	_, err := exec(ctx, conn, 0, "delete from users where id=$1", 1)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, ctx, conn.ctx)
+}
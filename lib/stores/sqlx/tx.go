@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/vsaien/cuter/lib/errorx"
 	"github.com/vsaien/cuter/lib/logx"
@@ -16,7 +17,8 @@ const (
 )
 
 type (
-	beginnable func(*sql.DB) (trans, error)
+	// begins a transaction, the statements in it are logged with the slow threshold
+	beginnable func(ctx context.Context, db *sql.DB, slowThreshold time.Duration) (trans, error)
 
 	aliyunTx struct {
 		txSession
@@ -33,7 +35,8 @@ type (
 	}
 
 	txSession struct {
-		tx *sql.Tx
+		tx            *sql.Tx
+		slowThreshold time.Duration
 	}
 )
 
@@ -78,66 +81,96 @@ func (t *stdTrans) Rollback() error {
 }
 
 func (t txSession) Exec(q string, args ...interface{}) (sql.Result, error) {
-	return exec(t.tx, q, args...)
+	return t.ExecCtx(context.Background(), q, args...)
+}
+
+func (t txSession) ExecCtx(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	return exec(ctx, t.tx, t.slowThreshold, q, args...)
 }
 
 func (t txSession) Prepare(q string) (StmtSession, error) {
-	if stmt, err := t.tx.Prepare(q); err != nil {
+	return t.PrepareCtx(context.Background(), q)
+}
+
+func (t txSession) PrepareCtx(ctx context.Context, q string) (StmtSession, error) {
+	if stmt, err := t.tx.PrepareContext(ctx, q); err != nil {
 		return nil, err
 	} else {
 		return statement{
-			stmt: stmt,
+			query:         q,
+			stmt:          stmt,
+			slowThreshold: t.slowThreshold,
 		}, nil
 	}
 }
 
 func (t txSession) QueryRow(v interface{}, q string, args ...interface{}) error {
-	return query(t.tx, func(rows *sql.Rows) error {
+	return t.QueryRowCtx(context.Background(), v, q, args...)
+}
+
+func (t txSession) QueryRowCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	return query(ctx, t.tx, t.slowThreshold, func(rows *sql.Rows) error {
 		return UnmarshalRow(v, rows)
 	}, q, args...)
 }
 
 func (t txSession) QueryRows(v interface{}, q string, args ...interface{}) error {
-	return query(t.tx, func(rows *sql.Rows) error {
+	return t.QueryRowsCtx(context.Background(), v, q, args...)
+}
+
+func (t txSession) QueryRowsCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	return query(ctx, t.tx, t.slowThreshold, func(rows *sql.Rows) error {
 		return UnmarshalRows(v, rows)
 	}, q, args...)
 }
 
-func beginAliyun(db *sql.DB) (trans, error) {
-	tx, err := db.BeginTx(withCorba(context.Background()), nil)
+// the transaction is rolled back by database/sql if ctx is done before committing,
+// and rolled back here if failed to begin, otherwise the connection is held until ctx is done.
+func beginAliyun(ctx context.Context, db *sql.DB, slowThreshold time.Duration) (trans, error) {
+	tx, err := db.BeginTx(withCorba(ctx), nil)
 	if err != nil {
 		return nil, err
 	}
 
 	logx.Infof("Transaction(%p): %s", tx, disableAutoCommit)
-	if _, err := tx.Exec(disableAutoCommit); err != nil {
+	if _, err := tx.ExecContext(ctx, disableAutoCommit); err != nil {
+		rollbackOnBegin(tx)
 		return nil, err
 	}
 
 	logx.Infof("Transaction(%p): %s", tx, registerGlobalTrans)
-	if _, err := tx.Exec(registerGlobalTrans); err != nil {
+	if _, err := tx.ExecContext(ctx, registerGlobalTrans); err != nil {
+		rollbackOnBegin(tx)
 		return nil, err
 	}
 
 	return &aliyunTx{
 		txSession: txSession{
-			tx: tx,
+			tx:            tx,
+			slowThreshold: slowThreshold,
 		},
 	}, nil
 }
 
-func beginStd(db *sql.DB) (trans, error) {
-	if tx, err := db.Begin(); err != nil {
+func beginStd(ctx context.Context, db *sql.DB, slowThreshold time.Duration) (trans, error) {
+	if tx, err := db.BeginTx(ctx, nil); err != nil {
 		return nil, err
 	} else {
 		return &stdTrans{
 			txSession: txSession{
-				tx: tx,
+				tx:            tx,
+				slowThreshold: slowThreshold,
 			},
 		}, nil
 	}
 }
 
+func rollbackOnBegin(tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil {
+		logx.Errorf("Transaction(%p): rollback on begin failed: %s", tx, err)
+	}
+}
+
 func endAliyun(tx *sql.Tx, cmd string) (err error) {
 	defer func() {
 		logx.Infof("Transaction(%p): %s", tx, enableAutoCommit)
@@ -160,19 +193,21 @@ func withCorba(ctx context.Context) context.Context {
 	return context.WithValue(ctx, corbaSql, true)
 }
 
-func transact(db *commonSqlConn, b beginnable, fn func(Session) error) (err error) {
+func transact(ctx context.Context, db *commonSqlConn, b beginnable,
+	fn func(context.Context, Session) error) (err error) {
 	conn, err := getSqlConn(db.driverName, db.datasource)
 	if err != nil {
 		logInstanceError(db.datasource, err)
 		return err
 	}
 
-	return transactOnConn(conn, b, fn)
+	return transactOnConn(ctx, conn, db.slowThreshold, b, fn)
 }
 
-func transactOnConn(conn *sql.DB, b beginnable, fn func(Session) error) (err error) {
+func transactOnConn(ctx context.Context, conn *sql.DB, slowThreshold time.Duration, b beginnable,
+	fn func(context.Context, Session) error) (err error) {
 	var tx trans
-	tx, err = b(conn)
+	tx, err = b(ctx, conn, slowThreshold)
 	if err != nil {
 		return
 	}
@@ -187,5 +222,5 @@ func transactOnConn(conn *sql.DB, b beginnable, fn func(Session) error) (err err
 		}
 	}()
 
-	return fn(tx)
+	return fn(ctx, tx)
 }
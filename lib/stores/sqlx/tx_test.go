@@ -1,9 +1,13 @@
 package sqlx
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,32 +30,48 @@ func (mt *mockTx) Exec(q string, args ...interface{}) (sql.Result, error) {
 	return nil, nil
 }
 
+func (mt *mockTx) ExecCtx(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
 func (mt *mockTx) Prepare(query string) (StmtSession, error) {
 	return nil, nil
 }
 
+func (mt *mockTx) PrepareCtx(ctx context.Context, query string) (StmtSession, error) {
+	return nil, nil
+}
+
 func (mt *mockTx) QueryRow(v interface{}, q string, args ...interface{}) error {
 	return nil
 }
 
+func (mt *mockTx) QueryRowCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	return nil
+}
+
 func (mt *mockTx) QueryRows(v interface{}, q string, args ...interface{}) error {
 	return nil
 }
 
+func (mt *mockTx) QueryRowsCtx(ctx context.Context, v interface{}, q string, args ...interface{}) error {
+	return nil
+}
+
 func (mt *mockTx) Rollback() error {
 	mt.status |= mockRollback
 	return nil
 }
 
 func beginMock(mock *mockTx) beginnable {
-	return func(*sql.DB) (trans, error) {
+	return func(context.Context, *sql.DB, time.Duration) (trans, error) {
 		return mock, nil
 	}
 }
 
 func TestTransactCommit(t *testing.T) {
 	mock := &mockTx{}
-	err := transactOnConn(nil, beginMock(mock), func(Session) error {
+	err := transactOnConn(context.Background(), nil, 0, beginMock(mock), func(context.Context, Session) error {
 		return nil
 	})
 	assert.Equal(t, mockCommit, mock.status)
@@ -60,9 +80,95 @@ func TestTransactCommit(t *testing.T) {
 
 func TestTransactRollback(t *testing.T) {
 	mock := &mockTx{}
-	err := transactOnConn(nil, beginMock(mock), func(Session) error {
+	err := transactOnConn(context.Background(), nil, 0, beginMock(mock), func(context.Context, Session) error {
 		return errors.New("rollback")
 	})
 	assert.Equal(t, mockRollback, mock.status)
 	assert.NotNil(t, err)
 }
+
+func TestTransactPassesContext(t *testing.T) {
+	type ctxKey struct{}
+	mock := &mockTx{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	err := transactOnConn(ctx, nil, 0, beginMock(mock), func(ctx context.Context, _ Session) error {
+		assert.Equal(t, "value", ctx.Value(ctxKey{}))
+		return nil
+	})
+	assert.Equal(t, mockCommit, mock.status)
+	assert.Nil(t, err)
+}
+
+func TestTransactSlowThreshold(t *testing.T) {
+	conn := NewMysql("foo", WithSlowThreshold(time.Second)).(*commonSqlConn)
+	assert.Equal(t, time.Second, conn.slowThreshold)
+
+	var threshold time.Duration
+	err := transactOnConn(context.Background(), nil, conn.slowThreshold,
+		func(_ context.Context, _ *sql.DB, slowThreshold time.Duration) (trans, error) {
+			threshold = slowThreshold
+			return &mockTx{}, nil
+		}, func(context.Context, Session) error {
+			return nil
+		})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, threshold)
+}
+
+type (
+	failingExecDriver struct {
+		rollbacks int32
+	}
+
+	failingExecConn struct {
+		driver *failingExecDriver
+	}
+
+	failingExecTx struct {
+		driver *failingExecDriver
+	}
+)
+
+func (d *failingExecDriver) Open(name string) (driver.Conn, error) {
+	return failingExecConn{driver: d}, nil
+}
+
+func (c failingExecConn) Begin() (driver.Tx, error) {
+	return failingExecTx{driver: c.driver}, nil
+}
+
+func (c failingExecConn) Close() error {
+	return nil
+}
+
+func (c failingExecConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (
+	driver.Result, error) {
+	return nil, errors.New("exec failed")
+}
+
+func (c failingExecConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (tx failingExecTx) Commit() error {
+	return nil
+}
+
+func (tx failingExecTx) Rollback() error {
+	atomic.AddInt32(&tx.driver.rollbacks, 1)
+	return nil
+}
+
+func TestBeginAliyunRollbackOnFailure(t *testing.T) {
+	d := new(failingExecDriver)
+	sql.Register("failingexec", d)
+	db, err := sql.Open("failingexec", "")
+	assert.Nil(t, err)
+	defer db.Close()
+
+	_, err = beginAliyun(context.Background(), db, 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&d.rollbacks))
+	// the connection is released to be reused
+	assert.Equal(t, 0, db.Stats().InUse)
+}
@@ -2,12 +2,17 @@ package sqlx
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/vsaien/cuter/lib/logx"
 )
 
+// the format of the time literals, which is accepted by the datetime and timestamp columns
+const timeFormat = "2006-01-02 15:04:05.999999"
+
 func Escape(input string) string {
 	var b strings.Builder
 
@@ -53,19 +58,8 @@ func format(query string, args ...interface{}) (string, error) {
 			arg := args[argIndex]
 			argIndex++
 
-			switch v := arg.(type) {
-			case bool:
-				if v {
-					b.WriteByte('1')
-				} else {
-					b.WriteByte('0')
-				}
-			case string:
-				b.WriteByte('\'')
-				b.WriteString(Escape(v))
-				b.WriteByte('\'')
-			default:
-				b.WriteString(fmt.Sprintf("%v", v))
+			if err := writeValue(&b, arg); err != nil {
+				return "", err
 			}
 		} else {
 			b.WriteRune(ch)
@@ -79,6 +73,48 @@ func format(query string, args ...interface{}) (string, error) {
 	return b.String(), nil
 }
 
+// writeValue writes arg as the sql literal, the driver.Valuers are written by their values.
+func writeValue(b *strings.Builder, arg interface{}) error {
+	if valuer, ok := arg.(driver.Valuer); ok {
+		val, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		arg = val
+	}
+
+	switch v := arg.(type) {
+	case nil:
+		b.WriteString("NULL")
+	case bool:
+		if v {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	case string:
+		writeQuoted(b, v)
+	case []byte:
+		if v == nil {
+			b.WriteString("NULL")
+		} else {
+			writeQuoted(b, string(v))
+		}
+	case time.Time:
+		writeQuoted(b, v.Format(timeFormat))
+	default:
+		b.WriteString(fmt.Sprintf("%v", v))
+	}
+
+	return nil
+}
+
+func writeQuoted(b *strings.Builder, s string) {
+	b.WriteByte('\'')
+	b.WriteString(Escape(s))
+	b.WriteByte('\'')
+}
+
 func logInstanceError(datasource string, err error) {
 	logx.Errorf("Error on getting sql instance of %s: %v", datasource, err)
 }
@@ -1,7 +1,9 @@
 package sqlx
 
 import (
+	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,3 +15,16 @@ func TestEscape(t *testing.T) {
 
 	assert.Equal(t, `a\x00\n\r\\\'\"\x1ab`, out)
 }
+
+func TestFormatNull(t *testing.T) {
+	out, err := format("insert into users (name, age) values (?, ?)", "foo", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "insert into users (name, age) values ('foo', NULL)", out)
+}
+
+func TestFormatValues(t *testing.T) {
+	out, err := format("select ?, ?, ?, ?, ?", time.Date(2026, 10, 17, 18, 0, 0, 1000, time.UTC),
+		[]byte("it's"), []byte(nil), sql.NullInt64{Int64: 3, Valid: true}, sql.NullString{})
+	assert.Nil(t, err)
+	assert.Equal(t, `select '2026-10-17 18:00:00.000001', 'it\'s', NULL, 3, NULL`, out)
+}
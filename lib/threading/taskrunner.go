@@ -0,0 +1,40 @@
+package threading
+
+import (
+	"sync"
+
+	"github.com/vsaien/cuter/lib/syncx"
+)
+
+// TaskRunner runs the tasks on the goroutines, no more than the given concurrency at the same time.
+type TaskRunner struct {
+	limit     syncx.Limit
+	waitGroup sync.WaitGroup
+}
+
+func NewTaskRunner(concurrency int) *TaskRunner {
+	return &TaskRunner{
+		limit: syncx.NewLimit(concurrency),
+	}
+}
+
+// Schedule runs task on a goroutine, blocks until the number of the running tasks below the concurrency.
+// The panics of task are recovered and logged.
+func (tr *TaskRunner) Schedule(task func()) {
+	tr.limit.Borrow()
+	tr.waitGroup.Add(1)
+
+	GoSafe(func() {
+		defer func() {
+			tr.limit.Return()
+			tr.waitGroup.Done()
+		}()
+
+		task()
+	})
+}
+
+// Wait waits for the scheduled tasks to be done.
+func (tr *TaskRunner) Wait() {
+	tr.waitGroup.Wait()
+}
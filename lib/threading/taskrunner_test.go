@@ -0,0 +1,36 @@
+package threading
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskRunner(t *testing.T) {
+	const concurrency = 3
+	times := 100
+	runner := NewTaskRunner(concurrency)
+
+	var counter, running, maxRunning int32
+	for i := 0; i < times; i++ {
+		runner.Schedule(func() {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+					break
+				}
+			}
+			atomic.AddInt32(&counter, 1)
+			atomic.AddInt32(&running, -1)
+		})
+	}
+	runner.Schedule(func() {
+		panic("any")
+	})
+
+	runner.Wait()
+	assert.Equal(t, times, int(counter))
+	assert.True(t, maxRunning <= concurrency)
+}
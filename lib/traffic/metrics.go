@@ -3,6 +3,7 @@ package traffic
 import (
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/vsaien/cuter/lib/executors"
@@ -26,6 +27,7 @@ type (
 		Timestamp     int64   `json:"tm"`
 		Pid           int     `json:"pid"`
 		ReqsPerSecond float32 `json:"tps"`
+		Drops         int     `json:"drops"`
 		Average       float32 `json:"avg"`
 		Median        float32 `json:"med"`
 		Top90th       float32 `json:"t90"`
@@ -34,8 +36,11 @@ type (
 	}
 
 	Metrics struct {
-		executor  *executors.PeriodicalExecutor
-		container *metricsContainer
+		executor      *executors.PeriodicalExecutor
+		container     *metricsContainer
+		flying        int64
+		listeners     []func(task Task)
+		listenersLock sync.RWMutex
 	}
 )
 
@@ -59,6 +64,46 @@ func NewMetrics(name string) *Metrics {
 
 func (m *Metrics) Add(task Task) {
 	m.executor.Add(task)
+
+	m.listenersLock.RLock()
+	defer m.listenersLock.RUnlock()
+	for _, listener := range m.listeners {
+		listener(task)
+	}
+}
+
+// AddListener adds listener to be called on the tasks added, it's called synchronously,
+// so it should be fast, like the shedders that measure the latencies.
+func (m *Metrics) AddListener(listener func(task Task)) {
+	m.listenersLock.Lock()
+	m.listeners = append(m.listeners, listener)
+	m.listenersLock.Unlock()
+}
+
+// Start counts a request on the fly, Done should be called when it's done.
+func (m *Metrics) Start() {
+	atomic.AddInt64(&m.flying, 1)
+}
+
+// Done adds the task of a request started by Start.
+func (m *Metrics) Done(task Task) {
+	atomic.AddInt64(&m.flying, -1)
+	m.Add(task)
+}
+
+// Flying returns the number of the requests started but not done.
+func (m *Metrics) Flying() int64 {
+	return atomic.LoadInt64(&m.flying)
+}
+
+// AddDrop counts a dropped request, like the ones rejected on load shedding.
+func (m *Metrics) AddDrop() {
+	m.executor.Add(dropTask{})
+}
+
+// Flush reports the collected tasks immediately, instead of waiting for the next interval.
+func (m *Metrics) Flush() {
+	m.executor.ForceFlush()
 }
 
 func (m *Metrics) SetName(name string) {
@@ -68,9 +113,13 @@ func (m *Metrics) SetName(name string) {
 }
 
 type (
+	// the dropped requests are only counted
+	dropTask struct{}
+
 	tasksDurationPair struct {
 		tasks    []Task
 		duration time.Duration
+		drops    int
 	}
 
 	metricsContainer struct {
@@ -78,13 +127,17 @@ type (
 		pid      int
 		tasks    []Task
 		duration time.Duration
+		drops    int
 	}
 )
 
 func (c *metricsContainer) AddTask(v interface{}) bool {
-	if task, ok := v.(Task); ok {
+	switch task := v.(type) {
+	case Task:
 		c.tasks = append(c.tasks, task)
 		c.duration += task.Duration
+	case dropTask:
+		c.drops++
 	}
 
 	return false
@@ -100,6 +153,7 @@ func (c *metricsContainer) Execute(v interface{}) {
 		Timestamp:     time.Now().Unix(),
 		Pid:           c.pid,
 		ReqsPerSecond: float32(size) / float32(LogInterval/time.Second),
+		Drops:         pair.drops,
 	}
 
 	if size > 0 {
@@ -154,12 +208,15 @@ func (c *metricsContainer) Execute(v interface{}) {
 func (c *metricsContainer) RemoveAll() interface{} {
 	tasks := c.tasks
 	duration := c.duration
+	drops := c.drops
 	c.tasks = nil
 	c.duration = 0
+	c.drops = 0
 
 	return tasksDurationPair{
 		tasks:    tasks,
 		duration: duration,
+		drops:    drops,
 	}
 }
 
@@ -174,9 +231,9 @@ func getTopDuration(tasks []Task) float32 {
 
 func log(report *Report) {
 	writeReport(report)
-	logx.Statf("(%s) - tps: %.1f/s, avg time: %.1fms, med: %1fms, 90th: %.1fms, 99th: %.1fms, 99.9th: %.1fms",
-		report.Name, report.ReqsPerSecond, report.Average, report.Median, report.Top90th,
-		report.Top99th, report.Top99p9th)
+	logx.Statf("(%s) - tps: %.1f/s, drops: %d, avg time: %.1fms, med: %1fms, 90th: %.1fms, 99th: %.1fms, "+
+		"99.9th: %.1fms", report.Name, report.ReqsPerSecond, report.Drops, report.Average, report.Median,
+		report.Top90th, report.Top99th, report.Top99p9th)
 }
 
 func writeReport(report *Report) {
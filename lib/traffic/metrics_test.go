@@ -0,0 +1,25 @@
+package traffic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsFlying(t *testing.T) {
+	metrics := NewMetrics("flying")
+	var tasks []Task
+	metrics.AddListener(func(task Task) {
+		tasks = append(tasks, task)
+	})
+
+	metrics.Start()
+	metrics.Start()
+	assert.Equal(t, int64(2), metrics.Flying())
+	metrics.Done(Task{Duration: time.Millisecond})
+	assert.Equal(t, int64(1), metrics.Flying())
+	metrics.Add(Task{Duration: time.Second})
+	assert.Equal(t, int64(1), metrics.Flying())
+	assert.Equal(t, []Task{{Duration: time.Millisecond}, {Duration: time.Second}}, tasks)
+}
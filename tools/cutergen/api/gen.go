@@ -0,0 +1,189 @@
+package api
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vsaien/cuter/tools/cutergen/util"
+)
+
+// the packages can be used in the fields of the types, like time.Time
+var typeImports = map[string]string{
+	"json": "encoding/json",
+	"sql":  "database/sql",
+	"time": "time",
+}
+
+var qualifiedPattern = regexp.MustCompile(`\b([a-z]\w*)\.[A-Z]`)
+
+type (
+	Options struct {
+		// the import path of the output dir, looked up by the go.mod of the dir or its parents if empty
+		ImportPath string
+	}
+
+	serviceData struct {
+		ImportPath string
+		Service    string
+		Type       string
+		Var        string
+		File       string
+		Imports    []string
+		Types      []Type
+		Routes     []routeData
+	}
+
+	routeData struct {
+		Route
+		MethodConst string
+	}
+
+	routeFileData struct {
+		serviceData
+		Route Route
+	}
+)
+
+// GenerateFromFile generates the api service of the definition file into dir.
+func GenerateFromFile(apiFile, dir string, opts Options) error {
+	content, err := ioutil.ReadFile(apiFile)
+	if err != nil {
+		return err
+	}
+
+	spec, err := ParseSpec(string(content))
+	if err != nil {
+		return err
+	}
+
+	return Generate(spec, dir, opts)
+}
+
+// Generate generates the api service of spec into dir, the files with the logic are only
+// generated if absent, so that the code of the users is kept on regeneration.
+func Generate(spec Spec, dir string, opts Options) error {
+	importPath := opts.ImportPath
+	if len(importPath) == 0 {
+		path, err := util.ImportPath(dir)
+		if err != nil {
+			return err
+		}
+		importPath = path
+	}
+
+	files, err := generateFiles(spec, importPath)
+	if err != nil {
+		return err
+	}
+
+	return util.WriteFiles(dir, files)
+}
+
+func generateFiles(spec Spec, importPath string) ([]util.File, error) {
+	data := buildServiceData(spec, importPath)
+	sources := []struct {
+		path      string
+		text      string
+		overwrite bool
+	}{
+		{path: filepath.Join("cmd", "api", data.File+"-api.go"), text: mainTemplate},
+		{path: filepath.Join("cmd", "api", "config", "config.go"), text: configTemplate},
+		{path: filepath.Join("handler", "handler.go"), text: handlerTemplate},
+		{path: filepath.Join("handler", "routes.go"), text: routesTemplate, overwrite: true},
+		{path: filepath.Join("logic", "logic.go"), text: logicTemplate},
+		{path: filepath.Join("logic", "types.go"), text: typesTemplate, overwrite: true},
+	}
+
+	var files []util.File
+	for _, src := range sources {
+		content, err := util.FormatTemplate(src.path, src.text, data)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, util.File{
+			Path:      src.path,
+			Content:   content,
+			Overwrite: src.overwrite,
+		})
+	}
+
+	conf, err := util.ExecuteTemplate("config", configJsonTemplate, data)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, util.File{
+		Path:    filepath.Join("cmd", "api", "config", data.File+".json"),
+		Content: conf,
+	})
+
+	for _, route := range spec.Routes {
+		fileData := routeFileData{
+			serviceData: data,
+			Route:       route,
+		}
+		name := strings.ToLower(route.Handler)
+
+		handler, err := util.FormatTemplate(route.Handler, routeHandlerTemplate, fileData)
+		if err != nil {
+			return nil, err
+		}
+
+		logic, err := util.FormatTemplate(route.Handler, routeLogicTemplate, fileData)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, util.File{
+			Path:    filepath.Join("handler", name+"handler.go"),
+			Content: handler,
+		}, util.File{
+			Path:    filepath.Join("logic", name+"logic.go"),
+			Content: logic,
+		})
+	}
+
+	return files, nil
+}
+
+func buildServiceData(spec Spec, importPath string) serviceData {
+	data := serviceData{
+		ImportPath: importPath,
+		Service:    spec.Service,
+		Type:       util.Title(spec.Service),
+		Var:        util.Untitle(spec.Service),
+		File:       util.Lower(spec.Service),
+		Types:      spec.Types,
+	}
+
+	imports := make(map[string]bool)
+	for _, typ := range spec.Types {
+		for _, field := range typ.Fields {
+			// the tags might contain dots, like json:"a.b"
+			if tag := strings.IndexByte(field, '`'); tag >= 0 {
+				field = field[:tag]
+			}
+			for _, match := range qualifiedPattern.FindAllStringSubmatch(field, -1) {
+				if pkg, ok := typeImports[match[1]]; ok {
+					imports[pkg] = true
+				}
+			}
+		}
+	}
+	for pkg := range imports {
+		data.Imports = append(data.Imports, pkg)
+	}
+	sort.Strings(data.Imports)
+
+	for _, route := range spec.Routes {
+		data.Routes = append(data.Routes, routeData{
+			Route:       route,
+			MethodConst: "http.Method" + util.Title(strings.ToLower(route.Method)),
+		})
+	}
+
+	return data
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testImportPath = "example.com/bookstore"
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	spec := mustParseTestSpec(t)
+	files, err := generateFiles(spec, testImportPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 15, len(files))
+
+	for _, f := range files {
+		t.Run(f.Path, func(t *testing.T) {
+			golden := filepath.Join("testdata", "bookstore", f.Path+".golden")
+			if *update {
+				assert.Nil(t, os.MkdirAll(filepath.Dir(golden), os.ModePerm))
+				assert.Nil(t, ioutil.WriteFile(golden, f.Content, 0644))
+			}
+
+			expect, err := ioutil.ReadFile(golden)
+			assert.Nil(t, err)
+			assert.Equal(t, string(expect), string(f.Content))
+		})
+	}
+}
+
+func TestGenerateKeepsLogic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cutergen")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	spec := mustParseTestSpec(t)
+	opts := Options{
+		ImportPath: testImportPath,
+	}
+	assert.Nil(t, Generate(spec, dir, opts))
+
+	logic := filepath.Join(dir, "logic", "addlogic.go")
+	routes := filepath.Join(dir, "handler", "routes.go")
+	assert.Nil(t, ioutil.WriteFile(logic, []byte("package logic\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(routes, []byte("package handler\n"), 0644))
+
+	assert.Nil(t, Generate(spec, dir, opts))
+	content, err := ioutil.ReadFile(logic)
+	assert.Nil(t, err)
+	assert.Equal(t, "package logic\n", string(content))
+	content, err = ioutil.ReadFile(routes)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "func RegisterHandlers(")
+}
+
+func mustParseTestSpec(t *testing.T) Spec {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "bookstore.api"))
+	assert.Nil(t, err)
+	spec, err := ParseSpec(string(content))
+	assert.Nil(t, err)
+	return spec
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrNoService = errors.New("no service defined")
+
+	// like post /users/:id (UpdateRequest) returns (UpdateResponse)
+	routePattern = regexp.MustCompile(`^(\w+)\s+(/\S*)(?:\s+\((\w+)\))?(?:\s+returns\s+\((\w+)\))?$`)
+	namePattern  = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+	methods      = map[string]string{
+		"get":     http.MethodGet,
+		"head":    http.MethodHead,
+		"post":    http.MethodPost,
+		"put":     http.MethodPut,
+		"patch":   http.MethodPatch,
+		"delete":  http.MethodDelete,
+		"options": http.MethodOptions,
+	}
+)
+
+type (
+	// Spec is the api definition, like:
+	//
+	//	type CreateRequest {
+	//		Name string `json:"name"`
+	//	}
+	//
+	//	service user {
+	//		@handler Create
+	//		post /users (CreateRequest) returns (CreateResponse)
+	//	}
+	Spec struct {
+		Service string
+		Types   []Type
+		Routes  []Route
+	}
+
+	// Type is a struct type, the fields are kept as written, like Name string `json:"name"`.
+	Type struct {
+		Name   string
+		Fields []string
+	}
+
+	Route struct {
+		// the http method, like POST
+		Method   string
+		Path     string
+		Handler  string
+		Request  string
+		Response string
+	}
+)
+
+// ParseSpec parses the api definition.
+func ParseSpec(content string) (Spec, error) {
+	var spec Spec
+	var typ *Type
+	var handler string
+	inService := false
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "//") {
+			continue
+		}
+
+		switch {
+		case typ != nil:
+			if text == "}" {
+				spec.Types = append(spec.Types, *typ)
+				typ = nil
+			} else {
+				typ.Fields = append(typ.Fields, text)
+			}
+		case inService:
+			if text == "}" {
+				if len(handler) > 0 {
+					return Spec{}, fmt.Errorf("line %d: @handler %s without route", line, handler)
+				}
+				inService = false
+			} else if strings.HasPrefix(text, "@handler") {
+				fields := strings.Fields(text)
+				if len(fields) != 2 || !namePattern.MatchString(fields[1]) {
+					return Spec{}, fmt.Errorf("line %d: bad handler %q", line, text)
+				}
+				handler = fields[1]
+			} else {
+				route, err := parseRoute(text, handler)
+				if err != nil {
+					return Spec{}, fmt.Errorf("line %d: %v", line, err)
+				}
+				spec.Routes = append(spec.Routes, route)
+				handler = ""
+			}
+		case strings.HasPrefix(text, "type "):
+			name, err := parseBlock(text, "type")
+			if err != nil {
+				return Spec{}, fmt.Errorf("line %d: %v", line, err)
+			}
+			typ = &Type{Name: name}
+		case strings.HasPrefix(text, "service "):
+			if len(spec.Service) > 0 {
+				return Spec{}, fmt.Errorf("line %d: only one service is allowed", line)
+			}
+			name, err := parseBlock(text, "service")
+			if err != nil {
+				return Spec{}, fmt.Errorf("line %d: %v", line, err)
+			}
+			spec.Service = name
+			inService = true
+		default:
+			return Spec{}, fmt.Errorf("line %d: unexpected %q", line, text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Spec{}, err
+	}
+
+	if typ != nil || inService {
+		return Spec{}, errors.New("unexpected end of file, missing }")
+	}
+	if len(spec.Service) == 0 {
+		return Spec{}, ErrNoService
+	}
+
+	return spec, spec.validate()
+}
+
+func (s Spec) validate() error {
+	types := make(map[string]bool)
+	for _, typ := range s.Types {
+		if types[typ.Name] {
+			return fmt.Errorf("duplicated type %s", typ.Name)
+		}
+		types[typ.Name] = true
+	}
+
+	handlers := make(map[string]bool)
+	routes := make(map[string]bool)
+	for _, route := range s.Routes {
+		if handlers[route.Handler] {
+			return fmt.Errorf("duplicated handler %s", route.Handler)
+		}
+		handlers[route.Handler] = true
+
+		key := route.Method + " " + route.Path
+		if routes[key] {
+			return fmt.Errorf("duplicated route %s", key)
+		}
+		routes[key] = true
+
+		for _, name := range []string{route.Request, route.Response} {
+			if len(name) > 0 && !types[name] {
+				return fmt.Errorf("handler %s: undefined type %s", route.Handler, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseBlock parses the block starts like type Name { or service name {, returns the name.
+func parseBlock(text, keyword string) (string, error) {
+	fields := strings.Fields(text)
+	// type Name struct {
+	if keyword == "type" && len(fields) == 4 && fields[2] == "struct" {
+		fields = append(fields[:2], fields[3])
+	}
+	if len(fields) != 3 || fields[2] != "{" || !namePattern.MatchString(fields[1]) {
+		return "", fmt.Errorf("bad %s definition %q", keyword, text)
+	}
+
+	return fields[1], nil
+}
+
+func parseRoute(text, handler string) (Route, error) {
+	if len(handler) == 0 {
+		return Route{}, fmt.Errorf("missing @handler for %q", text)
+	}
+
+	matches := routePattern.FindStringSubmatch(text)
+	if matches == nil {
+		return Route{}, fmt.Errorf("bad route %q", text)
+	}
+
+	method, ok := methods[strings.ToLower(matches[1])]
+	if !ok {
+		return Route{}, fmt.Errorf("unknown method %s", matches[1])
+	}
+
+	return Route{
+		Method:   method,
+		Path:     matches[2],
+		Handler:  handler,
+		Request:  matches[3],
+		Response: matches[4],
+	}, nil
+}
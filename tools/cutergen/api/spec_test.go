@@ -0,0 +1,129 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSpec(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/bookstore.api")
+	assert.Nil(t, err)
+
+	spec, err := ParseSpec(string(content))
+	assert.Nil(t, err)
+	assert.Equal(t, "bookstore", spec.Service)
+	assert.Equal(t, 5, len(spec.Types))
+	assert.Equal(t, Type{
+		Name: "AddRequest",
+		Fields: []string{
+			"Book  string `json:\"book\"`",
+			"Price int64  `json:\"price\"`",
+		},
+	}, spec.Types[0])
+	assert.Equal(t, "CheckResponse", spec.Types[3].Name)
+	assert.Equal(t, []Route{
+		{
+			Method:   http.MethodPost,
+			Path:     "/books",
+			Handler:  "Add",
+			Request:  "AddRequest",
+			Response: "AddResponse",
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/books/check",
+			Handler:  "Check",
+			Request:  "CheckRequest",
+			Response: "CheckResponse",
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/books/:book",
+			Handler: "Remove",
+			Request: "RemoveRequest",
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/ping",
+			Handler: "Ping",
+		},
+	}, spec.Routes)
+}
+
+func TestParseSpecErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{
+			name: "no service",
+			spec: "type A {\n}",
+		},
+		{
+			name: "two services",
+			spec: "service a {\n}\nservice b {\n}",
+		},
+		{
+			name: "unclosed type",
+			spec: "type A {\nName string",
+		},
+		{
+			name: "unclosed service",
+			spec: "service a {\n@handler A\nget /a",
+		},
+		{
+			name: "bad type",
+			spec: "type A B {\n}",
+		},
+		{
+			name: "unexpected",
+			spec: "func A() {}",
+		},
+		{
+			name: "missing handler",
+			spec: "service a {\nget /a\n}",
+		},
+		{
+			name: "handler without route",
+			spec: "service a {\n@handler A\n}",
+		},
+		{
+			name: "bad handler",
+			spec: "service a {\n@handler a-b\nget /a\n}",
+		},
+		{
+			name: "bad route",
+			spec: "service a {\n@handler A\nget a\n}",
+		},
+		{
+			name: "unknown method",
+			spec: "service a {\n@handler A\nfetch /a\n}",
+		},
+		{
+			name: "undefined type",
+			spec: "service a {\n@handler A\nget /a (ARequest)\n}",
+		},
+		{
+			name: "duplicated type",
+			spec: "type A {\n}\ntype A {\n}\nservice a {\n}",
+		},
+		{
+			name: "duplicated handler",
+			spec: "service a {\n@handler A\nget /a\n@handler A\nget /b\n}",
+		},
+		{
+			name: "duplicated route",
+			spec: "service a {\n@handler A\nget /a\n@handler B\nget /a\n}",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseSpec(test.spec)
+			assert.NotNil(t, err)
+		})
+	}
+}
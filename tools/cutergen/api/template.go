@@ -0,0 +1,166 @@
+package api
+
+const (
+	mainTemplate = `package main
+
+import (
+	"flag"
+	"fmt"
+
+	"{{.ImportPath}}/cmd/api/config"
+	"{{.ImportPath}}/handler"
+	"{{.ImportPath}}/logic"
+	"github.com/vsaien/cuter/lib/cuter"
+)
+
+var configFile = flag.String("f", "cmd/api/config/{{.File}}.json", "the config file")
+
+func main() {
+	flag.Parse()
+
+	var c config.Config
+	cuter.MustLoadConfig(*configFile, &c)
+
+	engine := cuter.MustNewEngine(c.ServerConfig)
+	defer engine.Stop()
+
+	{{.Var}}Logic := logic.New{{.Type}}Logic()
+	handler.RegisterHandlers(engine, handler.New{{.Type}}Handler({{.Var}}Logic))
+
+	fmt.Printf("Starting server at %s:%d...\n", c.Host, c.Port)
+	engine.Start()
+}
+`
+
+	configTemplate = `package config
+
+import "github.com/vsaien/cuter/lib/cuter"
+
+type Config struct {
+	cuter.ServerConfig
+}
+`
+
+	configJsonTemplate = `{
+  "Name": "{{.Service}}-api",
+  "Log": {
+    "Mode": "console"
+  },
+  "Host": "0.0.0.0",
+  "Port": 8888
+}
+`
+
+	routesTemplate = `// Code generated by cutergen. DO NOT EDIT.
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/vsaien/cuter/lib/cuter"
+)
+
+func RegisterHandlers(engine *cuter.Engine, h *{{.Type}}Handler, opts ...cuter.RouteOption) {
+	engine.AddRoutes([]cuter.Route{
+{{- range .Routes}}
+		{
+			Method:  {{.MethodConst}},
+			Path:    "{{.Path}}",
+			Handler: h.{{.Handler}},
+		},
+{{- end}}
+	}, opts...)
+}
+`
+
+	handlerTemplate = `package handler
+
+import "{{.ImportPath}}/logic"
+
+type {{.Type}}Handler struct {
+	{{.Var}}Logic *logic.{{.Type}}Logic
+}
+
+func New{{.Type}}Handler({{.Var}}Logic *logic.{{.Type}}Logic) *{{.Type}}Handler {
+	return &{{.Type}}Handler{
+		{{.Var}}Logic: {{.Var}}Logic,
+	}
+}
+`
+
+	routeHandlerTemplate = `package handler
+{{if or .Route.Request .Route.Response}}
+import (
+	"net/http"
+{{if .Route.Request}}
+	"{{.ImportPath}}/logic"
+{{- end}}
+	"github.com/vsaien/cuter/lib/httpx"
+)
+{{else}}
+import "net/http"
+{{end}}
+func (h *{{.Type}}Handler) {{.Route.Handler}}(w http.ResponseWriter, r *http.Request) {
+{{- if .Route.Request}}
+	var req logic.{{.Route.Request}}
+	if err := httpx.Parse(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+{{end}}
+	{{if .Route.Response}}resp, err{{else}}err{{end}} := h.{{.Var}}Logic.{{.Route.Handler}}({{if .Route.Request}}&req{{end}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+{{if .Route.Response}}	httpx.OkJson(w, resp)
+{{- else}}	w.WriteHeader(http.StatusOK)
+{{- end}}
+}
+`
+
+	logicTemplate = `package logic
+
+type {{.Type}}Logic struct {
+}
+
+func New{{.Type}}Logic() *{{.Type}}Logic {
+	return &{{.Type}}Logic{}
+}
+`
+
+	routeLogicTemplate = `package logic
+
+func (l *{{.Type}}Logic) {{.Route.Handler}}({{if .Route.Request}}req *{{.Route.Request}}{{end}}) {{if .Route.Response}}(*{{.Route.Response}}, error){{else}}error{{end}} {
+	// todo: implement the logic of {{.Route.Handler}}
+{{- if .Route.Response}}
+	return &{{.Route.Response}}{}, nil
+{{- else}}
+	return nil
+{{- end}}
+}
+`
+
+	typesTemplate = `// Code generated by cutergen. DO NOT EDIT.
+
+package logic
+{{if .Imports}}
+import (
+{{range .Imports}}	"{{.}}"
+{{end}})
+{{end}}
+{{- if .Types}}
+type (
+{{- range .Types}}
+	{{.Name}} struct {
+{{- range .Fields}}
+		{{.}}
+{{- end}}
+	}
+{{end -}}
+)
+{{- end}}
+`
+)
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/vsaien/cuter/tools/cutergen/api"
+	"github.com/vsaien/cuter/tools/cutergen/model"
+	"github.com/vsaien/cuter/tools/cutergen/rpc"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"api": {
+		usage: "generate the api service from the api definition file",
+		run:   runApi,
+	},
+	"model": {
+		usage: "generate the models from the mysql ddl file",
+		run:   runModel,
+	},
+	"rpc": {
+		usage: "generate the rpc server and client from the proto file",
+		run:   runRpc,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runApi(args []string) error {
+	fs := flag.NewFlagSet("api", flag.ExitOnError)
+	src := fs.String("src", "", "the api definition file")
+	dir := fs.String("dir", ".", "the service dir, like application/crm/user")
+	importPath := fs.String("import", "", "the import path of the service dir, looked up by go.mod if empty")
+	fs.Parse(args)
+
+	if len(*src) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing -src")
+	}
+
+	return api.GenerateFromFile(*src, *dir, api.Options{
+		ImportPath: *importPath,
+	})
+}
+
+func runModel(args []string) error {
+	fs := flag.NewFlagSet("model", flag.ExitOnError)
+	src := fs.String("src", "", "the mysql ddl file")
+	dir := fs.String("dir", ".", "the output dir")
+	pkg := fs.String("package", "model", "the package name of the generated files")
+	cache := fs.Bool("cache", false, "generate the cache-aside models on sqlc.CachedConn")
+	fs.Parse(args)
+
+	if len(*src) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing -src")
+	}
+
+	return model.GenerateFromFile(*src, *dir, model.Options{
+		Package: *pkg,
+		Cache:   *cache,
+	})
+}
+
+func runRpc(args []string) error {
+	fs := flag.NewFlagSet("rpc", flag.ExitOnError)
+	src := fs.String("src", "", "the proto file")
+	dir := fs.String("dir", ".", "the service dir, like application/crm/user")
+	clientDir := fs.String("client", "", "the dir of the client wrappers, dir/rpcclient if empty")
+	importPath := fs.String("import", "", "the import path of the service dir, looked up by go.mod if empty")
+	fs.Parse(args)
+
+	if len(*src) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing -src")
+	}
+
+	return rpc.GenerateFromFile(*src, *dir, rpc.Options{
+		ImportPath: *importPath,
+		ClientDir:  *clientDir,
+	})
+}
+
+func usage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: cutergen <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].usage)
+	}
+}
@@ -0,0 +1,391 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrNoCreateTable       = errors.New("no create table statement found")
+	ErrNoPrimaryKey        = errors.New("no primary key found")
+	ErrCompositePrimaryKey = errors.New("composite primary key is not supported")
+)
+
+type (
+	Column struct {
+		Name          string
+		DataType      string
+		Unsigned      bool
+		NotNull       bool
+		AutoIncrement bool
+		Default       string
+		HasDefault    bool
+		OnUpdate      string
+		Comment       string
+	}
+
+	Index struct {
+		Name    string
+		Columns []string
+	}
+
+	Table struct {
+		Name       string
+		Columns    []Column
+		PrimaryKey string
+		UniqueKeys []Index
+	}
+
+	token struct {
+		text   string
+		quoted bool
+	}
+)
+
+// ParseDDL parses the tables in the create table statements of mysql.
+func ParseDDL(ddl string) ([]Table, error) {
+	tokens, err := tokenize(ddl)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []Table
+	for i := 0; i < len(tokens); i++ {
+		if !isKeyword(tokens, i, "create") || !isKeyword(tokens, i+1, "table") {
+			continue
+		}
+
+		table, next, err := parseTable(tokens, i+2)
+		if err != nil {
+			return nil, err
+		}
+
+		tables = append(tables, table)
+		i = next
+	}
+
+	if len(tables) == 0 {
+		return nil, ErrNoCreateTable
+	}
+
+	return tables, nil
+}
+
+func (t Table) Column(name string) (Column, bool) {
+	for _, col := range t.Columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+
+	return Column{}, false
+}
+
+func parseTable(tokens []token, i int) (Table, int, error) {
+	if isKeyword(tokens, i, "if") && isKeyword(tokens, i+1, "not") && isKeyword(tokens, i+2, "exists") {
+		i += 3
+	}
+	if i >= len(tokens) {
+		return Table{}, i, ErrNoCreateTable
+	}
+
+	// db.table or table
+	table := Table{
+		Name: tokens[i].text,
+	}
+	i++
+	if i+1 < len(tokens) && tokens[i].text == "." {
+		table.Name = tokens[i+1].text
+		i += 2
+	}
+	if i >= len(tokens) || tokens[i].text != "(" {
+		return Table{}, i, fmt.Errorf("table %s: expect ( after the table name", table.Name)
+	}
+
+	defs, next, err := splitDefinitions(tokens, i+1)
+	if err != nil {
+		return Table{}, next, fmt.Errorf("table %s: %v", table.Name, err)
+	}
+
+	var primaryKeys []string
+	for _, def := range defs {
+		if len(def) == 0 {
+			continue
+		}
+
+		switch {
+		case isKeyword(def, 0, "primary"):
+			primaryKeys = indexColumns(def)
+		case isKeyword(def, 0, "unique"):
+			table.UniqueKeys = append(table.UniqueKeys, parseIndex(def))
+		case isKeyword(def, 0, "constraint"):
+			if unique := indexOfKeyword(def, "unique"); unique >= 0 {
+				index := parseIndex(def[unique:])
+				// the constraint symbol is used as the index name if the index name is omitted
+				if unique == 2 && index.Name == strings.Join(index.Columns, "_") {
+					index.Name = def[1].text
+				}
+				table.UniqueKeys = append(table.UniqueKeys, index)
+			} else if indexOfKeyword(def, "primary") >= 0 {
+				primaryKeys = indexColumns(def)
+			}
+		case isKeyword(def, 0, "key"), isKeyword(def, 0, "index"), isKeyword(def, 0, "fulltext"),
+			isKeyword(def, 0, "spatial"), isKeyword(def, 0, "foreign"), isKeyword(def, 0, "check"):
+			// the other indexes and constraints are not used by the generated models
+		default:
+			col, primary, unique := parseColumn(def)
+			table.Columns = append(table.Columns, col)
+			if primary {
+				primaryKeys = []string{col.Name}
+			}
+			if unique {
+				table.UniqueKeys = append(table.UniqueKeys, Index{
+					Name:    col.Name,
+					Columns: []string{col.Name},
+				})
+			}
+		}
+	}
+
+	switch len(primaryKeys) {
+	case 0:
+		return Table{}, next, fmt.Errorf("table %s: %v", table.Name, ErrNoPrimaryKey)
+	case 1:
+		table.PrimaryKey = primaryKeys[0]
+	default:
+		return Table{}, next, fmt.Errorf("table %s: %v", table.Name, ErrCompositePrimaryKey)
+	}
+
+	if _, ok := table.Column(table.PrimaryKey); !ok {
+		return Table{}, next, fmt.Errorf("table %s: primary key %s not defined", table.Name, table.PrimaryKey)
+	}
+	for _, key := range table.UniqueKeys {
+		for _, name := range key.Columns {
+			if _, ok := table.Column(name); !ok {
+				return Table{}, next, fmt.Errorf("table %s: unique key column %s not defined", table.Name, name)
+			}
+		}
+	}
+
+	return table, next, nil
+}
+
+func parseColumn(def []token) (col Column, primary, unique bool) {
+	col.Name = def[0].text
+	if len(def) > 1 {
+		col.DataType = strings.ToLower(def[1].text)
+	}
+
+	for i := 2; i < len(def); i++ {
+		switch {
+		case def[i].text == "(" && !def[i].quoted:
+			// skip the type arguments, like varchar(255) or decimal(10,2)
+			for i < len(def) && !(def[i].text == ")" && !def[i].quoted) {
+				i++
+			}
+		case isKeyword(def, i, "unsigned"):
+			col.Unsigned = true
+		case isKeyword(def, i, "not") && isKeyword(def, i+1, "null"):
+			col.NotNull = true
+			i++
+		case isKeyword(def, i, "auto_increment"):
+			col.AutoIncrement = true
+		case isKeyword(def, i, "default") && i+1 < len(def):
+			col.HasDefault = true
+			col.Default = def[i+1].text
+			i++
+		case isKeyword(def, i, "on") && isKeyword(def, i+1, "update") && i+2 < len(def):
+			col.OnUpdate = def[i+2].text
+			i += 2
+		case isKeyword(def, i, "comment") && i+1 < len(def):
+			col.Comment = def[i+1].text
+			i++
+		case isKeyword(def, i, "primary") && isKeyword(def, i+1, "key"):
+			primary = true
+			col.NotNull = true
+			i++
+		case isKeyword(def, i, "unique"):
+			unique = true
+			if isKeyword(def, i+1, "key") {
+				i++
+			}
+		}
+	}
+
+	return
+}
+
+// parseIndex parses the unique keys like UNIQUE KEY `name` (`a`, `b`).
+func parseIndex(def []token) Index {
+	var index Index
+	for i := 1; i < len(def); i++ {
+		if def[i].text == "(" && !def[i].quoted {
+			break
+		}
+		if !isKeyword(def, i, "key") && !isKeyword(def, i, "index") {
+			index.Name = def[i].text
+		}
+	}
+	index.Columns = indexColumns(def)
+	if len(index.Name) == 0 {
+		index.Name = strings.Join(index.Columns, "_")
+	}
+
+	return index
+}
+
+// indexColumns returns the columns in the first parentheses, the prefix lengths like `name`(10) are skipped.
+func indexColumns(def []token) []string {
+	var columns []string
+	depth := 0
+	for _, tok := range def {
+		if !tok.quoted {
+			switch tok.text {
+			case "(":
+				depth++
+				continue
+			case ")":
+				depth--
+				if depth == 0 {
+					return columns
+				}
+				continue
+			case ",":
+				continue
+			}
+		}
+
+		if depth == 1 && !isOrder(tok) {
+			columns = append(columns, tok.text)
+		}
+	}
+
+	return columns
+}
+
+// splitDefinitions splits the definitions in the parentheses of create table by the top level commas,
+// returns the index of the closing parenthesis.
+func splitDefinitions(tokens []token, i int) ([][]token, int, error) {
+	var defs [][]token
+	var def []token
+	depth := 0
+	for ; i < len(tokens); i++ {
+		tok := tokens[i]
+		if !tok.quoted {
+			switch tok.text {
+			case "(":
+				depth++
+			case ")":
+				if depth == 0 {
+					return append(defs, def), i, nil
+				}
+				depth--
+			case ",":
+				if depth == 0 {
+					defs = append(defs, def)
+					def = nil
+					continue
+				}
+			}
+		}
+
+		def = append(def, tok)
+	}
+
+	return nil, i, errors.New("unclosed parenthesis")
+}
+
+func tokenize(ddl string) ([]token, error) {
+	var tokens []token
+	runes := []rune(ddl)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case unicode.IsSpace(ch):
+		case ch == '-' && i+1 < len(runes) && runes[i+1] == '-', ch == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case ch == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			j := i + 2
+			for j+1 < len(runes) && !(runes[j] == '*' && runes[j+1] == '/') {
+				j++
+			}
+			if j+1 >= len(runes) {
+				return nil, errors.New("unclosed comment")
+			}
+			i = j + 1
+		case ch == '`' || ch == '\'' || ch == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+					b.WriteRune(runes[j])
+					continue
+				}
+				if runes[j] == ch {
+					// the doubled quotes stand for the quote itself
+					if j+1 < len(runes) && runes[j+1] == ch {
+						b.WriteRune(ch)
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unclosed quote %c", ch)
+			}
+			tokens = append(tokens, token{
+				text:   b.String(),
+				quoted: true,
+			})
+			i = j
+		case ch == '(' || ch == ')' || ch == ',' || ch == ';' || ch == '.' || ch == '=':
+			tokens = append(tokens, token{
+				text: string(ch),
+			})
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("(),;.=`'\"", runes[j]) {
+				j++
+			}
+			// the decimal numbers, like 1.5
+			for j < len(runes) && runes[j] == '.' && j+1 < len(runes) && unicode.IsDigit(runes[j+1]) &&
+				unicode.IsDigit(runes[i]) {
+				j++
+				for j < len(runes) && unicode.IsDigit(runes[j]) {
+					j++
+				}
+			}
+			tokens = append(tokens, token{
+				text: string(runes[i:j]),
+			})
+			i = j - 1
+		}
+	}
+
+	return tokens, nil
+}
+
+func indexOfKeyword(tokens []token, keyword string) int {
+	for i := range tokens {
+		if isKeyword(tokens, i, keyword) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func isKeyword(tokens []token, i int, keyword string) bool {
+	return i < len(tokens) && !tokens[i].quoted && strings.EqualFold(tokens[i].text, keyword)
+}
+
+func isOrder(tok token) bool {
+	return !tok.quoted && (strings.EqualFold(tok.text, "asc") || strings.EqualFold(tok.text, "desc"))
+}
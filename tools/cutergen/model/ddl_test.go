@@ -0,0 +1,119 @@
+package model
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDDL(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/user.sql")
+	assert.Nil(t, err)
+
+	tables, err := ParseDDL(string(content))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tables))
+
+	table := tables[0]
+	assert.Equal(t, "user", table.Name)
+	assert.Equal(t, "id", table.PrimaryKey)
+	assert.Equal(t, 11, len(table.Columns))
+	assert.Equal(t, []Index{
+		{Name: "email_unique", Columns: []string{"email"}},
+		{Name: "mobile_region_unique", Columns: []string{"mobile", "region"}},
+	}, table.UniqueKeys)
+
+	id, ok := table.Column("id")
+	assert.True(t, ok)
+	assert.Equal(t, Column{
+		Name:          "id",
+		DataType:      "bigint",
+		Unsigned:      true,
+		NotNull:       true,
+		AutoIncrement: true,
+	}, id)
+
+	name, ok := table.Column("name")
+	assert.True(t, ok)
+	assert.Equal(t, "varchar", name.DataType)
+	assert.True(t, name.HasDefault)
+	assert.Equal(t, "", name.Default)
+	assert.Equal(t, "the user name", name.Comment)
+
+	updateTime, ok := table.Column("update_time")
+	assert.True(t, ok)
+	assert.Equal(t, "CURRENT_TIMESTAMP", updateTime.Default)
+	assert.Equal(t, "CURRENT_TIMESTAMP", updateTime.OnUpdate)
+
+	balance, ok := table.Column("balance")
+	assert.True(t, ok)
+	assert.Equal(t, "0.00", balance.Default)
+}
+
+func TestParseDDLInlineKeys(t *testing.T) {
+	tables, err := ParseDDL(`
+		/* the accounts */
+		create table if not exists db.account (
+			uid int not null primary key,
+			# the login name
+			name varchar(32) not null unique key,
+			note text
+		);
+		create table tag (id int, label char(8), primary key (id), constraint uk unique (label(4)));`)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tables))
+	assert.Equal(t, "account", tables[0].Name)
+	assert.Equal(t, "uid", tables[0].PrimaryKey)
+	assert.Equal(t, []Index{{Name: "name", Columns: []string{"name"}}}, tables[0].UniqueKeys)
+	assert.Equal(t, "tag", tables[1].Name)
+	assert.Equal(t, "id", tables[1].PrimaryKey)
+	assert.Equal(t, []Index{{Name: "uk", Columns: []string{"label"}}}, tables[1].UniqueKeys)
+}
+
+func TestParseDDLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ddl  string
+	}{
+		{
+			name: "no create table",
+			ddl:  "select 1",
+		},
+		{
+			name: "no primary key",
+			ddl:  "create table a (id int)",
+		},
+		{
+			name: "composite primary key",
+			ddl:  "create table a (id int, b int, primary key (id, b))",
+		},
+		{
+			name: "undefined primary key",
+			ddl:  "create table a (id int, primary key (b))",
+		},
+		{
+			name: "undefined unique key",
+			ddl:  "create table a (id int primary key, unique key (b))",
+		},
+		{
+			name: "unclosed parenthesis",
+			ddl:  "create table a (id int primary key",
+		},
+		{
+			name: "unclosed quote",
+			ddl:  "create table `a (id int primary key)",
+		},
+		{
+			name: "unclosed comment",
+			ddl:  "create table a (id int primary key) /* engine",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseDDL(test.ddl)
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package model
+
+import (
+	"fmt"
+	gotoken "go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vsaien/cuter/tools/cutergen/util"
+)
+
+const (
+	defaultPackage = "model"
+	varsFile       = "vars.go"
+)
+
+// the names used in the generated methods, which can't be used as the parameter names
+var reservedNames = map[string]bool{
+	"conn":    true,
+	"data":    true,
+	"err":     true,
+	"fmt":     true,
+	"m":       true,
+	"mysql":   true,
+	"old":     true,
+	"query":   true,
+	"resp":    true,
+	"sql":     true,
+	"sqlc":    true,
+	"sqlx":    true,
+	"strings": true,
+	"time":    true,
+	"v":       true,
+}
+
+type (
+	Options struct {
+		// the package name of the generated files, model by default
+		Package string
+		// generates the cache-aside models on sqlc.CachedConn if true
+		Cache bool
+	}
+
+	fieldData struct {
+		Name    string
+		Column  string
+		Type    string
+		Comment string
+		Param   string
+	}
+
+	uniqueData struct {
+		Suffix      string
+		Params      string
+		Args        string
+		Cond        string
+		CacheConst  string
+		CachePrefix string
+		KeyFormat   string
+		KeyVar      string
+		DataArgs    string
+		OldArgs     string
+	}
+
+	modelData struct {
+		Package           string
+		Table             string
+		Type              string
+		Var               string
+		Cache             bool
+		StdImports        []string
+		Imports           []string
+		Fields            []fieldData
+		Primary           fieldData
+		PrimaryCacheConst string
+		PrimaryPrefix     string
+		Uniques           []uniqueData
+		Rows              string
+		RowsExceptAutoSet string
+		RowsWithHolder    string
+		InsertHolders     string
+		InsertArgs        string
+		UpdateArgs        string
+	}
+)
+
+// GenerateFromFile generates the models of the tables in the ddl file into dir.
+func GenerateFromFile(ddlFile, dir string, opts Options) error {
+	content, err := ioutil.ReadFile(ddlFile)
+	if err != nil {
+		return err
+	}
+
+	tables, err := ParseDDL(string(content))
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		code, err := Generate(table, opts)
+		if err != nil {
+			return err
+		}
+
+		filename := filepath.Join(dir, util.Lower(table.Name)+"model.go")
+		if err := util.WriteFile(filename, code); err != nil {
+			return err
+		}
+	}
+
+	vars, err := GenerateVars(opts)
+	if err != nil {
+		return err
+	}
+
+	return util.WriteFileIfAbsent(filepath.Join(dir, varsFile), vars)
+}
+
+// Generate returns the formatted model code of table.
+func Generate(table Table, opts Options) ([]byte, error) {
+	data := buildModelData(table, opts)
+	return util.FormatTemplate("model", modelTemplate, data)
+}
+
+// GenerateVars returns the code of the variables shared by the models in the same package.
+func GenerateVars(opts Options) ([]byte, error) {
+	return util.FormatTemplate("vars", varsTemplate, map[string]string{
+		"Package": packageName(opts),
+	})
+}
+
+func buildModelData(table Table, opts Options) modelData {
+	data := modelData{
+		Package: packageName(opts),
+		Table:   table.Name,
+		Type:    util.Title(table.Name),
+		Var:     util.Untitle(table.Name),
+		Cache:   opts.Cache,
+	}
+
+	imports := map[string]bool{
+		"database/sql": true,
+		"fmt":          true,
+		"github.com/vsaien/cuter/lib/stores/sqlx": true,
+	}
+	if opts.Cache {
+		imports["github.com/vsaien/cuter/lib/stores/redis"] = true
+		imports["github.com/vsaien/cuter/lib/stores/sqlc"] = true
+	}
+
+	fields := make(map[string]fieldData)
+	var rows, autoSetRows, holderRows, holders, insertArgs, updateArgs []string
+	for _, col := range table.Columns {
+		typ := mapType(col)
+		if len(typ.pkg) > 0 {
+			imports[typ.pkg] = true
+		}
+
+		field := fieldData{
+			Name:    util.Title(col.Name),
+			Column:  col.Name,
+			Type:    typ.name,
+			Comment: strings.Join(strings.Fields(col.Comment), " "),
+			Param:   paramName(col.Name),
+		}
+		fields[col.Name] = field
+		data.Fields = append(data.Fields, field)
+
+		quoted := quote(col.Name)
+		rows = append(rows, quoted)
+		if isAutoSet(col) {
+			continue
+		}
+
+		autoSetRows = append(autoSetRows, quoted)
+		holders = append(holders, "?")
+		insertArgs = append(insertArgs, "data."+field.Name)
+		if col.Name != table.PrimaryKey {
+			holderRows = append(holderRows, quoted+"=?")
+			updateArgs = append(updateArgs, "data."+field.Name)
+		}
+	}
+
+	data.Primary = fields[table.PrimaryKey]
+	data.PrimaryCacheConst = cacheConst(data.Type, []string{table.PrimaryKey})
+	data.PrimaryPrefix = cachePrefix(table.Name, []string{table.PrimaryKey})
+	data.Rows = strings.Join(rows, ",")
+	data.RowsExceptAutoSet = strings.Join(autoSetRows, ",")
+	data.RowsWithHolder = strings.Join(holderRows, ",")
+	data.InsertHolders = strings.Join(holders, ", ")
+	data.InsertArgs = strings.Join(insertArgs, ", ")
+	data.UpdateArgs = strings.Join(append(updateArgs, "data."+data.Primary.Name), ", ")
+
+	for _, key := range table.UniqueKeys {
+		if len(key.Columns) == 1 && key.Columns[0] == table.PrimaryKey {
+			continue
+		}
+
+		data.Uniques = append(data.Uniques, buildUniqueData(table, key, fields))
+	}
+
+	for pkg := range imports {
+		if strings.Contains(strings.Split(pkg, "/")[0], ".") {
+			data.Imports = append(data.Imports, pkg)
+		} else {
+			data.StdImports = append(data.StdImports, pkg)
+		}
+	}
+	sort.Strings(data.StdImports)
+	sort.Strings(data.Imports)
+
+	return data
+}
+
+func buildUniqueData(table Table, key Index, fields map[string]fieldData) uniqueData {
+	var suffix, params, args, conds, formats, dataArgs, oldArgs []string
+	for _, name := range key.Columns {
+		field := fields[name]
+		suffix = append(suffix, field.Name)
+		params = append(params, field.Param+" "+field.Type)
+		args = append(args, field.Param)
+		conds = append(conds, quote(name)+" = ?")
+		formats = append(formats, "%v")
+		dataArgs = append(dataArgs, "data."+field.Name)
+		oldArgs = append(oldArgs, "old."+field.Name)
+	}
+
+	return uniqueData{
+		Suffix:      strings.Join(suffix, ""),
+		Params:      strings.Join(params, ", "),
+		Args:        strings.Join(args, ", "),
+		Cond:        strings.Join(conds, " and "),
+		CacheConst:  cacheConst(util.Title(table.Name), key.Columns),
+		CachePrefix: cachePrefix(table.Name, key.Columns),
+		KeyFormat:   "%s" + strings.Join(formats, ":"),
+		KeyVar:      util.Untitle(strings.Join(key.Columns, "_")) + "Key",
+		DataArgs:    strings.Join(dataArgs, ", "),
+		OldArgs:     strings.Join(oldArgs, ", "),
+	}
+}
+
+// cacheConst returns the name of the cache key prefix constant, like cacheUserEmailPrefix.
+func cacheConst(typ string, columns []string) string {
+	return fmt.Sprintf("cache%s%sPrefix", typ, util.Title(strings.Join(columns, "_")))
+}
+
+// cachePrefix returns the cache key prefix, like cache#user#email#, the values are appended to it.
+func cachePrefix(table string, columns []string) string {
+	return fmt.Sprintf("cache#%s#%s#", util.Lower(table), strings.Join(columns, ":"))
+}
+
+func packageName(opts Options) string {
+	if len(opts.Package) > 0 {
+		return opts.Package
+	}
+
+	return defaultPackage
+}
+
+func paramName(column string) string {
+	name := util.Untitle(column)
+	if reservedNames[name] || gotoken.Lookup(name).IsKeyword() {
+		return name + "Value"
+	}
+
+	return name
+}
+
+func quote(column string) string {
+	return "`" + column + "`"
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	tests := []struct {
+		ddl    string
+		golden string
+		cache  bool
+	}{
+		{
+			ddl:    "user.sql",
+			golden: "usermodel.golden",
+		},
+		{
+			ddl:    "user.sql",
+			golden: "usermodel_cache.golden",
+			cache:  true,
+		},
+		{
+			ddl:    "article.sql",
+			golden: "articlemodel.golden",
+		},
+		{
+			ddl:    "article.sql",
+			golden: "articlemodel_cache.golden",
+			cache:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.golden, func(t *testing.T) {
+			content, err := ioutil.ReadFile(filepath.Join("testdata", test.ddl))
+			assert.Nil(t, err)
+			tables, err := ParseDDL(string(content))
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(tables))
+
+			code, err := Generate(tables[0], Options{
+				Cache: test.cache,
+			})
+			assert.Nil(t, err)
+
+			golden := filepath.Join("testdata", test.golden)
+			if *update {
+				assert.Nil(t, ioutil.WriteFile(golden, code, 0644))
+			}
+
+			expect, err := ioutil.ReadFile(golden)
+			assert.Nil(t, err)
+			assert.Equal(t, string(expect), string(code))
+		})
+	}
+}
+
+func TestGenerateFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cutergen")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	vars := filepath.Join(dir, varsFile)
+	assert.Nil(t, ioutil.WriteFile(vars, []byte("package users\n"), 0644))
+
+	assert.Nil(t, GenerateFromFile(filepath.Join("testdata", "user.sql"), dir, Options{
+		Package: "users",
+		Cache:   true,
+	}))
+
+	code, err := ioutil.ReadFile(filepath.Join(dir, "usermodel.go"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(code), "package users")
+	assert.Contains(t, string(code), "func (m *UserModel) FindOneByMobileRegion(mobile string, region string)")
+
+	// the vars file is edited by the users, never overwritten
+	content, err := ioutil.ReadFile(vars)
+	assert.Nil(t, err)
+	assert.Equal(t, "package users\n", string(content))
+}
+
+func TestParamName(t *testing.T) {
+	assert.Equal(t, "userId", paramName("user_id"))
+	assert.Equal(t, "typeValue", paramName("type"))
+	assert.Equal(t, "dataValue", paramName("data"))
+}
@@ -0,0 +1,179 @@
+package model
+
+const (
+	varsTemplate = `package {{.Package}}
+
+import "github.com/vsaien/cuter/lib/stores/sqlc"
+
+var ErrNotFound = sqlc.ErrNotFound
+`
+
+	modelTemplate = `// Code generated by cutergen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{range .StdImports}}	"{{.}}"
+{{end}}
+{{range .Imports}}	"{{.}}"
+{{end}})
+
+const (
+	{{.Var}}Rows                = "{{.Rows}}"
+	{{.Var}}RowsExceptAutoSet   = "{{.RowsExceptAutoSet}}"
+	{{.Var}}RowsWithPlaceHolder = "{{.RowsWithHolder}}"
+{{if .Cache}}
+	{{.Var}}CacheSeconds = 7 * 24 * 3600
+	{{.PrimaryCacheConst}} = "{{.PrimaryPrefix}}"
+{{range .Uniques}}	{{.CacheConst}} = "{{.CachePrefix}}"
+{{end}}{{end}})
+
+type (
+	{{.Type}} struct {
+{{range .Fields}}		{{.Name}} {{.Type}} ` + "`db:\"{{.Column}}\"`" + `{{if .Comment}} // {{.Comment}}{{end}}
+{{end}}	}
+
+	{{.Type}}Model struct {
+		conn  {{if .Cache}}sqlc.CachedConn{{else}}sqlx.SqlConn{{end}}
+		table string
+	}
+)
+
+func New{{.Type}}Model(conn sqlx.SqlConn{{if .Cache}}, rds *redis.Redis{{end}}) *{{.Type}}Model {
+	return &{{.Type}}Model{
+		conn:  {{if .Cache}}sqlc.NewCachedConn(conn, rds){{else}}conn{{end}},
+		table: "` + "`{{.Table}}`" + `",
+	}
+}
+
+func (m *{{.Type}}Model) Insert(data {{.Type}}) (sql.Result, error) {
+	query := fmt.Sprintf("insert into %s (%s) values ({{.InsertHolders}})", m.table, {{.Var}}RowsExceptAutoSet)
+{{- if and .Cache .Uniques}}
+	// drop the not found placeholders of the unique keys
+	if err := m.delCache({{range $i, $u := .Uniques}}{{if $i}}, {{end}}fmt.Sprintf("{{$u.KeyFormat}}", {{$u.CacheConst}}, {{$u.DataArgs}}){{end}}); err != nil {
+		return nil, err
+	}
+{{end}}
+	return m.conn.Exec(query, {{.InsertArgs}})
+}
+
+func (m *{{.Type}}Model) FindOne({{.Primary.Param}} {{.Primary.Type}}) (*{{.Type}}, error) {
+{{- if .Cache}}
+	primaryKey := fmt.Sprintf("%s%v", {{.PrimaryCacheConst}}, {{.Primary.Param}})
+	var resp {{.Type}}
+	err := m.conn.QueryRow(&resp, primaryKey, {{.Var}}CacheSeconds, func(conn sqlx.Session, v interface{}) error {
+		query := fmt.Sprintf("select %s from %s where ` + "`{{.Primary.Column}}`" + ` = ? limit 1", {{.Var}}Rows, m.table)
+		return conn.QueryRow(v, query, {{.Primary.Param}})
+	})
+	switch err {
+	case nil:
+		return &resp, nil
+	case sqlc.ErrNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, err
+	}
+{{- else}}
+	query := fmt.Sprintf("select %s from %s where ` + "`{{.Primary.Column}}`" + ` = ? limit 1", {{.Var}}Rows, m.table)
+	var resp {{.Type}}
+	switch err := m.conn.QueryRow(&resp, query, {{.Primary.Param}}); err {
+	case nil:
+		return &resp, nil
+	case sql.ErrNoRows:
+		return nil, ErrNotFound
+	default:
+		return nil, err
+	}
+{{- end}}
+}
+{{range .Uniques}}
+func (m *{{$.Type}}Model) FindOneBy{{.Suffix}}({{.Params}}) (*{{$.Type}}, error) {
+{{- if $.Cache}}
+	{{.KeyVar}} := fmt.Sprintf("{{.KeyFormat}}", {{.CacheConst}}, {{.Args}})
+	var primary {{$.Primary.Type}}
+	err := m.conn.QueryRow(&primary, {{.KeyVar}}, {{$.Var}}CacheSeconds, func(conn sqlx.Session, v interface{}) error {
+		query := fmt.Sprintf("select ` + "`{{$.Primary.Column}}`" + ` from %s where {{.Cond}} limit 1", m.table)
+		return conn.QueryRow(v, query, {{.Args}})
+	})
+	switch err {
+	case nil:
+		return m.FindOne(primary)
+	case sqlc.ErrNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, err
+	}
+{{- else}}
+	query := fmt.Sprintf("select %s from %s where {{.Cond}} limit 1", {{$.Var}}Rows, m.table)
+	var resp {{$.Type}}
+	switch err := m.conn.QueryRow(&resp, query, {{.Args}}); err {
+	case nil:
+		return &resp, nil
+	case sql.ErrNoRows:
+		return nil, ErrNotFound
+	default:
+		return nil, err
+	}
+{{- end}}
+}
+{{end}}
+func (m *{{.Type}}Model) Update(data {{.Type}}) error {
+{{- if .Cache}}
+{{- if .Uniques}}
+	old, err := m.FindOne(data.{{.Primary.Name}})
+	if err != nil {
+		return err
+	}
+
+	if err := m.delCache(fmt.Sprintf("%s%v", {{.PrimaryCacheConst}}, data.{{.Primary.Name}}){{range .Uniques}},
+		fmt.Sprintf("{{.KeyFormat}}", {{.CacheConst}}, {{.OldArgs}}),
+		fmt.Sprintf("{{.KeyFormat}}", {{.CacheConst}}, {{.DataArgs}}){{end}}); err != nil {
+		return err
+	}
+{{- else}}
+	if err := m.delCache(fmt.Sprintf("%s%v", {{.PrimaryCacheConst}}, data.{{.Primary.Name}})); err != nil {
+		return err
+	}
+{{- end}}
+{{end}}
+	query := fmt.Sprintf("update %s set %s where ` + "`{{.Primary.Column}}`" + ` = ?", m.table, {{.Var}}RowsWithPlaceHolder)
+	_, err {{if and .Cache .Uniques}}={{else}}:={{end}} m.conn.Exec(query, {{.UpdateArgs}})
+	return err
+}
+
+func (m *{{.Type}}Model) Delete({{.Primary.Param}} {{.Primary.Type}}) error {
+{{- if .Cache}}
+{{- if .Uniques}}
+	old, err := m.FindOne({{.Primary.Param}})
+	if err != nil {
+		return err
+	}
+
+	if err := m.delCache(fmt.Sprintf("%s%v", {{.PrimaryCacheConst}}, {{.Primary.Param}}){{range .Uniques}},
+		fmt.Sprintf("{{.KeyFormat}}", {{.CacheConst}}, {{.OldArgs}}){{end}}); err != nil {
+		return err
+	}
+{{- else}}
+	if err := m.delCache(fmt.Sprintf("%s%v", {{.PrimaryCacheConst}}, {{.Primary.Param}})); err != nil {
+		return err
+	}
+{{- end}}
+{{end}}
+	query := fmt.Sprintf("delete from %s where ` + "`{{.Primary.Column}}`" + ` = ?", m.table)
+	_, err {{if and .Cache .Uniques}}={{else}}:={{end}} m.conn.Exec(query, {{.Primary.Param}})
+	return err
+}
+{{- if .Cache}}
+
+func (m *{{.Type}}Model) delCache(keys ...string) error {
+	for _, key := range keys {
+		if err := m.conn.DelCache(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+{{- end}}
+`
+)
@@ -0,0 +1,6 @@
+create table if not exists blog.article (
+  article_id int not null primary key auto_increment,
+  title varchar(255) not null,
+  content text not null,
+  created_at datetime not null default now()
+);
@@ -0,0 +1,18 @@
+-- the users
+CREATE TABLE `user` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `name` varchar(64) NOT NULL DEFAULT '' COMMENT 'the user name',
+  `email` varchar(128) NOT NULL DEFAULT '',
+  `mobile` varchar(32) NOT NULL DEFAULT '',
+  `region` varchar(16) NOT NULL DEFAULT '',
+  `nickname` varchar(64) DEFAULT NULL,
+  `type` tinyint(4) NOT NULL DEFAULT 0 COMMENT 'the user type, 0: normal, 1: vip',
+  `balance` decimal(10,2) NOT NULL DEFAULT 0.00,
+  `birthday` date,
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `email_unique` (`email`),
+  UNIQUE KEY `mobile_region_unique` (`mobile`, `region`),
+  KEY `name_index` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
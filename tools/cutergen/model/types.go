@@ -0,0 +1,52 @@
+package model
+
+import "strings"
+
+const timeImport = "time"
+
+type goType struct {
+	name string
+	pkg  string
+}
+
+// mapType maps the mysql data type of col to the go type, the nullable columns without defaults
+// are mapped to the sql.NullXXX types.
+func mapType(col Column) goType {
+	nullable := !col.NotNull && !(col.HasDefault && !strings.EqualFold(col.Default, "null"))
+
+	switch col.DataType {
+	case "bool", "boolean", "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year", "bit":
+		if nullable {
+			return goType{name: "sql.NullInt64", pkg: "database/sql"}
+		}
+		return goType{name: "int64"}
+	case "float", "double", "real", "decimal", "numeric":
+		if nullable {
+			return goType{name: "sql.NullFloat64", pkg: "database/sql"}
+		}
+		return goType{name: "float64"}
+	case "date", "datetime", "timestamp":
+		if nullable {
+			return goType{name: "mysql.NullTime", pkg: "github.com/go-sql-driver/mysql"}
+		}
+		return goType{name: "time.Time", pkg: timeImport}
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return goType{name: "[]byte"}
+	default:
+		// char, varchar, text, enum, set, json, time and the others
+		if nullable {
+			return goType{name: "sql.NullString", pkg: "database/sql"}
+		}
+		return goType{name: "string"}
+	}
+}
+
+// isAutoSet reports whether col is set by mysql, which is not written by the models.
+func isAutoSet(col Column) bool {
+	return col.AutoIncrement || isCurrentTimestamp(col.Default) || isCurrentTimestamp(col.OnUpdate)
+}
+
+func isCurrentTimestamp(value string) bool {
+	value = strings.ToLower(value)
+	return value == "current_timestamp" || value == "now" || value == "localtimestamp"
+}
@@ -0,0 +1,177 @@
+package rpc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/vsaien/cuter/tools/cutergen/util"
+)
+
+const protoDir = "rpcproto"
+
+type (
+	Options struct {
+		// the import path of the output dir, looked up by the go.mod of the dir or its parents if empty
+		ImportPath string
+		// the dir of the client wrappers, dir/rpcclient if empty
+		ClientDir string
+	}
+
+	protoData struct {
+		Proto
+		ImportPath    string
+		Name          string
+		ProtoImport   string
+		ClientPackage string
+	}
+
+	serviceData struct {
+		protoData
+		Service Service
+	}
+)
+
+// GenerateFromFile generates the rpc server and client of the proto file into dir, the proto file
+// is copied into dir/rpcproto, the pb.go files are generated by protoc in it, like:
+//
+//	protoc --go_out=plugins=grpc:. demo.proto
+func GenerateFromFile(protoFile, dir string, opts Options) error {
+	content, err := ioutil.ReadFile(protoFile)
+	if err != nil {
+		return err
+	}
+
+	proto, err := ParseProto(protoFile, string(content))
+	if err != nil {
+		return err
+	}
+
+	name := util.Lower(strings.TrimSuffix(filepath.Base(protoFile), filepath.Ext(protoFile)))
+	if err := Generate(proto, name, dir, opts); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(dir, protoDir, filepath.Base(protoFile))
+	if same, err := sameFile(protoFile, dest); err != nil || same {
+		return err
+	}
+
+	return util.WriteFile(dest, content)
+}
+
+// Generate generates the rpc server and client of proto into dir, name is used to name the files.
+// The rpc servers with the logic are only generated if absent, so that the code of the users is kept
+// on regeneration.
+func Generate(proto Proto, name, dir string, opts Options) error {
+	importPath := opts.ImportPath
+	if len(importPath) == 0 {
+		path, err := util.ImportPath(dir)
+		if err != nil {
+			return err
+		}
+		importPath = path
+	}
+
+	clientDir := opts.ClientDir
+	if len(clientDir) == 0 {
+		clientDir = filepath.Join(dir, "rpcclient")
+	}
+
+	files, clientFiles, err := generateFiles(proto, name, importPath, util.Lower(filepath.Base(clientDir)))
+	if err != nil {
+		return err
+	}
+
+	if err := util.WriteFiles(dir, files); err != nil {
+		return err
+	}
+
+	return util.WriteFiles(clientDir, clientFiles)
+}
+
+func generateFiles(proto Proto, name, importPath, clientPackage string) (files, clientFiles []util.File, err error) {
+	data := protoData{
+		Proto:         proto,
+		ImportPath:    importPath,
+		Name:          name,
+		ClientPackage: clientPackage,
+	}
+	if proto.GoPackage == protoDir {
+		data.ProtoImport = fmt.Sprintf("%q", importPath+"/"+protoDir)
+	} else {
+		data.ProtoImport = fmt.Sprintf("%s %q", proto.GoPackage, importPath+"/"+protoDir)
+	}
+
+	main, err := util.FormatTemplate("main", mainTemplate, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	conf, err := util.FormatTemplate("config", configTemplate, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	confJson, err := util.ExecuteTemplate("config", configJsonTemplate, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	files = append(files, util.File{
+		Path:    filepath.Join("cmd", "rpc", name+"-rpc.go"),
+		Content: main,
+	}, util.File{
+		Path:    filepath.Join("cmd", "rpc", "config", "config.go"),
+		Content: conf,
+	}, util.File{
+		Path:    filepath.Join("cmd", "rpc", "config", name+".json"),
+		Content: confJson,
+	})
+
+	for _, service := range proto.Services {
+		server, err := util.FormatTemplate(service.Name, serverTemplate, serviceData{
+			protoData: data,
+			Service:   service,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		files = append(files, util.File{
+			Path:    filepath.Join("rpcserver", strings.ToLower(service.Name)+"server.go"),
+			Content: server,
+		})
+	}
+
+	client, err := util.FormatTemplate("client", clientTemplate, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientConf, err := util.ExecuteTemplate("client", clientConfigTemplate, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientFiles = append(clientFiles, util.File{
+		Path:      name + "client.go",
+		Content:   client,
+		Overwrite: true,
+	}, util.File{
+		Path:    name + "client.json",
+		Content: clientConf,
+	})
+
+	return files, clientFiles, nil
+}
+
+func sameFile(src, dest string) (bool, error) {
+	srcPath, err := filepath.Abs(src)
+	if err != nil {
+		return false, err
+	}
+
+	destPath, err := filepath.Abs(dest)
+	if err != nil {
+		return false, err
+	}
+
+	return srcPath == destPath, nil
+}
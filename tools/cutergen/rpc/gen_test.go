@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vsaien/cuter/tools/cutergen/util"
+)
+
+const testImportPath = "example.com/greet"
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "greet.proto"))
+	assert.Nil(t, err)
+	proto, err := ParseProto("greet.proto", string(content))
+	assert.Nil(t, err)
+
+	files, clientFiles, err := generateFiles(proto, "greet", testImportPath, "greet")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(files))
+	assert.Equal(t, 2, len(clientFiles))
+
+	check := func(dir string, files []util.File) {
+		for _, f := range files {
+			t.Run(f.Path, func(t *testing.T) {
+				golden := filepath.Join("testdata", dir, f.Path+".golden")
+				if *update {
+					assert.Nil(t, os.MkdirAll(filepath.Dir(golden), os.ModePerm))
+					assert.Nil(t, ioutil.WriteFile(golden, f.Content, 0644))
+				}
+
+				expect, err := ioutil.ReadFile(golden)
+				assert.Nil(t, err)
+				assert.Equal(t, string(expect), string(f.Content))
+			})
+		}
+	}
+	check("greet", files)
+	check("greetclient", clientFiles)
+}
+
+func TestGenerateAliasedProtoPackage(t *testing.T) {
+	proto, err := ParseProto("demo.proto", `
+		package remotedemo;
+		service DemoHandler {
+			rpc demoFuc(DemoRequest) returns (DemoResponse);
+		}`)
+	assert.Nil(t, err)
+
+	files, _, err := generateFiles(proto, "demo", testImportPath, "demo")
+	assert.Nil(t, err)
+	for _, f := range files {
+		if f.Path == filepath.Join("rpcserver", "demohandlerserver.go") {
+			assert.Contains(t, string(f.Content), `remotedemo "example.com/greet/rpcproto"`)
+			assert.Contains(t, string(f.Content), "req *remotedemo.DemoRequest")
+		}
+	}
+}
+
+func TestGenerateFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cutergen")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, GenerateFromFile(filepath.Join("testdata", "greet.proto"), dir, Options{
+		ImportPath: testImportPath,
+	}))
+
+	for _, name := range []string{
+		"rpcproto/greet.proto",
+		"cmd/rpc/greet-rpc.go",
+		"cmd/rpc/config/config.go",
+		"cmd/rpc/config/greet.json",
+		"rpcserver/greeterserver.go",
+		"rpcserver/farewellserviceserver.go",
+		"rpcclient/greetclient.go",
+		"rpcclient/greetclient.json",
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.Nil(t, err, name)
+	}
+
+	// regenerating from the copied proto file keeps it
+	assert.Nil(t, GenerateFromFile(filepath.Join(dir, "rpcproto", "greet.proto"), dir, Options{
+		ImportPath: testImportPath,
+	}))
+	_, err = os.Stat(filepath.Join(dir, "rpcproto", "greet.proto"))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,316 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+var ErrNoService = errors.New("no service defined")
+
+type (
+	Proto struct {
+		// the proto package, like remotedemo
+		Package string
+		// the go package name of the generated pb.go, following the rules of protoc-gen-go
+		GoPackage string
+		Services  []Service
+	}
+
+	Service struct {
+		Name    string
+		Methods []Method
+	}
+
+	Method struct {
+		// the go names, like DemoFuc for demoFuc
+		Name     string
+		Request  string
+		Response string
+	}
+)
+
+// ParseProto parses the services in the proto file content, filename is used to name the go package
+// if neither go_package nor package is declared.
+func ParseProto(filename, content string) (Proto, error) {
+	tokens, err := tokenize(content)
+	if err != nil {
+		return Proto{}, err
+	}
+
+	var proto Proto
+	var goPackage string
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "package":
+			if i+1 >= len(tokens) {
+				return Proto{}, errors.New("missing package name")
+			}
+			proto.Package = tokens[i+1]
+			i++
+		case "option":
+			if i+3 < len(tokens) && tokens[i+1] == "go_package" && tokens[i+2] == "=" {
+				goPackage = unquote(tokens[i+3])
+				i += 3
+			}
+		case "message", "enum", "extend":
+			// the messages are generated by protoc, skip the definitions
+			next, err := skipBlock(tokens, i)
+			if err != nil {
+				return Proto{}, err
+			}
+			i = next
+		case "service":
+			service, next, err := parseService(tokens, i+1, proto.Package)
+			if err != nil {
+				return Proto{}, err
+			}
+			proto.Services = append(proto.Services, service)
+			i = next
+		}
+	}
+
+	if len(proto.Services) == 0 {
+		return Proto{}, ErrNoService
+	}
+
+	proto.GoPackage = goPackageName(filename, proto.Package, goPackage)
+	return proto, nil
+}
+
+func parseService(tokens []string, i int, pkg string) (Service, int, error) {
+	if i+1 >= len(tokens) || tokens[i+1] != "{" {
+		return Service{}, i, errors.New("bad service definition")
+	}
+
+	service := Service{
+		Name: camelCase(tokens[i]),
+	}
+	for i += 2; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "}":
+			return service, i, nil
+		case "rpc":
+			method, next, err := parseMethod(tokens, i+1, pkg)
+			if err != nil {
+				return Service{}, i, fmt.Errorf("service %s: %v", service.Name, err)
+			}
+			service.Methods = append(service.Methods, method)
+			i = next
+		case "option":
+			for i < len(tokens) && tokens[i] != ";" {
+				i++
+			}
+		case ";":
+		default:
+			return Service{}, i, fmt.Errorf("service %s: unexpected %q", service.Name, tokens[i])
+		}
+	}
+
+	return Service{}, i, fmt.Errorf("service %s: missing }", service.Name)
+}
+
+// parseMethod parses the method like demoFuc(DemoRequest) returns (DemoResponse);
+func parseMethod(tokens []string, i int, pkg string) (Method, int, error) {
+	// name ( type ) returns ( type )
+	if i+8 > len(tokens) {
+		return Method{}, i, errors.New("bad rpc definition")
+	}
+
+	name := tokens[i]
+	if tokens[i+2] == "stream" || tokens[i+6] == "stream" {
+		return Method{}, i, fmt.Errorf("rpc %s: streaming is not supported", name)
+	}
+	if tokens[i+1] != "(" || tokens[i+3] != ")" || tokens[i+4] != "returns" ||
+		tokens[i+5] != "(" || tokens[i+7] != ")" {
+		return Method{}, i, fmt.Errorf("rpc %s: bad definition", name)
+	}
+
+	request, err := messageName(tokens[i+2], pkg)
+	if err != nil {
+		return Method{}, i, fmt.Errorf("rpc %s: %v", name, err)
+	}
+	response, err := messageName(tokens[i+6], pkg)
+	if err != nil {
+		return Method{}, i, fmt.Errorf("rpc %s: %v", name, err)
+	}
+
+	i += 8
+	switch {
+	case i < len(tokens) && tokens[i] == ";":
+	case i < len(tokens) && tokens[i] == "{":
+		// the method options
+		next, err := skipBlock(tokens, i)
+		if err != nil {
+			return Method{}, i, err
+		}
+		i = next
+	default:
+		return Method{}, i, fmt.Errorf("rpc %s: missing ;", name)
+	}
+
+	return Method{
+		Name:     camelCase(name),
+		Request:  request,
+		Response: response,
+	}, i, nil
+}
+
+// messageName returns the go name of the message, the nested messages like Outer.Inner are named Outer_Inner.
+func messageName(name, pkg string) (string, error) {
+	name = strings.TrimPrefix(name, ".")
+	if len(pkg) > 0 {
+		name = strings.TrimPrefix(name, pkg+".")
+	}
+
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		// the messages of the other packages start with lower cased package names
+		if len(part) == 0 || (len(parts) > 1 && i == 0 && unicode.IsLower(rune(part[0]))) {
+			return "", fmt.Errorf("message %s of the other packages is not supported", name)
+		}
+		parts[i] = camelCase(part)
+	}
+
+	return strings.Join(parts, "_"), nil
+}
+
+// skipBlock skips the block starts from the keyword at i, returns the index of the closing brace.
+func skipBlock(tokens []string, i int) (int, error) {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+
+	return i, errors.New("unclosed block")
+}
+
+// camelCase converts the proto names to the go names the same as protoc-gen-go.
+func camelCase(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	i := 0
+	if s[0] == '_' {
+		b.WriteByte('X')
+		i++
+	}
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c == '_' && i+1 < len(s) && isLower(s[i+1]) {
+			continue
+		}
+		if isDigit(c) {
+			b.WriteByte(c)
+			continue
+		}
+		if isLower(c) {
+			c ^= ' '
+		}
+		b.WriteByte(c)
+		for i+1 < len(s) && isLower(s[i+1]) {
+			i++
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
+
+func goPackageName(filename, pkg, goPackage string) string {
+	var name string
+	switch {
+	case len(goPackage) > 0:
+		if semicolon := strings.LastIndexByte(goPackage, ';'); semicolon >= 0 {
+			name = goPackage[semicolon+1:]
+		} else {
+			name = goPackage[strings.LastIndexByte(goPackage, '/')+1:]
+		}
+	case len(pkg) > 0:
+		name = pkg
+	default:
+		base := filepath.Base(filename)
+		name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func tokenize(content string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(content); i++ {
+		ch := content[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+		case strings.HasPrefix(content[i:], "//"):
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(content[i:], "/*"):
+			end := strings.Index(content[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unclosed comment")
+			}
+			i += end + 3
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for ; j < len(content) && content[j] != ch; j++ {
+				if content[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(content) {
+				return nil, fmt.Errorf("unclosed quote %c", ch)
+			}
+			tokens = append(tokens, content[i:j+1])
+			i = j
+		case strings.IndexByte("{}()<>[];=,", ch) >= 0:
+			tokens = append(tokens, string(ch))
+		default:
+			j := i
+			for j < len(content) && !strings.ContainsRune(" \t\r\n{}()<>[];=,\"'/", rune(content[j])) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("unexpected %c", ch)
+			}
+			tokens = append(tokens, content[i:j])
+			i = j - 1
+		}
+	}
+
+	return tokens, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isLower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
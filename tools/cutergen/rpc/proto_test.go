@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProto(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/greet.proto")
+	assert.Nil(t, err)
+
+	proto, err := ParseProto("testdata/greet.proto", string(content))
+	assert.Nil(t, err)
+	assert.Equal(t, Proto{
+		Package:   "greet.v1",
+		GoPackage: "rpcproto",
+		Services: []Service{
+			{
+				Name: "Greeter",
+				Methods: []Method{
+					{
+						Name:     "SayHello",
+						Request:  "HelloRequest",
+						Response: "HelloResponse",
+					},
+					{
+						Name:     "SayHelloOptions",
+						Request:  "HelloRequest_Options",
+						Response: "HelloResponse",
+					},
+				},
+			},
+			{
+				Name: "FarewellService",
+				Methods: []Method{
+					{
+						Name:     "Bye",
+						Request:  "HelloRequest",
+						Response: "HelloResponse",
+					},
+				},
+			},
+		},
+	}, proto)
+}
+
+func TestParseProtoErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		proto string
+	}{
+		{
+			name:  "no service",
+			proto: "message A {}",
+		},
+		{
+			name:  "streaming",
+			proto: "service A { rpc B(stream C) returns (C); }",
+		},
+		{
+			name:  "other packages",
+			proto: "service A { rpc B(google.protobuf.Empty) returns (C); }",
+		},
+		{
+			name:  "bad rpc",
+			proto: "service A { rpc B(C) returns C; }",
+		},
+		{
+			name:  "missing semicolon",
+			proto: "service A { rpc B(C) returns (C) }",
+		},
+		{
+			name:  "unclosed service",
+			proto: "service A { rpc B(C) returns (C);",
+		},
+		{
+			name:  "unclosed message",
+			proto: "message A { string b = 1;",
+		},
+		{
+			name:  "unclosed comment",
+			proto: "/* service A {}",
+		},
+		{
+			name:  "unclosed quote",
+			proto: `option go_package = "a;`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseProto("a.proto", test.proto)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := map[string]string{
+		"demoFuc":   "DemoFuc",
+		"say_hello": "SayHello",
+		"_hidden":   "XHidden",
+		"a_B":       "A_B",
+		"v2_value":  "V2Value",
+		"":          "",
+	}
+
+	for in, out := range tests {
+		assert.Equal(t, out, camelCase(in), in)
+	}
+}
+
+func TestGoPackageName(t *testing.T) {
+	assert.Equal(t, "pb", goPackageName("a.proto", "greet.v1", "example.com/greet/pb"))
+	assert.Equal(t, "greetpb", goPackageName("a.proto", "greet.v1", "example.com/greet;greetpb"))
+	assert.Equal(t, "greet_v1", goPackageName("a.proto", "greet.v1", ""))
+	assert.Equal(t, "user_info", goPackageName("dir/user-info.proto", "", ""))
+}
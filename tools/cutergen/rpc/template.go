@@ -0,0 +1,122 @@
+package rpc
+
+const (
+	mainTemplate = `package main
+
+import (
+	"flag"
+	"fmt"
+
+	"{{.ImportPath}}/cmd/rpc/config"
+	{{.ProtoImport}}
+	"{{.ImportPath}}/rpcserver"
+	"github.com/vsaien/cuter/lib/cuter"
+	"github.com/vsaien/cuter/lib/rpcx"
+	"google.golang.org/grpc"
+)
+
+var configFile = flag.String("f", "cmd/rpc/config/{{.Name}}.json", "the config file")
+
+func main() {
+	flag.Parse()
+
+	var c config.Config
+	cuter.MustLoadConfig(*configFile, &c)
+
+	server := rpcx.MustNewServer(c.RpcServerConf, func(grpcServer *grpc.Server) {
+{{- range .Services}}
+		{{$.GoPackage}}.Register{{.Name}}Server(grpcServer, rpcserver.New{{.Name}}Server())
+{{- end}}
+	})
+	defer server.Stop()
+
+	fmt.Printf("Starting rpc server at %s...\n", c.ListenOn)
+	server.Start()
+}
+`
+
+	configTemplate = `package config
+
+import "github.com/vsaien/cuter/lib/rpcx"
+
+type Config struct {
+	rpcx.RpcServerConf
+}
+`
+
+	configJsonTemplate = `{
+  "Name": "{{.Name}}-rpc",
+  "Log": {
+    "Mode": "console"
+  },
+  "ListenOn": "127.0.0.1:8080"
+}
+`
+
+	serverTemplate = `package rpcserver
+
+import (
+	"context"
+
+	{{.ProtoImport}}
+)
+
+type {{.Service.Name}}Server struct {
+}
+
+func New{{.Service.Name}}Server() *{{.Service.Name}}Server {
+	return &{{.Service.Name}}Server{}
+}
+{{range .Service.Methods}}
+func (s *{{$.Service.Name}}Server) {{.Name}}(ctx context.Context, req *{{$.GoPackage}}.{{.Request}}) (*{{$.GoPackage}}.{{.Response}}, error) {
+	// todo: implement the logic of {{.Name}}
+	return &{{$.GoPackage}}.{{.Response}}{}, nil
+}
+{{end}}`
+
+	clientTemplate = `// Code generated by cutergen. DO NOT EDIT.
+
+package {{.ClientPackage}}
+
+import (
+	"context"
+	"errors"
+
+	{{.ProtoImport}}
+	"github.com/vsaien/cuter/lib/rpcx"
+	"google.golang.org/grpc"
+)
+
+var ErrNoRpcClient = errors.New("no rpc client available")
+{{range $service := .Services}}
+type {{.Name}}Client struct {
+	cli *rpcx.RpcClient
+}
+
+func New{{.Name}}Client(cli *rpcx.RpcClient) *{{.Name}}Client {
+	return &{{.Name}}Client{
+		cli: cli,
+	}
+}
+
+func MustNew{{.Name}}Client(c rpcx.RpcClientConf) *{{.Name}}Client {
+	return New{{.Name}}Client(rpcx.MustNewClient(c))
+}
+{{range .Methods}}
+func (c *{{$service.Name}}Client) {{.Name}}(ctx context.Context, in *{{$.GoPackage}}.{{.Request}},
+	opts ...grpc.CallOption) (*{{$.GoPackage}}.{{.Response}}, error) {
+	conn, ok := c.cli.Next()
+	if !ok {
+		return nil, ErrNoRpcClient
+	}
+
+	return {{$.GoPackage}}.New{{$service.Name}}Client(conn).{{.Name}}(ctx, in, opts...)
+}
+{{end}}{{end}}`
+
+	clientConfigTemplate = `{
+  "Server": "127.0.0.1:8080",
+  "Timeout": 2000
+}
+`
+)
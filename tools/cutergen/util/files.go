@@ -0,0 +1,78 @@
+package util
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// ExecuteTemplate executes the template text with data.
+func ExecuteTemplate(name, text string, data interface{}) ([]byte, error) {
+	tpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// FormatTemplate executes the template text with data, and formats the output as go source.
+func FormatTemplate(name, text string, data interface{}) ([]byte, error) {
+	content, err := ExecuteTemplate(name, text, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return format.Source(content)
+}
+
+// WriteFile writes content into the file of filename, the parent directories are created if absent.
+func WriteFile(filename string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, content, 0644)
+}
+
+// WriteFileIfAbsent writes the file only if it doesn't exist, used for the files edited by the users.
+func WriteFileIfAbsent(filename string, content []byte) error {
+	if _, err := os.Stat(filename); err == nil {
+		return nil
+	}
+
+	return WriteFile(filename, content)
+}
+
+// File is a generated file, the files edited by the users are only written if absent.
+type File struct {
+	Path      string
+	Content   []byte
+	Overwrite bool
+}
+
+// WriteFiles writes files into dir.
+func WriteFiles(dir string, files []File) error {
+	for _, f := range files {
+		filename := filepath.Join(dir, f.Path)
+		var err error
+		if f.Overwrite {
+			err = WriteFile(filename, f.Content)
+		} else {
+			err = WriteFileIfAbsent(filename, f.Content)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
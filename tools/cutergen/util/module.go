@@ -0,0 +1,63 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const goModFile = "go.mod"
+
+var ErrNoModule = errors.New("no go.mod found in the dir or its parents")
+
+// ImportPath returns the import path of dir by the module path in the nearest go.mod.
+func ImportPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for root := abs; ; {
+		module, err := modulePath(filepath.Join(root, goModFile))
+		if err == nil {
+			rel, err := filepath.Rel(root, abs)
+			if err != nil {
+				return "", err
+			}
+
+			return path.Join(module, filepath.ToSlash(rel)), nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(root)
+		if parent == root {
+			return "", ErrNoModule
+		}
+		root = parent
+	}
+}
+
+func modulePath(goMod string) (string, error) {
+	file, err := os.Open(goMod)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", errors.New("no module declared in " + goMod)
+}
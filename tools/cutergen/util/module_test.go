@@ -0,0 +1,33 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "cutergen")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, goModFile),
+		[]byte("module example.com/foo\n\ngo 1.12\n"), 0644))
+
+	path, err := ImportPath(root)
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com/foo", path)
+
+	// the dir doesn't need to exist yet
+	path, err = ImportPath(filepath.Join(root, "application", "user"))
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com/foo/application/user", path)
+}
+
+func TestImportPathNoModule(t *testing.T) {
+	_, err := ImportPath(string(filepath.Separator))
+	assert.Equal(t, ErrNoModule, err)
+}
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Title converts the snake or kebab cased name to the camel case with the first letter upper cased,
+// like user_info to UserInfo.
+func Title(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, ch := range name {
+		switch {
+		case ch == '_' || ch == '-' || ch == ' ' || ch == '.':
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(ch))
+			upper = false
+		default:
+			b.WriteRune(ch)
+		}
+	}
+
+	return b.String()
+}
+
+// Untitle converts the name to the camel case with the first letter lower cased, like user_info to userInfo.
+func Untitle(name string) string {
+	title := Title(name)
+	if len(title) == 0 {
+		return title
+	}
+
+	runes := []rune(title)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// Lower converts the name to the lower case without separators, used as file and package names,
+// like user_info to userinfo.
+func Lower(name string) string {
+	return strings.ToLower(Title(name))
+}
@@ -0,0 +1,30 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		title   string
+		untitle string
+		lower   string
+	}{
+		{"user", "User", "user", "user"},
+		{"user_info", "UserInfo", "userInfo", "userinfo"},
+		{"user-info", "UserInfo", "userInfo", "userinfo"},
+		{"UserInfo", "UserInfo", "userInfo", "userinfo"},
+		{"", "", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.title, Title(test.name))
+			assert.Equal(t, test.untitle, Untitle(test.name))
+			assert.Equal(t, test.lower, Lower(test.name))
+		})
+	}
+}